@@ -1,21 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/clinical-trials-microservice/internal/api"
 	"github.com/clinical-trials-microservice/internal/cache"
 	"github.com/clinical-trials-microservice/internal/handlers"
+	"github.com/clinical-trials-microservice/internal/logging"
 	"github.com/clinical-trials-microservice/internal/middleware"
+	"github.com/clinical-trials-microservice/internal/tracing"
+	"github.com/clinical-trials-microservice/internal/version"
+	"github.com/clinical-trials-microservice/internal/watch"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// shutdownTimeout bounds how long in-flight requests may take to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// serviceName identifies this service in logs and traces
+const serviceName = "clinical-trials-microservice"
+
 // getEnv gets environment variable or returns default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -24,65 +42,362 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvInt gets an integer environment variable or returns default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvUint gets an unsigned integer environment variable or returns default value
+func getEnvUint(key string, defaultValue uint64) uint64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFloat gets a floating-point environment variable or returns default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "30s") or returns default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 func main() {
 	// Initialize structured logger
 	initLogger()
 
 	// Configuration flags
 	port := flag.String("port", getEnv("PORT", "8080"), "Server port")
+	environment := flag.String("env", getEnv("ENVIRONMENT", ""), "Deployment environment added to every log line (e.g. staging, prod)")
 	cacheEnabled := flag.Bool("cache", true, "Enable caching")
-	cacheTTL := flag.Duration("cache-ttl", 6*time.Hour, "Cache TTL duration")
+	cacheTTL := flag.Duration("cache-ttl", cache.DefaultTTL, "Cache TTL duration (clamped to 1m-168h)")
+	cacheCleanupInterval := flag.Duration("cache-cleanup-interval", getEnvDuration("CACHE_CLEANUP_INTERVAL", 0), "How often expired cache entries are removed (0 = half the TTL, at least 1m)")
+	cacheTTLJitter := flag.Int("cache-ttl-jitter", getEnvInt("CACHE_TTL_JITTER", 0), "Randomize cache entry TTLs by up to ±N percent so they do not expire together (0-50)")
+	cacheMaxValueBytes := flag.Int("cache-max-value-bytes", getEnvInt("CACHE_MAX_VALUE_BYTES", cache.DefaultMaxValueBytes), "Largest JSON size in bytes of a cached value; larger responses are served but not cached (0 = no limit)")
+	cacheShards := flag.Int("cache-shards", getEnvInt("CACHE_SHARDS", 1), "Number of cache shards, chosen by key hash, to reduce lock contention under high concurrency (1 to 256)")
+	cacheKeyVersion := flag.String("cache-key-version", getEnv("CACHE_KEY_VERSION", cache.DefaultKeyVersion), "Version prefix of cache keys; changing it invalidates previously cached entries")
+	trustedProxies := flag.String("trusted-proxies", getEnv("TRUSTED_PROXIES", ""), "Comma-separated proxy CIDRs or IPs whose X-Forwarded-For/X-Real-IP headers are trusted (empty = use the connection address)")
+	rateLimit := flag.Float64("rate-limit", getEnvFloat("RATE_LIMIT", 0), "Requests per second allowed per client IP (0 = unlimited; /health is exempt)")
+	rateLimitBurst := flag.Int("rate-limit-burst", getEnvInt("RATE_LIMIT_BURST", 20), "Requests a client IP may burst above -rate-limit")
+	logErrorBodyBytes := flag.Int("log-error-body-bytes", getEnvInt("LOG_ERROR_BODY_BYTES", middleware.DefaultErrorBodyLogBytes), "Bytes of 4xx/5xx response bodies included in request logs (0 = none)")
+	serverTiming := flag.Bool("server-timing", getEnv("SERVER_TIMING", "true") == "true", "Send a Server-Timing header with the time taken to produce each response")
+	logSampleRate := flag.Uint64("log-sample-rate", getEnvUint("LOG_SAMPLE_RATE", 1), "Log 1 in N successful requests (errors are always logged)")
+	ictrpURL := flag.String("ictrp-url", getEnv("ICTRP_URL", ""), "WHO ICTRP web service URL (enables registry=ictrp)")
+	idempotencyTTL := flag.Duration("idempotency-ttl", getEnvDuration("IDEMPOTENCY_TTL", handlers.DefaultIdempotencyTTL), "How long the response to an Idempotency-Key on the watch endpoints is replayed to retries")
+	exportTTL := flag.Duration("export-ttl", getEnvDuration("EXPORT_TTL", handlers.DefaultExportTTL), "How long an export cursor can be resumed after its last page was served")
+	maxResponseTrials := flag.Int("max-response-trials", getEnvInt("MAX_RESPONSE_TRIALS", 0), "Maximum trials returned per search response; the rest is reachable via next_page_token (0 = no cap)")
+	maxPageSize := flag.Int("max-page-size", getEnvInt("MAX_PAGE_SIZE", api.MaxPageSize), "Largest page_size a search may request; larger searches get a 400 asking to paginate (1-1000)")
+	defaultPageSize := flag.Int("default-page-size", getEnvInt("DEFAULT_PAGE_SIZE", api.DefaultPageSize), "Page size used when a search omits page_size (1-1000)")
+	maxFillPages := flag.Int("max-fill-pages", getEnvInt("MAX_FILL_PAGES", api.DefaultMaxFillPages), "Most upstream pages a fill_page=true search fetches")
+	maxUpstream := flag.Int("max-upstream-concurrency", getEnvInt("MAX_UPSTREAM_CONCURRENCY", 4), "Maximum concurrent in-flight upstream calls (0 = unlimited)")
+	userAgent := flag.String("user-agent", getEnv("UPSTREAM_USER_AGENT", api.DefaultUserAgent()), "User-Agent sent on upstream requests")
+	mockUpstream := flag.Bool("mock", getEnv("MOCK_UPSTREAM", "false") == "true", "Serve synthetic fixture trials instead of calling ClinicalTrials.gov (load tests and demos)")
+	strictDecoding := flag.Bool("strict-decoding", getEnv("STRICT_DECODING", "false") == "true", "Log upstream study fields the service does not map yet (debug level)")
+	upstreamHeaders := flag.String("log-upstream-headers", getEnv("LOG_UPSTREAM_HEADERS", ""), "Comma-separated upstream response headers to log at debug level (e.g. Retry-After,X-RateLimit-*)")
+	adminToken := flag.String("admin-token", getEnv("ADMIN_TOKEN", ""), "Bearer token required by admin endpoints such as /api/v1/config (empty = admin endpoints disabled)")
+	pageTokenSecret := flag.String("page-token-secret", getEnv("PAGE_TOKEN_SECRET", ""), "Key used to sign page tokens; must be shared by all instances (random per process if empty)")
+	maxConditions := flag.Int("max-conditions", getEnvInt("MAX_CONDITIONS", handlers.DefaultMaxConditions), "Maximum conditions per search")
+	maxQueryLength := flag.Int("max-query-length", getEnvInt("MAX_QUERY_LENGTH", handlers.DefaultMaxQueryLength), "Longest URL-encoded condition query a search may send upstream; longer searches get a 400")
+	maxPhases := flag.Int("max-phases", getEnvInt("MAX_PHASES", handlers.DefaultMaxPhases), "Maximum phases per search")
+	maxStatuses := flag.Int("max-statuses", getEnvInt("MAX_STATUSES", handlers.DefaultMaxStatuses), "Maximum statuses per search")
+	allowedConditions := flag.String("allowed-conditions", getEnv("ALLOWED_CONDITIONS", ""), "Comma-separated conditions searches are limited to (empty = unrestricted)")
+	allowedConditionsMode := flag.String("allowed-conditions-mode", getEnv("ALLOWED_CONDITIONS_MODE", handlers.ConditionsModeReject), "What to do with conditions outside -allowed-conditions: reject (400) or restrict (drop them)")
+	warmup := flag.Bool("warmup", getEnv("WARMUP", "false") == "true", "Prime the cache with common searches in the background at startup")
+	warmupFile := flag.String("warmup-file", getEnv("WARMUP_FILE", ""), "JSON file with the search requests to prime (implies -warmup; defaults to the SCI recruiting search)")
+	envelope := flag.Bool("envelope", getEnv("RESPONSE_ENVELOPE", "false") == "true", "Wrap JSON responses in a data/meta/errors envelope by default (?envelope= overrides per request)")
+	debug := flag.Bool("debug", getEnv("DEBUG", "false") == "true", "Enable debug features such as ?explain=true on search")
+	watchMaxTrials := flag.Int("watch-max-trials", getEnvInt("WATCH_MAX_TRIALS", watch.DefaultMaxTrials), "Maximum trials watched at once; subscriptions to more get a 429")
+	watchMaxWebhooks := flag.Int("watch-max-webhooks", getEnvInt("WATCH_MAX_WEBHOOKS", watch.DefaultMaxWebhooksPerTrial), "Maximum webhooks registered per watched trial; more get a 429")
+	watchAllowPrivate := flag.Bool("watch-allow-private-webhooks", getEnv("WATCH_ALLOW_PRIVATE_WEBHOOKS", "false") == "true", "Allow webhooks on loopback, private and link-local addresses (local development only)")
+	watchInterval := flag.Duration("watch-interval", getEnvDuration("WATCH_INTERVAL", watch.DefaultInterval), "How often trials watched via /api/v1/watch are re-fetched for status changes (0 = watching disabled)")
+	readyErrorWindow := flag.Int("ready-error-window", getEnvInt("READY_ERROR_WINDOW", api.DefaultErrorWindow), "Recent upstream calls /ready computes the error rate over")
+	readyErrorThreshold := flag.Float64("ready-error-threshold", getEnvFloat("READY_ERROR_THRESHOLD", api.DefaultErrorRateThreshold), "Recent upstream error rate (0-1) above which /ready reports degraded")
+	breakerThreshold := flag.Int("breaker-threshold", api.DefaultBreakerThreshold, "Consecutive upstream failures before the circuit opens")
+	breakerTimeout := flag.Duration("breaker-timeout", api.DefaultBreakerOpenTimeout, "How long the upstream circuit stays open before probing")
 	flag.Parse()
 
+	log.Logger = withDeploymentFields(log.Logger, *environment)
+
+	if err := middleware.SetTrustedProxies(strings.Split(*trustedProxies, ",")); err != nil {
+		log.Fatal().Err(err).Msg("Invalid trusted proxies")
+	}
+	middleware.SetErrorBodyLogBytes(*logErrorBodyBytes)
+	middleware.SetServerTiming(*serverTiming)
+	if mode := strings.ToLower(*allowedConditionsMode); mode != handlers.ConditionsModeReject && mode != handlers.ConditionsModeRestrict {
+		log.Fatal().
+			Str("allowed_conditions_mode", *allowedConditionsMode).
+			Msg("Invalid allowed conditions mode")
+	}
+	if *defaultPageSize < 1 || *defaultPageSize > api.MaxPageSize {
+		log.Fatal().
+			Int("default_page_size", *defaultPageSize).
+			Int("max_page_size", api.MaxPageSize).
+			Msg("Invalid default page size")
+	}
+
+	// Canceled on SIGINT/SIGTERM; stops background work and shuts the server down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize tracing (exports only when an OTLP endpoint is configured)
+	shutdownTracing, err := tracing.Setup(context.Background(), serviceName)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+	if tracing.Enabled() {
+		log.Info().Msg("OpenTelemetry tracing enabled")
+	}
+
 	// Initialize API client
-	apiClient := api.NewClinicalTrialsClient()
+	clientOpts := []api.Option{
+		api.WithCircuitBreaker(*breakerThreshold, *breakerTimeout),
+		api.WithErrorTracking(*readyErrorWindow, *readyErrorThreshold),
+		api.WithLoggedResponseHeaders(strings.Split(*upstreamHeaders, ",")...),
+		api.WithMaxConcurrent(*maxUpstream),
+		api.WithDefaultPageSize(*defaultPageSize),
+		api.WithMaxFillPages(*maxFillPages),
+		api.WithUserAgent(*userAgent),
+		api.WithStrictDecoding(*strictDecoding),
+	}
+	if *mockUpstream {
+		clientOpts = append(clientOpts, api.WithMockUpstream())
+		log.Warn().Msg("Mock mode enabled, serving synthetic fixture trials instead of ClinicalTrials.gov")
+	}
+	apiClient := api.NewClinicalTrialsClient(clientOpts...)
 	log.Info().Msg("ClinicalTrials.gov API client initialized")
 
 	// Initialize cache
 	var trialCache *cache.Cache
 	if *cacheEnabled {
-		trialCache = cache.NewCache(*cacheTTL)
-		log.Info().Dur("ttl", *cacheTTL).Msg("Cache enabled")
+		trialCache = cache.NewCache(*cacheTTL,
+			cache.WithKeyVersion(*cacheKeyVersion),
+			cache.WithTTLJitter(*cacheTTLJitter),
+			cache.WithCleanupInterval(*cacheCleanupInterval),
+			cache.WithMaxValueBytes(*cacheMaxValueBytes),
+			cache.WithShards(*cacheShards),
+		)
+		log.Info().
+			Dur("ttl", trialCache.TTL()).
+			Dur("cleanup_interval", trialCache.CleanupInterval()).
+			Int("ttl_jitter_percent", *cacheTTLJitter).
+			Int("max_value_bytes", *cacheMaxValueBytes).
+			Int("shards", trialCache.Shards()).
+			Str("key_version", *cacheKeyVersion).
+			Msg("Cache enabled")
 	} else {
 		trialCache = cache.NewCache(0) // Will use default
 		log.Info().Msg("Cache disabled")
 	}
 
 	// Initialize handlers
-	trialsHandler := handlers.NewTrialsHandler(apiClient, trialCache, *cacheEnabled)
+	effective := effectiveConfig(flag.CommandLine, map[string]interface{}{
+		"cache_ttl":              trialCache.TTL().String(),
+		"cache_cleanup_interval": trialCache.CleanupInterval().String(),
+		"default_page_size":      *defaultPageSize,
+		"default_conditions":     api.DefaultConditionQuery,
+		"log_level":              log.Logger.GetLevel().String(),
+		"tracing_enabled":        tracing.Enabled(),
+	})
+	handlerOpts := []handlers.Option{
+		handlers.WithEffectiveConfig(effective),
+		handlers.WithDebug(*debug),
+		handlers.WithPageTokenSecret(*pageTokenSecret),
+		handlers.WithMaxResponseTrials(*maxResponseTrials),
+		handlers.WithMaxPageSize(*maxPageSize),
+		handlers.WithExportTTL(*exportTTL),
+		handlers.WithIdempotencyTTL(*idempotencyTTL),
+		handlers.WithEnvelope(*envelope),
+		handlers.WithSearchLimits(*maxConditions, *maxPhases, *maxStatuses),
+		handlers.WithMaxQueryLength(*maxQueryLength),
+	}
+	if *allowedConditions != "" {
+		handlerOpts = append(handlerOpts, handlers.WithAllowedConditions(strings.Split(*allowedConditions, ","), *allowedConditionsMode))
+		log.Info().
+			Str("allowed_conditions", *allowedConditions).
+			Str("mode", *allowedConditionsMode).
+			Msg("Search conditions restricted to allowlist")
+	}
+	if *watchInterval > 0 {
+		watcher := watch.NewWatcher(apiClient,
+			watch.WithInterval(*watchInterval),
+			watch.WithLimits(*watchMaxTrials, *watchMaxWebhooks),
+			watch.WithAllowPrivateWebhooks(*watchAllowPrivate))
+		go watcher.Run(ctx)
+		handlerOpts = append(handlerOpts, handlers.WithWatcher(watcher))
+		log.Info().Dur("interval", *watchInterval).Msg("Trial status watching enabled")
+	}
+	if *ictrpURL != "" {
+		handlerOpts = append(handlerOpts, handlers.WithRegistry(api.NewICTRPClient(*ictrpURL)))
+		log.Info().Msg("WHO ICTRP registry enabled")
+	}
+	trialsHandler := handlers.NewTrialsHandler(apiClient, trialCache, *cacheEnabled, handlerOpts...)
+	if *debug {
+		log.Warn().Msg("Debug mode enabled, internal query details are exposed")
+	}
+
+	// Prime the cache in the background so startup is not delayed
+	if *warmup || *warmupFile != "" {
+		warmupRequests := handlers.DefaultWarmupRequests
+		if *warmupFile != "" {
+			warmupRequests, err = handlers.LoadWarmupRequests(*warmupFile)
+			if err != nil {
+				log.Fatal().Err(err).Str("file", *warmupFile).Msg("Invalid cache warm-up configuration")
+			}
+		}
+		if *cacheEnabled {
+			go trialsHandler.WarmCache(ctx, warmupRequests)
+		} else {
+			log.Warn().Msg("Cache warm-up requested but cache is disabled, skipping")
+		}
+	}
 
 	// Setup routes
 	router := mux.NewRouter()
 
 	// Add middleware (order matters - logging first to capture all requests)
-	router.Use(middleware.LoggingMiddleware)
+	router.Use(middleware.SampledLoggingMiddleware(*logSampleRate))
+	router.Use(middleware.TracingMiddleware)
+	router.Use(middleware.DeadlineMiddleware)
 	router.Use(corsMiddleware)
+	if *rateLimit > 0 {
+		router.Use(middleware.RateLimitMiddleware(*rateLimit, *rateLimitBurst, "/health", "/ready"))
+		log.Info().
+			Float64("rate_limit", *rateLimit).
+			Int("burst", *rateLimitBurst).
+			Msg("Per-client rate limiting enabled")
+	}
 
-	// Health check
-	router.HandleFunc("/health", trialsHandler.Health).Methods("GET")
-
-	// API routes
-	apiRouter := router.PathPrefix("/api/v1").Subrouter()
-	apiRouter.HandleFunc("/trials/search", trialsHandler.SearchTrials).Methods("GET")
-	apiRouter.HandleFunc("/trials/search", trialsHandler.SearchTrialsPost).Methods("POST")
-	apiRouter.HandleFunc("/trials/{nct_id}", trialsHandler.GetTrialByID).Methods("GET")
+	registerRoutes(router, trialsHandler, *adminToken)
 
 	// Start server
 	addr := ":" + *port
 	log.Info().
 		Str("port", *port).
 		Str("address", addr).
+		Str("version", version.Version).
+		Str("commit", version.Commit).
 		Msg("Starting server")
 
 	log.Info().Msg("API endpoints:")
 	log.Info().Msg("  GET  /health")
+	log.Info().Msg("  GET  /ready")
 	log.Info().Msg("  GET  /api/v1/trials/search")
 	log.Info().Msg("  POST /api/v1/trials/search")
 	log.Info().Msg("  GET  /api/v1/trials/{nct_id}")
+	log.Info().Msg("  GET  /api/v1/trials/{nct_id}/history")
+	log.Info().Msg("  GET  /api/v1/conditions/suggest")
+	log.Info().Msg("  POST /api/v1/watch/{nct_id}")
+	log.Info().Msg("  DELETE /api/v1/watch/{nct_id}")
+	if *adminToken != "" {
+		log.Info().Msg("  GET  /api/v1/config (admin)")
+		log.Info().Msg("  GET  /api/v1/cache/keys (admin)")
+	}
+
+	server := &http.Server{Addr: addr, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Server failed to start")
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info().Msg("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Server shutdown did not complete")
+	}
+}
+
+// registerRoutes adds the service endpoints to router. Every route also accepts OPTIONS so
+// CORS preflights reach corsMiddleware; other methods on a known path get a 405 with an
+// Allow header, and unknown paths a JSON 404. Admin endpoints are only registered when
+// adminToken is set, and require it as a bearer token.
+func registerRoutes(router *mux.Router, trialsHandler *handlers.TrialsHandler, adminToken string) {
+	// Health check
+	router.HandleFunc("/health", trialsHandler.Health).Methods("GET", "HEAD", "OPTIONS")
+	router.HandleFunc("/ready", trialsHandler.Ready).Methods("GET", "HEAD", "OPTIONS")
+
+	// API routes
+	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	apiRouter.HandleFunc("/trials/search", trialsHandler.SearchTrials).Methods("GET", "HEAD", "OPTIONS")
+	apiRouter.HandleFunc("/trials/search", trialsHandler.SearchTrialsPost).Methods("POST")
+	apiRouter.HandleFunc("/trials/nearby", trialsHandler.NearbyTrials).Methods("GET", "HEAD", "OPTIONS")
+	apiRouter.HandleFunc("/trials/summary/locations", trialsHandler.SummarizeLocations).Methods("GET", "HEAD", "OPTIONS")
+	apiRouter.HandleFunc("/trials/{nct_id}", trialsHandler.GetTrialByID).Methods("GET", "HEAD", "OPTIONS")
+	apiRouter.HandleFunc("/trials/{nct_id}/history", trialsHandler.GetTrialHistory).Methods("GET", "HEAD", "OPTIONS")
+	apiRouter.HandleFunc("/conditions/suggest", trialsHandler.SuggestConditions).Methods("GET", "HEAD", "OPTIONS")
+	apiRouter.HandleFunc("/watch/{nct_id}", trialsHandler.Idempotent(trialsHandler.WatchTrial)).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/watch/{nct_id}", trialsHandler.Idempotent(trialsHandler.UnwatchTrial)).Methods("DELETE")
+	if adminToken != "" {
+		admin := middleware.AdminAuthMiddleware(adminToken)
+		apiRouter.Handle("/config", admin(http.HandlerFunc(trialsHandler.GetConfig))).Methods("GET", "HEAD")
+		apiRouter.Handle("/cache/keys", admin(http.HandlerFunc(trialsHandler.ListCacheKeys))).Methods("GET", "HEAD")
+	}
+
+	router.MethodNotAllowedHandler = trialsHandler.MethodNotAllowed(router)
+	router.NotFoundHandler = trialsHandler.NotFound(router)
+}
+
+// effectiveConfig returns the parsed value of every flag in fs plus the resolved values the
+// flags alone do not show (clamped TTLs, built-in defaults). Flags whose name mentions a
+// secret, token or password are redacted, only reporting whether they are set.
+func effectiveConfig(fs *flag.FlagSet, resolved map[string]interface{}) map[string]interface{} {
+	flags := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if isSecretFlag(f.Name) {
+			if value != "" {
+				value = "[REDACTED]"
+			}
+			flags[f.Name] = value
+			return
+		}
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if _, isDuration := getter.Get().(time.Duration); !isDuration {
+				flags[f.Name] = getter.Get()
+				return
+			}
+		}
+		flags[f.Name] = value
+	})
+	return map[string]interface{}{
+		"version":   version.Version,
+		"commit":    version.Commit,
+		"flags":     flags,
+		"effective": resolved,
+	}
+}
 
-	if err := http.ListenAndServe(addr, router); err != nil {
-		log.Fatal().Err(err).Msg("Server failed to start")
+// isSecretFlag reports whether a flag holds a credential that must not be exposed
+func isSecretFlag(name string) bool {
+	for _, marker := range []string{"secret", "token", "password"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
 	}
+	return false
 }
 
 // initLogger initializes the structured logger
@@ -94,29 +409,116 @@ func initLogger() {
 		level = zerolog.InfoLevel
 		log.Warn().Str("level", logLevel).Msg("Invalid LOG_LEVEL, defaulting to info")
 	}
-	zerolog.SetGlobalLevel(level)
+
+	// Components may log below LOG_LEVEL (e.g. LOG_LEVEL_API=debug): the global level lets the
+	// most verbose one through and the default logger stays at LOG_LEVEL
+	componentLevels, componentErr := logging.LevelsFromEnv(os.Environ())
+	globalLevel := level
+	for _, componentLevel := range componentLevels {
+		globalLevel = min(globalLevel, componentLevel)
+	}
+	zerolog.SetGlobalLevel(globalLevel)
+	log.Logger = log.Logger.Level(level)
+	logging.SetLevels(componentLevels)
 
 	// Set time format to RFC3339 for structured logs
 	zerolog.TimeFieldFormat = time.RFC3339
 
 	// In production, use JSON format. In development, use console format for readability
 	logFormat := getEnv("LOG_FORMAT", "json")
+	var stdout io.Writer = os.Stdout
 	if logFormat == "console" || logFormat == "text" {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+		stdout = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	}
+
+	output, err := newLogWriter(logOutputFromEnv(), stdout)
+	if err != nil {
+		log.Logger = log.Output(stdout)
+		log.Warn().Err(err).Msg("Invalid log output, logging to stdout only")
+	} else {
+		log.Logger = log.Output(output)
+	}
+	if componentErr != nil {
+		log.Warn().Err(componentErr).Msg("Invalid component log level")
 	}
 
 	log.Info().
 		Str("level", level.String()).
 		Str("format", logFormat).
+		Str("output", getEnv("LOG_OUTPUT", logOutputStdout)).
 		Msg("Logger initialized")
 }
 
+// Log destinations accepted by LOG_OUTPUT
+const (
+	logOutputStdout = "stdout"
+	logOutputFile   = "file"
+	logOutputBoth   = "both"
+)
+
+// logOutputConfig is where logs are written and how the log file is rotated
+type logOutputConfig struct {
+	Output     string // stdout, file or both
+	File       string
+	MaxSizeMB  int  // Rotate once the file reaches this size
+	MaxAgeDays int  // Delete rotated files older than this (0 = keep)
+	MaxBackups int  // Rotated files kept (0 = keep all)
+	Compress   bool // Gzip rotated files
+}
+
+// logOutputFromEnv reads the log destination from LOG_OUTPUT, LOG_FILE and LOG_FILE_* variables
+func logOutputFromEnv() logOutputConfig {
+	return logOutputConfig{
+		Output:     strings.ToLower(getEnv("LOG_OUTPUT", logOutputStdout)),
+		File:       getEnv("LOG_FILE", ""),
+		MaxSizeMB:  getEnvInt("LOG_FILE_MAX_SIZE_MB", 100),
+		MaxAgeDays: getEnvInt("LOG_FILE_MAX_AGE_DAYS", 0),
+		MaxBackups: getEnvInt("LOG_FILE_MAX_BACKUPS", 0),
+		Compress:   getEnv("LOG_FILE_COMPRESS", "false") == "true",
+	}
+}
+
+// newLogWriter returns the writer logs go to. File output is always JSON and rotated by size
+// and age; stdout keeps the format chosen by LOG_FORMAT.
+func newLogWriter(cfg logOutputConfig, stdout io.Writer) (io.Writer, error) {
+	if cfg.Output == logOutputStdout {
+		return stdout, nil
+	}
+	if cfg.Output != logOutputFile && cfg.Output != logOutputBoth {
+		return nil, fmt.Errorf("LOG_OUTPUT must be %s, %s or %s, got %q", logOutputStdout, logOutputFile, logOutputBoth, cfg.Output)
+	}
+	if cfg.File == "" {
+		return nil, fmt.Errorf("LOG_OUTPUT=%s requires LOG_FILE", cfg.Output)
+	}
+	file := &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxAge:     cfg.MaxAgeDays,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	}
+	if cfg.Output == logOutputFile {
+		return file, nil
+	}
+	return zerolog.MultiLevelWriter(stdout, file), nil
+}
+
+// withDeploymentFields attaches the static service name and, when set, the deployment
+// environment to every line logged through the returned logger
+func withDeploymentFields(logger zerolog.Logger, environment string) zerolog.Logger {
+	fields := logger.With().Str("service", serviceName)
+	if environment = strings.TrimSpace(environment); environment != "" {
+		fields = fields.Str("env", environment)
+	}
+	return fields.Logger()
+}
+
 // corsMiddleware adds CORS headers to responses
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
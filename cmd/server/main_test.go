@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/api"
+	"github.com/clinical-trials-microservice/internal/cache"
+	"github.com/clinical-trials-microservice/internal/handlers"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+func TestWithDeploymentFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		wantEnv     interface{}
+	}{
+		{"environment set", "staging", "staging"},
+		{"environment unset", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := withDeploymentFields(zerolog.New(&buf), tt.environment)
+			logger.Info().Msg("sample")
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("Failed to decode log line %q: %v", buf.String(), err)
+			}
+			if entry["service"] != serviceName {
+				t.Errorf("Expected service %q, got %v", serviceName, entry["service"])
+			}
+			if env, ok := entry["env"]; env != tt.wantEnv || ok != (tt.wantEnv != nil) {
+				t.Errorf("Expected env %v, got %v (present: %v)", tt.wantEnv, env, ok)
+			}
+		})
+	}
+}
+
+func TestLogFileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "server.log")
+	t.Setenv("LOG_OUTPUT", "both")
+	t.Setenv("LOG_FILE", path)
+	t.Setenv("LOG_FILE_MAX_SIZE_MB", "10")
+
+	cfg := logOutputFromEnv()
+	if cfg.Output != logOutputBoth || cfg.File != path || cfg.MaxSizeMB != 10 {
+		t.Fatalf("Unexpected config from env: %+v", cfg)
+	}
+
+	var stdout bytes.Buffer
+	w, err := newLogWriter(cfg, &stdout)
+	if err != nil {
+		t.Fatalf("Failed to create log writer: %v", err)
+	}
+	logger := zerolog.New(w)
+	logger.Info().Msg("to file")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected log file to be written: %v", err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil || entry["message"] != "to file" {
+		t.Errorf("Expected JSON log line in file, got %q (%v)", data, err)
+	}
+	if !strings.Contains(stdout.String(), "to file") {
+		t.Errorf("Expected output=both to also write stdout, got %q", stdout.String())
+	}
+
+	for _, cfg := range []logOutputConfig{
+		{Output: logOutputFile},
+		{Output: "syslog", File: path},
+	} {
+		if _, err := newLogWriter(cfg, &stdout); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(corsMiddleware)
+	registerRoutes(router, handlers.NewTrialsHandler(api.NewClinicalTrialsClient(), cache.NewCache(time.Hour), false), "")
+
+	tests := []struct {
+		method    string
+		path      string
+		wantAllow string
+	}{
+		{http.MethodDelete, "/api/v1/trials/search", "GET, HEAD, OPTIONS, POST"},
+		{http.MethodPut, "/api/v1/trials/NCT00000001", "GET, HEAD, OPTIONS"},
+		{http.MethodDelete, "/api/v1/trials/NCT00000001/history", "GET, HEAD, OPTIONS"},
+		{http.MethodPost, "/health", "GET, HEAD, OPTIONS"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status 405, got %d", tt.method, tt.path, rec.Code)
+		}
+		if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.wantAllow, got)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+			t.Errorf("%s %s: expected a JSON error body, got %q", tt.method, tt.path, rec.Body.String())
+		}
+	}
+
+	// CORS preflights are still answered by corsMiddleware on every route
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/api/v1/trials/search", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("Expected CORS preflight to succeed, got %d with headers %v", rec.Code, rec.Header())
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, handlers.NewTrialsHandler(api.NewClinicalTrialsClient(), cache.NewCache(time.Hour), false), "")
+
+	for _, path := range []string{"/unknown", "/api/v1/unknown", "/api/v2/trials/search"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", path, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected JSON content type, got %q", path, ct)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode body %q: %v", path, rec.Body.String(), err)
+		}
+		if body["error"] != "not found" || body["path"] != path || len(body) != 2 {
+			t.Errorf("%s: expected {error, path} body, got %v", path, body)
+		}
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.Bool("cache", true, "")
+	fs.Duration("cache-ttl", time.Hour, "")
+	fs.Int("default-page-size", 100, "")
+	fs.Float64("rate-limit", 0, "")
+	fs.String("page-token-secret", "", "")
+	fs.String("admin-token", "", "")
+	if err := fs.Parse([]string{"-cache-ttl=2h", "-rate-limit=5", "-page-token-secret=s3cr3t-key", "-admin-token=adm1n-t0ken"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	config := effectiveConfig(fs, map[string]interface{}{"default_conditions": api.DefaultConditionQuery})
+
+	h := handlers.NewTrialsHandler(api.NewClinicalTrialsClient(), cache.NewCache(time.Hour), false, handlers.WithEffectiveConfig(config))
+	router := mux.NewRouter()
+	registerRoutes(router, h, "adm1n-t0ken")
+	request := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong", "adm1n-t0ken"} {
+		if rec := request(authorization); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected status 401, got %d", authorization, rec.Code)
+		}
+	}
+
+	rec := request("Bearer adm1n-t0ken")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "s3cr3t-key") || strings.Contains(rec.Body.String(), "adm1n-t0ken") {
+		t.Fatalf("Expected secrets to be redacted, got %s", rec.Body.String())
+	}
+	var body struct {
+		Flags     map[string]interface{} `json:"flags"`
+		Effective map[string]interface{} `json:"effective"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"cache":             true,
+		"cache-ttl":         "2h0m0s",
+		"default-page-size": float64(100),
+		"rate-limit":        float64(5),
+		"page-token-secret": "[REDACTED]",
+		"admin-token":       "[REDACTED]",
+	}
+	for name, want := range expected {
+		if got := body.Flags[name]; got != want {
+			t.Errorf("Flag %s: expected %v, got %v", name, want, got)
+		}
+	}
+	if body.Effective["default_conditions"] != api.DefaultConditionQuery {
+		t.Errorf("Expected default conditions in effective config, got %v", body.Effective)
+	}
+
+	// Without an admin token the endpoint does not exist
+	router = mux.NewRouter()
+	registerRoutes(router, h, "")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/config", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without an admin token, got %d", rec.Code)
+	}
+}
+
+func TestCacheKeysRoute(t *testing.T) {
+	trialCache := cache.NewCache(time.Hour)
+	trialCache.Set("trial:NCT00000001", "trial")
+	h := handlers.NewTrialsHandler(api.NewClinicalTrialsClient(), trialCache, true)
+	request := func(adminToken, authorization string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		registerRoutes(router, h, adminToken)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/cache/keys", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request("adm1n-t0ken", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without the admin token, got %d", rec.Code)
+	}
+	if rec := request("adm1n-t0ken", "Bearer adm1n-t0ken"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "trial:NCT00000001") {
+		t.Errorf("Expected the cached key with the admin token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := request("", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without an admin token, got %d", rec.Code)
+	}
+}
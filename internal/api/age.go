@@ -0,0 +1,55 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// ageUnitYears maps the age units registries use, in full or abbreviated, to their length in
+// years. ICTRP abbreviates to a single letter, where M is months.
+var ageUnitYears = map[string]float64{
+	"year": 1, "years": 1, "y": 1,
+	"month": 1.0 / 12, "months": 1.0 / 12, "m": 1.0 / 12,
+	"week": 7 / 365.25, "weeks": 7 / 365.25, "w": 7 / 365.25,
+	"day": 1 / 365.25, "days": 1 / 365.25, "d": 1 / 365.25,
+	"hour": 1 / 8766.0, "hours": 1 / 8766.0, "h": 1 / 8766.0,
+	"minute": 1 / 525960.0, "minutes": 1 / 525960.0, "min": 1 / 525960.0,
+}
+
+// ParseAge converts an eligibility age such as "18 Years", "6 Months", "28 Days" or "18Y"
+// to years, honoring the unit; a bare number is taken as years. It returns false for
+// "N/A", "No limit", empty strings and anything else it cannot parse.
+func ParseAge(age string) (float64, bool) {
+	age = strings.ToLower(strings.TrimSpace(age))
+	end := 0
+	for end < len(age) && (age[end] >= '0' && age[end] <= '9' || age[end] == '.') {
+		end++
+	}
+	value, err := strconv.ParseFloat(age[:end], 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	unit := strings.TrimSpace(age[end:])
+	if unit == "" {
+		return value, true
+	}
+	years, ok := ageUnitYears[unit]
+	if !ok {
+		return 0, false
+	}
+	return value * years, true
+}
+
+// ageYears returns ParseAge's value in years, or 0 when age cannot be parsed
+func ageYears(age string) float64 {
+	years, _ := ParseAge(age)
+	return years
+}
+
+// setAgeYears fills the numeric age bounds of an eligibility from its age strings
+func setAgeYears(eligibility *models.Eligibility) {
+	eligibility.MinimumAgeYears, _ = ParseAge(eligibility.MinimumAge)
+	eligibility.MaximumAgeYears, _ = ParseAge(eligibility.MaximumAge)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age       string
+		wantYears float64
+		wantOK    bool
+	}{
+		{"18 Years", 18, true},
+		{"1 Year", 1, true},
+		{"6 Months", 0.5, true},
+		{"2 Weeks", 14 / 365.25, true},
+		{"28 Days", 28 / 365.25, true},
+		{"12 Hours", 12 / 8766.0, true},
+		{"18Y", 18, true},
+		{"6M", 0.5, true},
+		{" 65 years ", 65, true},
+		{"21", 21, true},
+		{"N/A", 0, false},
+		{"No limit", 0, false},
+		{"18 Parsecs", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.age, func(t *testing.T) {
+			years, ok := ParseAge(tt.age)
+			if ok != tt.wantOK || math.Abs(years-tt.wantYears) > 1e-9 {
+				t.Errorf("ParseAge(%q) = %v, %v; expected %v, %v", tt.age, years, ok, tt.wantYears, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestConvertStudySetsAgeYears(t *testing.T) {
+	var study StudyData
+	study.ProtocolSection.EligibilityModule.MinimumAge = "6 Months"
+	study.ProtocolSection.EligibilityModule.MaximumAge = "N/A"
+
+	trial := NewClinicalTrialsClient().convertStudyToTrial(study)
+	want := models.Eligibility{MinimumAge: "6 Months", MaximumAge: "N/A", MinimumAgeYears: 0.5}
+	if !reflect.DeepEqual(trial.Eligibility, want) {
+		t.Errorf("Expected eligibility %+v, got %+v", want, trial.Eligibility)
+	}
+}
+
+func TestAgeFilterHonorsUnits(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	apiResp := &ClinicalTrialsGovResponse{}
+	for _, r := range []struct{ id, min, max string }{
+		{"NCT00000001", "6 Months", "4 Years"},
+		{"NCT00000002", "4 Weeks", "11 Months"},
+		{"NCT00000003", "7 Years", "12 Years"},
+	} {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = r.id
+		study.ProtocolSection.EligibilityModule.MinimumAge = r.min
+		study.ProtocolSection.EligibilityModule.MaximumAge = r.max
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	tests := []struct {
+		name string
+		req  models.SearchRequest
+		want []string
+	}{
+		{"age 1", models.SearchRequest{Age: 1}, []string{"NCT00000001"}},
+		{"age 8", models.SearchRequest{Age: 8}, []string{"NCT00000003"}},
+		{"maximum age in months", models.SearchRequest{MaximumAge: "6 Months"}, []string{"NCT00000001", "NCT00000002"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, tt.req)
+			got := make([]string, 0, len(resp.Trials))
+			for _, trial := range resp.Trials {
+				got = append(got, trial.NCTID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected trials %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
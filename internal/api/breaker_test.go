@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, WithCircuitBreaker(3, time.Minute))
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	// Consecutive failures trip the breaker
+	for i := 0; i < 3; i++ {
+		if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Call %d: expected upstream error, got %v", i+1, err)
+		}
+	}
+	if state := client.BreakerState(); state != BreakerOpen {
+		t.Fatalf("Expected breaker to be open, got %s", state)
+	}
+
+	// While open, calls fail fast without reaching the upstream
+	if _, err := client.GetTrialDetails(context.Background(), "NCT00000001"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected 3 upstream calls, got %d", got)
+	}
+
+	// A failed half-open probe re-opens the circuit
+	now = now.Add(time.Minute)
+	if state := client.BreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("Expected breaker to be half-open after timeout, got %s", state)
+	}
+	if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected probe to reach upstream and fail, got %v", err)
+	}
+	if state := client.BreakerState(); state != BreakerOpen {
+		t.Fatalf("Expected breaker to re-open after failed probe, got %s", state)
+	}
+
+	// A successful probe closes the circuit
+	healthy.Store(true)
+	now = now.Add(time.Minute)
+	if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err != nil {
+		t.Fatalf("Expected probe to succeed, got %v", err)
+	}
+	if state := client.BreakerState(); state != BreakerClosed {
+		t.Errorf("Expected breaker to close after successful probe, got %s", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, WithCircuitBreaker(2, time.Minute))
+	for i := 0; i < 5; i++ {
+		if _, err := client.GetTrialDetails(context.Background(), "NCT00000000"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Call %d: not-found responses must not trip the breaker", i+1)
+		}
+	}
+	if state := client.BreakerState(); state != BreakerClosed {
+		t.Errorf("Expected breaker to stay closed, got %s", state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	b := newCircuitBreaker(1, time.Second)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.recordFailure()
+	now = now.Add(time.Second)
+
+	if !b.allow() {
+		t.Fatal("Expected first half-open probe to be allowed")
+	}
+	if b.allow() {
+		t.Error("Expected concurrent half-open request to be rejected")
+	}
+}
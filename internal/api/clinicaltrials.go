@@ -1,51 +1,317 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/clinical-trials-microservice/internal/logging"
+	"github.com/clinical-trials-microservice/internal/middleware"
 	"github.com/clinical-trials-microservice/internal/models"
-	"github.com/rs/zerolog/log"
+	"github.com/clinical-trials-microservice/internal/version"
+	"github.com/rs/zerolog"
 )
 
 const (
 	// ClinicalTrialsGovBaseURL is the base URL for the API v2
 	ClinicalTrialsGovBaseURL = "https://clinicaltrials.gov/api/v2/studies"
+	// ClinicalTrialsGovHistoryURL is the base URL of study record histories, which API v2 does not serve
+	ClinicalTrialsGovHistoryURL = "https://clinicaltrials.gov/api/int/studies"
 	// DefaultRateLimitDelay is the delay between requests to respect rate limits
 	DefaultRateLimitDelay = time.Second * 2 // 50 requests/min = ~1.2 sec per request, use 2 for safety
+	// DefaultConditionQuery is the condition search used when no conditions or query are provided
+	DefaultConditionQuery = "spinal cord injury OR quadriplegia OR tetraplegia OR paraplegia"
+	// DefaultPageSize is the number of trials per page when the caller does not specify one
+	DefaultPageSize = 100
+	// MaxPageSize is the largest page size accepted by the ClinicalTrials.gov API
+	MaxPageSize = 1000
+	// ServiceContactURL is advertised in the User-Agent so the upstream can reach the maintainers
+	ServiceContactURL = "https://github.com/fcavalcantirj/clinical-trials-microservice"
+	// MaxRawStudyBytes is the largest upstream study body kept on a trial for ?raw=true
+	MaxRawStudyBytes = 512 << 10
+	// DefaultMaxFillPages is the most upstream pages a fill_page search fetches
+	DefaultMaxFillPages = 5
 )
 
+// FilteringNotice explains sparse pages when client-side filters removed trials from an upstream page
+const FilteringNotice = "Some filters (phase, age, country, contact, inactive status) are applied by this service " +
+	"after fetching one upstream page, so this page may hold fewer trials than page_size and total_count only " +
+	"counts the matches on this page. Follow next_page_token for more results."
+
+// ErrInvalidPageToken is returned when the upstream rejects the page token of a search
+var ErrInvalidPageToken = errors.New("invalid page token")
+
 // ClinicalTrialsClient handles interactions with ClinicalTrials.gov API
 type ClinicalTrialsClient struct {
-	baseURL     string
-	httpClient  *http.Client
-	rateLimiter chan struct{}
-	lastRequest time.Time
-	minDelay    time.Duration
+	baseURL      string
+	historyURL   string
+	httpClient   *http.Client
+	rateLimiter  chan struct{}
+	lastRequest  time.Time
+	minDelay     time.Duration
+	rateMu       sync.Mutex
+	breaker      *circuitBreaker
+	outcomes     *errorTracker // Outcomes of recent upstream calls, for readiness
+	inFlight     chan struct{} // Semaphore capping concurrent upstream calls; nil means unlimited
+	pageSize     int           // Page size used when a request does not specify one
+	maxFillPages int           // Upstream pages a fill_page search may fetch
+	userAgent    string
+	// strictDecode enables a shadow pass that logs study fields the decoder does not map
+	strictDecode bool
+	// loggedHeaders is the allowlist of upstream response headers logged at debug level.
+	// Entries ending in "*" match by prefix (e.g. "X-RateLimit-*").
+	loggedHeaders []string
+}
+
+// Option configures optional ClinicalTrialsClient behavior
+type Option func(*ClinicalTrialsClient)
+
+// WithCircuitBreaker configures the consecutive-failure threshold and open timeout of the upstream circuit breaker
+func WithCircuitBreaker(threshold int, openTimeout time.Duration) Option {
+	return func(c *ClinicalTrialsClient) {
+		c.breaker = newCircuitBreaker(threshold, openTimeout)
+	}
+}
+
+// WithErrorTracking sets how many recent upstream calls the error rate is computed over and
+// the rate above which UpstreamHealth reports the upstream as degraded
+func WithErrorTracking(window int, threshold float64) Option {
+	return func(c *ClinicalTrialsClient) {
+		c.outcomes = newErrorTracker(window, threshold)
+	}
+}
+
+// WithBaseURL overrides the upstream studies endpoint, e.g. to point at a mirror or mock server.
+// Record histories are then fetched from the same base, as {baseURL}/{nct_id}/history.
+func WithBaseURL(baseURL string) Option {
+	return func(c *ClinicalTrialsClient) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+		c.historyURL = c.baseURL
+	}
+}
+
+// WithRateLimitDelay overrides the minimum delay between upstream requests
+func WithRateLimitDelay(delay time.Duration) Option {
+	return func(c *ClinicalTrialsClient) {
+		c.minDelay = delay
+	}
+}
+
+// WithLoggedResponseHeaders enables debug logging of the given upstream response headers.
+// Only allowlisted headers are logged; a trailing "*" matches any header with that prefix.
+func WithLoggedResponseHeaders(names ...string) Option {
+	return func(c *ClinicalTrialsClient) {
+		c.loggedHeaders = nil
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				c.loggedHeaders = append(c.loggedHeaders, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+}
+
+// WithMaxConcurrent caps the number of in-flight upstream calls; callers beyond the cap wait
+// for a slot or until their context is done. A value of 0 or less means unlimited.
+func WithMaxConcurrent(n int) Option {
+	return func(c *ClinicalTrialsClient) {
+		if n <= 0 {
+			c.inFlight = nil
+			return
+		}
+		c.inFlight = make(chan struct{}, n)
+	}
+}
+
+// WithUserAgent overrides the User-Agent sent on upstream requests. An empty value keeps the default.
+func WithUserAgent(userAgent string) Option {
+	return func(c *ClinicalTrialsClient) {
+		if userAgent = strings.TrimSpace(userAgent); userAgent != "" {
+			c.userAgent = userAgent
+		}
+	}
+}
+
+// DefaultUserAgent identifies this service, its version and a contact URL to upstream registries
+func DefaultUserAgent() string {
+	return fmt.Sprintf("clinical-trials-microservice/%s (+%s)", version.Version, ServiceContactURL)
+}
+
+// WithDefaultPageSize overrides the page size used when a request does not specify one.
+// Values outside 1..MaxPageSize are ignored.
+func WithDefaultPageSize(n int) Option {
+	return func(c *ClinicalTrialsClient) {
+		if n > 0 && n <= MaxPageSize {
+			c.pageSize = n
+		}
+	}
+}
+
+// WithMaxFillPages bounds the upstream pages a fill_page search fetches. Values below 1 are ignored.
+func WithMaxFillPages(n int) Option {
+	return func(c *ClinicalTrialsClient) {
+		if n > 0 {
+			c.maxFillPages = n
+		}
+	}
+}
+
+// WithStrictDecoding enables a second decode pass that logs, at debug level, upstream study
+// fields this service does not map yet. The real decode is never affected.
+func WithStrictDecoding(enabled bool) Option {
+	return func(c *ClinicalTrialsClient) {
+		c.strictDecode = enabled
+	}
 }
 
 // NewClinicalTrialsClient creates a new client instance
-func NewClinicalTrialsClient() *ClinicalTrialsClient {
+func NewClinicalTrialsClient(opts ...Option) *ClinicalTrialsClient {
 	rateLimiter := make(chan struct{}, 1)
 	rateLimiter <- struct{}{} // Allow first request immediately
 
-	return &ClinicalTrialsClient{
-		baseURL:     ClinicalTrialsGovBaseURL,
-		httpClient:  &http.Client{Timeout: 30 * time.Second},
-		rateLimiter: rateLimiter,
-		minDelay:    DefaultRateLimitDelay,
-		lastRequest: time.Now().Add(-DefaultRateLimitDelay),
+	c := &ClinicalTrialsClient{
+		baseURL:      ClinicalTrialsGovBaseURL,
+		historyURL:   ClinicalTrialsGovHistoryURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		rateLimiter:  rateLimiter,
+		minDelay:     DefaultRateLimitDelay,
+		lastRequest:  time.Now().Add(-DefaultRateLimitDelay),
+		breaker:      newCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerOpenTimeout),
+		outcomes:     newErrorTracker(DefaultErrorWindow, DefaultErrorRateThreshold),
+		pageSize:     DefaultPageSize,
+		maxFillPages: DefaultMaxFillPages,
+		userAgent:    DefaultUserAgent(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// acquire waits for an upstream call slot, giving up when the context is done
+func (c *ClinicalTrialsClient) acquire(ctx context.Context) error {
+	if c.inFlight == nil {
+		return nil
+	}
+	select {
+	case c.inFlight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for upstream slot: %w", ctx.Err())
+	}
+}
+
+// release frees an upstream call slot taken by acquire
+func (c *ClinicalTrialsClient) release() {
+	if c.inFlight != nil {
+		<-c.inFlight
+	}
+}
+
+// get issues a GET request to the upstream bound to the caller's context
+func (c *ClinicalTrialsClient) get(ctx context.Context, fullURL string) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	httpReq, span := startUpstreamSpan(ctx, RegistryClinicalTrialsGov, httpReq)
+	resp, err := c.httpClient.Do(httpReq)
+	endUpstreamSpan(span, resp, err)
+	return resp, err
+}
+
+// DefaultPageSize returns the page size applied when a request omits one
+func (c *ClinicalTrialsClient) DefaultPageSize() int {
+	return c.pageSize
+}
+
+// BreakerState returns the current state of the upstream circuit breaker
+func (c *ClinicalTrialsClient) BreakerState() BreakerState {
+	return c.breaker.State()
+}
+
+// UpstreamHealth returns the error rate of recent upstream calls and whether it is above the
+// degraded threshold
+func (c *ClinicalTrialsClient) UpstreamHealth() UpstreamHealth {
+	return c.outcomes.health()
+}
+
+// upstreamLogger starts a logger context for an upstream call, tagged with the inbound
+// request ID so upstream calls can be tied to the user request that triggered them
+func upstreamLogger(ctx context.Context) zerolog.Context {
+	logger := logging.Logger(logging.ComponentAPI).With()
+	if requestID := middleware.RequestIDFromContext(ctx); requestID != "" {
+		logger = logger.Str("request_id", requestID)
+	}
+	return logger
+}
+
+// logResponseHeaders logs allowlisted upstream response headers at debug level
+func (c *ClinicalTrialsClient) logResponseHeaders(logger zerolog.Logger, resp *http.Response) {
+	if len(c.loggedHeaders) == 0 || resp == nil {
+		return
+	}
+
+	headers := zerolog.Dict()
+	found := false
+	for name, values := range resp.Header {
+		if c.isLoggedHeader(name) {
+			headers = headers.Str(name, strings.Join(values, ", "))
+			found = true
+		}
+	}
+	if !found {
+		return
+	}
+	logger.Debug().
+		Dict("response_headers", headers).
+		Msg("Upstream response headers")
+}
+
+// isLoggedHeader checks a canonical header name against the allowlist
+func (c *ClinicalTrialsClient) isLoggedHeader(name string) bool {
+	for _, allowed := range c.loggedHeaders {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// recordUpstreamResult feeds the outcome of an upstream call into the circuit breaker.
+// Transport errors, rate limiting and 5xx responses count as failures; anything else means the upstream is up.
+func (c *ClinicalTrialsClient) recordUpstreamResult(ctx context.Context, resp *http.Response, err error) {
+	if err != nil && ctx.Err() != nil {
+		// The caller went away; that says nothing about upstream health
+		c.breaker.cancelProbe()
+		return
+	}
+	if err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		c.breaker.recordFailure()
+		c.outcomes.record(true)
+		return
 	}
+	c.breaker.recordSuccess()
+	c.outcomes.record(false)
 }
 
 // rateLimit ensures we respect the API rate limits (50 requests/min)
 func (c *ClinicalTrialsClient) rateLimit() {
+	c.rateMu.Lock()
+	defer c.rateMu.Unlock()
+
 	elapsed := time.Since(c.lastRequest)
 	if elapsed < c.minDelay {
 		time.Sleep(c.minDelay - elapsed)
@@ -54,15 +320,93 @@ func (c *ClinicalTrialsClient) rateLimit() {
 }
 
 // SearchTrials searches for clinical trials based on the provided criteria
-func (c *ClinicalTrialsClient) SearchTrials(req models.SearchRequest) (*models.SearchResponse, error) {
+func (c *ClinicalTrialsClient) SearchTrials(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	if req.FillPage {
+		return c.fillPage(ctx, req)
+	}
+	return c.searchPage(ctx, req)
+}
+
+// fillPage follows upstream pages until the client-side filters have let through a full
+// page of trials, the results run out or maxFillPages pages were fetched. Every page goes
+// through the rate limiter. The response holds every trial of the fetched pages, so it
+// can exceed the page size; its next page token continues after the last page fetched.
+// If a later page fails, the trials collected so far are returned with that page's token.
+func (c *ClinicalTrialsClient) fillPage(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = c.pageSize
+	}
+
+	filled := &models.SearchResponse{Trials: []models.Trial{}}
+	filtered := false
+	pages := 0
+	for pages < c.maxFillPages {
+		resp, err := c.searchPage(ctx, req)
+		if err != nil {
+			if pages == 0 {
+				return nil, err
+			}
+			logger := upstreamLogger(ctx).Logger()
+			logger.Warn().
+				Err(err).
+				Int("pages_fetched", pages).
+				Int("trials_collected", len(filled.Trials)).
+				Msg("Fill page stopped early, returning the trials collected so far")
+			filled.NextPageToken = req.PageToken
+			filled.Partial = true
+			break
+		}
+		pages++
+		if pages == 1 {
+			filled.UpstreamTotalCount = resp.UpstreamTotalCount
+		}
+		filled.Trials = append(filled.Trials, resp.Trials...)
+		filled.NextPageToken = resp.NextPageToken
+		filtered = filtered || resp.FilteringNotice != ""
+		if len(filled.Trials) >= pageSize || resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+		req.SkipTotal = true
+	}
+
+	filled.TotalCount = len(filled.Trials)
+	filled.PageSize = len(filled.Trials)
+	if filtered && len(filled.Trials) < pageSize {
+		filled.FilteringNotice = FilteringNotice
+	}
+	logger := upstreamLogger(ctx).Logger()
+	logger.Info().
+		Int("pages_fetched", pages).
+		Int("page_size", pageSize).
+		Int("trials_collected", len(filled.Trials)).
+		Msg("Filled search page from upstream pages")
+	return filled, nil
+}
+
+// searchPage fetches one upstream page and applies the client-side filters to it
+func (c *ClinicalTrialsClient) searchPage(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	if !c.breaker.allow() {
+		logger := upstreamLogger(ctx).Logger()
+		logger.Warn().
+			Str("api", "clinicaltrials.gov").
+			Msg("Upstream circuit breaker open, failing fast")
+		return nil, ErrCircuitOpen
+	}
+
 	start := time.Now()
 	c.rateLimit()
 
-	queryParams := c.buildQueryParams(req)
-	fullURL := fmt.Sprintf("%s?%s", c.baseURL, queryParams.Encode())
+	fullURL := c.BuildSearchURL(req)
 
 	// Log outbound API call
-	baseLogger := log.With().
+	baseLogger := upstreamLogger(ctx).
 		Str("api", "clinicaltrials.gov").
 		Str("method", "GET").
 		Str("url", fullURL).
@@ -70,8 +414,12 @@ func (c *ClinicalTrialsClient) SearchTrials(req models.SearchRequest) (*models.S
 		Strs("status", req.Status).
 		Logger()
 
-	resp, err := c.httpClient.Get(fullURL)
+	resp, err := c.get(ctx, fullURL)
 	duration := time.Since(start)
+	c.recordUpstreamResult(ctx, resp, err)
+	if err == nil {
+		c.logResponseHeaders(baseLogger, resp)
+	}
 
 	if err != nil {
 		baseLogger.Error().
@@ -97,18 +445,39 @@ func (c *ClinicalTrialsClient) SearchTrials(req models.SearchRequest) (*models.S
 			Int64("duration_ms", duration.Milliseconds()).
 			Str("response_body", string(body)).
 			Msg("External API returned error status")
+		if resp.StatusCode == http.StatusBadRequest && req.PageToken != "" && strings.Contains(strings.ToLower(string(body)), "pagetoken") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPageToken, string(body))
+		}
 		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var apiResponse ClinicalTrialsGovResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
 		baseLogger.Error().
+			Err(err).
+			Int("status_code", resp.StatusCode).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("Failed to read external API response")
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var apiResponse ClinicalTrialsGovResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		withDecodeDiagnostics(baseLogger.Error(), body, err).
 			Err(err).
 			Int("status_code", resp.StatusCode).
 			Int64("duration_ms", duration.Milliseconds()).
 			Msg("Failed to decode external API response")
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	if c.strictDecode {
+		var shadow struct {
+			Studies []json.RawMessage `json:"studies"`
+		}
+		if json.Unmarshal(body, &shadow) == nil {
+			c.logUnmappedFields(baseLogger, shadow.Studies)
+		}
+	}
 
 	baseLogger.Info().
 		Int("status_code", resp.StatusCode).
@@ -120,38 +489,62 @@ func (c *ClinicalTrialsClient) SearchTrials(req models.SearchRequest) (*models.S
 	return c.convertToSearchResponse(&apiResponse, req), nil
 }
 
+// BuildSearchURL returns the fully-built upstream URL for a search without executing it
+func (c *ClinicalTrialsClient) BuildSearchURL(req models.SearchRequest) string {
+	return fmt.Sprintf("%s?%s", c.baseURL, c.buildQueryParams(req).Encode())
+}
+
 // buildQueryParams constructs query parameters for the API request
 func (c *ClinicalTrialsClient) buildQueryParams(req models.SearchRequest) url.Values {
 	params := url.Values{}
 	params.Set("format", "json")
-	params.Set("countTotal", "true")
-
-	// Build condition query (default to SCI-related if not provided)
-	if len(req.Conditions) > 0 {
-		conditions := strings.Join(req.Conditions, " OR ")
-		params.Set("query.cond", conditions)
+	// Later pages of a scan already know the total, so the upstream is spared counting it
+	params.Set("countTotal", strconv.FormatBool(!req.SkipTotal))
+
+	// Build condition query (default to SCI-related if not provided).
+	// An advanced query is passed through as-is and replaces the condition query.
+	conditions := NormalizeConditions(req.Conditions)
+	if req.AdvancedQuery != "" {
+		params.Set("query.term", req.AdvancedQuery)
+	} else if len(conditions) > 0 {
+		params.Set("query.cond", JoinConditions(conditions, req.ConditionLogic))
 	} else if req.Query != "" {
 		params.Set("query.cond", req.Query)
-	} else {
+	} else if len(req.NCTIDs) == 0 {
 		// Default SCI search terms
-		params.Set("query.cond", "spinal cord injury OR quadriplegia OR tetraplegia OR paraplegia")
+		params.Set("query.cond", DefaultConditionQuery)
+	}
+
+	// Only studies with posted results
+	if req.HasResults {
+		params.Set("aggFilters", "results:with")
+	}
+
+	// An explicit ID list returns exactly those trials, so the defaults below do not apply
+	if len(req.NCTIDs) > 0 {
+		params.Set("filter.ids", strings.Join(req.NCTIDs, ","))
 	}
 
 	// Status filter
 	if len(req.Status) > 0 {
 		statusFilter := strings.Join(req.Status, ",")
 		params.Set("filter.overallStatus", statusFilter)
-	} else {
+	} else if len(req.NCTIDs) == 0 {
 		// Default to recruiting and not yet recruiting
-		params.Set("filter.overallStatus", "RECRUITING,NOT_YET_RECRUITING")
+		params.Set("filter.overallStatus", strings.Join(RecruitingStatuses, ","))
+	}
+
+	// Only trials updated on or after the given date, for incremental polling
+	if req.UpdatedSince != "" {
+		params.Set("filter.advanced", fmt.Sprintf("AREA[LastUpdatePostDate]RANGE[%s,MAX]", req.UpdatedSince))
 	}
 
 	// Phase filter: Note - API v2 doesn't support filter.phase parameter
 	// Phase filtering is done client-side after receiving results
 
 	// Location-based search
-	if req.Latitude != 0 && req.Longitude != 0 {
-		distance := req.Distance
+	if req.HasCoordinates() {
+		distance := distanceMiles(req.Distance, req.Units)
 		if distance == 0 {
 			distance = 50 // Default 50 miles
 		}
@@ -163,7 +556,7 @@ func (c *ClinicalTrialsClient) buildQueryParams(req models.SearchRequest) url.Va
 	if req.PageSize > 0 {
 		params.Set("pageSize", fmt.Sprintf("%d", req.PageSize))
 	} else {
-		params.Set("pageSize", "100") // Default page size
+		params.Set("pageSize", strconv.Itoa(c.pageSize))
 	}
 
 	if req.PageToken != "" {
@@ -184,6 +577,9 @@ type ClinicalTrialsGovResponse struct {
 type StudyData struct {
 	ProtocolSection ProtocolSection `json:"protocolSection"`
 	DerivedSection  DerivedSection  `json:"derivedSection,omitempty"`
+	HasResults      bool            `json:"hasResults,omitempty"`
+	// ResultsSection is only checked for presence, as a fallback for studies without hasResults
+	ResultsSection json.RawMessage `json:"resultsSection,omitempty"`
 }
 
 // ProtocolSection contains the main study information
@@ -191,6 +587,7 @@ type ProtocolSection struct {
 	IdentificationModule       IdentificationModule       `json:"identificationModule"`
 	StatusModule               StatusModule               `json:"statusModule"`
 	DesignModule               DesignModule               `json:"designModule,omitempty"`
+	ArmsInterventionsModule    ArmsInterventionsModule    `json:"armsInterventionsModule,omitempty"`
 	ConditionsModule           ConditionsModule           `json:"conditionsModule,omitempty"`
 	EligibilityModule          EligibilityModule          `json:"eligibilityModule,omitempty"`
 	ContactsLocationsModule    ContactsLocationsModule    `json:"contactsLocationsModule,omitempty"`
@@ -200,16 +597,26 @@ type ProtocolSection struct {
 
 // IdentificationModule contains identification information
 type IdentificationModule struct {
-	NCTID         string `json:"nctId"`
-	BriefTitle    string `json:"briefTitle,omitempty"`
-	OfficialTitle string `json:"officialTitle,omitempty"`
+	NCTID            string            `json:"nctId"`
+	BriefTitle       string            `json:"briefTitle,omitempty"`
+	OfficialTitle    string            `json:"officialTitle,omitempty"`
+	SecondaryIDInfos []SecondaryIDInfo `json:"secondaryIdInfos,omitempty"`
+}
+
+// SecondaryIDInfo represents a secondary identifier such as a EudraCT number or sponsor protocol ID
+type SecondaryIDInfo struct {
+	ID     string `json:"id,omitempty"`
+	Type   string `json:"type,omitempty"` // e.g. EUDRACT_NUMBER, NIH, OTHER_GRANT, REGISTRY, OTHER
+	Domain string `json:"domain,omitempty"`
 }
 
 // StatusModule contains status information
 type StatusModule struct {
-	OverallStatus        string               `json:"overallStatus,omitempty"`
-	StartDateStruct      StartDateStruct      `json:"startDateStruct,omitempty"`
-	CompletionDateStruct CompletionDateStruct `json:"completionDateStruct,omitempty"`
+	OverallStatus        string                   `json:"overallStatus,omitempty"`
+	StartDateStruct      StartDateStruct          `json:"startDateStruct,omitempty"`
+	CompletionDateStruct CompletionDateStruct     `json:"completionDateStruct,omitempty"`
+	WhyStopped           string                   `json:"whyStopped,omitempty"`
+	LastUpdatePostDate   LastUpdatePostDateStruct `json:"lastUpdatePostDateStruct,omitempty"`
 }
 
 // StartDateStruct contains start date information
@@ -222,9 +629,48 @@ type CompletionDateStruct struct {
 	Date string `json:"date,omitempty"`
 }
 
+// LastUpdatePostDateStruct contains the date the latest update was posted
+type LastUpdatePostDateStruct struct {
+	Date string `json:"date,omitempty"`
+}
+
 // DesignModule contains design and phase information
 type DesignModule struct {
-	Phases []string `json:"phases,omitempty"`
+	StudyType      string         `json:"studyType,omitempty"` // e.g. INTERVENTIONAL, OBSERVATIONAL
+	Phases         []string       `json:"phases,omitempty"`
+	DesignInfo     DesignInfo     `json:"designInfo,omitempty"`
+	EnrollmentInfo EnrollmentInfo `json:"enrollmentInfo,omitempty"`
+}
+
+// EnrollmentInfo contains the planned or actual number of participants
+type EnrollmentInfo struct {
+	Count int    `json:"count,omitempty"`
+	Type  string `json:"type,omitempty"` // ESTIMATED or ACTUAL
+}
+
+// DesignInfo contains the study design details
+type DesignInfo struct {
+	Allocation        string      `json:"allocation,omitempty"`        // e.g. RANDOMIZED, NON_RANDOMIZED, NA
+	InterventionModel string      `json:"interventionModel,omitempty"` // e.g. PARALLEL, CROSSOVER, SINGLE_GROUP
+	PrimaryPurpose    string      `json:"primaryPurpose,omitempty"`    // e.g. TREATMENT, PREVENTION
+	MaskingInfo       MaskingInfo `json:"maskingInfo,omitempty"`
+}
+
+// MaskingInfo contains blinding information
+type MaskingInfo struct {
+	Masking string `json:"masking,omitempty"` // e.g. NONE, SINGLE, DOUBLE, TRIPLE, QUADRUPLE
+}
+
+// ArmsInterventionsModule contains the arms of the study
+type ArmsInterventionsModule struct {
+	ArmGroups []ArmGroup `json:"armGroups,omitempty"`
+}
+
+// ArmGroup represents one arm of a study
+type ArmGroup struct {
+	Label       string `json:"label,omitempty"`
+	Type        string `json:"type,omitempty"` // e.g. EXPERIMENTAL, ACTIVE_COMPARATOR, PLACEBO_COMPARATOR
+	Description string `json:"description,omitempty"`
 }
 
 // ConditionsModule contains condition information
@@ -264,8 +710,9 @@ func (e *EligibilityModule) getHealthyVolunteersString() string {
 
 // ContactsLocationsModule contains contacts and locations
 type ContactsLocationsModule struct {
-	Contacts  Contacts       `json:"contacts,omitempty"`
-	Locations []LocationData `json:"locations,omitempty"`
+	Contacts         Contacts          `json:"contacts,omitempty"`
+	OverallOfficials []OverallOfficial `json:"overallOfficials,omitempty"`
+	Locations        []LocationData    `json:"locations,omitempty"`
 }
 
 // Contacts contains contact information
@@ -276,10 +723,18 @@ type Contacts struct {
 // CentralContact represents a central contact
 type CentralContact struct {
 	Name  string `json:"name,omitempty"`
+	Role  string `json:"role,omitempty"`
 	Phone string `json:"phone,omitempty"`
 	Email string `json:"email,omitempty"`
 }
 
+// OverallOfficial represents an investigator responsible for the study as a whole
+type OverallOfficial struct {
+	Name        string `json:"name,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+	Role        string `json:"role,omitempty"`
+}
+
 // LocationData represents a location in the API
 type LocationData struct {
 	Facility string   `json:"facility,omitempty"` // Can be string or object
@@ -314,7 +769,16 @@ type MiscInfoModule struct {
 
 // SponsorCollaboratorsModule contains sponsor information
 type SponsorCollaboratorsModule struct {
-	LeadSponsor LeadSponsor `json:"leadSponsor,omitempty"`
+	LeadSponsor      LeadSponsor      `json:"leadSponsor,omitempty"`
+	ResponsibleParty ResponsibleParty `json:"responsibleParty,omitempty"`
+}
+
+// ResponsibleParty identifies who is accountable for the study registration
+type ResponsibleParty struct {
+	Type                    string `json:"type,omitempty"` // SPONSOR, PRINCIPAL_INVESTIGATOR or SPONSOR_INVESTIGATOR
+	InvestigatorFullName    string `json:"investigatorFullName,omitempty"`
+	InvestigatorTitle       string `json:"investigatorTitle,omitempty"`
+	InvestigatorAffiliation string `json:"investigatorAffiliation,omitempty"`
 }
 
 // LeadSponsor represents the lead sponsor
@@ -327,10 +791,22 @@ type LeadSponsor struct {
 func (c *ClinicalTrialsClient) convertToSearchResponse(apiResp *ClinicalTrialsGovResponse, req models.SearchRequest) *models.SearchResponse {
 	trials := make([]models.Trial, 0, len(apiResp.Studies))
 	originalCount := len(apiResp.Studies)
+	minAge, maxAge := requestedAgeRange(req)
+	exactTerms := exactConditionTerms(req)
 
 	for _, study := range apiResp.Studies {
 		trial := c.convertStudyToTrial(study)
 
+		// Drop inactive trials unless the request opted in
+		if excludesInactive(trial.Status, req) {
+			continue
+		}
+
+		// The upstream condition search also returns related trials; match=exact drops them
+		if exactTerms != nil && !matchesConditionsExactly(trial.Conditions, exactTerms, req.ConditionLogic) {
+			continue
+		}
+
 		// Apply client-side phase filtering if requested
 		if len(req.Phase) > 0 {
 			if !c.matchesPhaseFilter(trial.Phase, req.Phase) {
@@ -339,23 +815,71 @@ func (c *ClinicalTrialsClient) convertToSearchResponse(apiResp *ClinicalTrialsGo
 		}
 
 		// Apply client-side age filtering if requested
-		if req.MinimumAge != "" || req.MaximumAge != "" {
-			if !c.matchesAgeFilter(trial.Eligibility.MinimumAge, trial.Eligibility.MaximumAge, req.MinimumAge, req.MaximumAge) {
+		if minAge != "" || maxAge != "" {
+			if !c.matchesAgeFilter(trial.Eligibility.MinimumAge, trial.Eligibility.MaximumAge, minAge, maxAge) {
 				continue // Skip this trial if it doesn't match age filter
 			}
 		}
 
+		// Apply client-side country filtering if requested
+		if req.Country != "" {
+			if !c.matchesCountryFilter(trial.Locations, req.Country) {
+				continue // Skip this trial if it has no location in the requested country
+			}
+			if req.PruneLocations {
+				trial.Locations = filterLocationsByCountry(trial.Locations, req.Country)
+			}
+		}
+
+		// The upstream already filters on the update date; this guards registries or mirrors that do not
+		if req.UpdatedSince != "" && trial.LastUpdateDate != "" && trial.LastUpdateDate < req.UpdatedSince {
+			continue
+		}
+
+		// Apply client-side start and completion date filtering if requested
+		if !matchesDateRanges(trial, req) {
+			continue
+		}
+
+		// Apply client-side contact filtering if requested
+		if req.HasContact && !hasContact(trial.Contacts, req.ContactType) {
+			continue
+		}
+
+		// The upstream already filters on posted results; this guards mirrors that do not
+		if req.HasResults && !trial.HasResults {
+			continue
+		}
+
+		// Apply client-side funder filtering on the lead sponsor class if requested
+		if len(req.FunderType) > 0 && !matchesFunderType(trial.Sponsor.Type, req.FunderType) {
+			continue
+		}
+
+		// Reduce locations to the nearest site for geo searches if requested
+		if req.NearestOnly && req.HasCoordinates() {
+			if nearest, ok := nearestLocation(trial.Locations, req.Latitude, req.Longitude); ok {
+				trial.Locations = []models.Location{nearest}
+			}
+		}
+
 		trials = append(trials, trial)
 	}
 
 	// Track filtering for logging
 	phaseFiltered := len(req.Phase) > 0
-	ageFiltered := req.MinimumAge != "" || req.MaximumAge != ""
+	ageFiltered := minAge != "" || maxAge != ""
+	countryFiltered := req.Country != ""
+	contactFiltered := req.HasContact
+	funderFiltered := len(req.FunderType) > 0
+	dateFiltered := hasDateRange(req)
+	matchFiltered := exactTerms != nil
 	filteredCount := len(trials)
+	logger := logging.Logger(logging.ComponentAPI)
 
 	// Log if client-side phase filtering was applied
 	if phaseFiltered && filteredCount != originalCount {
-		log.Info().
+		logger.Info().
 			Strs("requested_phases", req.Phase).
 			Int("original_count", originalCount).
 			Int("filtered_count", filteredCount).
@@ -364,20 +888,90 @@ func (c *ClinicalTrialsClient) convertToSearchResponse(apiResp *ClinicalTrialsGo
 
 	// Log if client-side age filtering was applied
 	if ageFiltered && filteredCount != originalCount {
-		log.Info().
-			Str("requested_min_age", req.MinimumAge).
-			Str("requested_max_age", req.MaximumAge).
+		logger.Info().
+			Str("requested_min_age", minAge).
+			Str("requested_max_age", maxAge).
 			Int("original_count", originalCount).
 			Int("filtered_count", filteredCount).
 			Msg("Applied client-side age filtering")
 	}
 
-	return &models.SearchResponse{
+	// Log if client-side country filtering was applied
+	if countryFiltered && filteredCount != originalCount {
+		logger.Info().
+			Str("requested_country", req.Country).
+			Bool("prune_locations", req.PruneLocations).
+			Int("original_count", originalCount).
+			Int("filtered_count", filteredCount).
+			Msg("Applied client-side country filtering")
+	}
+
+	// Log if client-side contact filtering was applied
+	if contactFiltered && filteredCount != originalCount {
+		logger.Info().
+			Str("contact_type", req.ContactType).
+			Int("original_count", originalCount).
+			Int("filtered_count", filteredCount).
+			Msg("Applied client-side contact filtering")
+	}
+
+	// Log if client-side funder filtering was applied
+	if funderFiltered && filteredCount != originalCount {
+		logger.Info().
+			Strs("funder_type", req.FunderType).
+			Int("original_count", originalCount).
+			Int("filtered_count", filteredCount).
+			Msg("Applied client-side funder filtering")
+	}
+
+	// Log if client-side date range filtering was applied
+	if dateFiltered && filteredCount != originalCount {
+		logger.Info().
+			Str("start_date_from", req.StartDateFrom).
+			Str("start_date_to", req.StartDateTo).
+			Str("completion_date_from", req.CompletionDateFrom).
+			Str("completion_date_to", req.CompletionDateTo).
+			Int("original_count", originalCount).
+			Int("filtered_count", filteredCount).
+			Msg("Applied client-side date range filtering")
+	}
+
+	// Log if exact condition matching was applied
+	if matchFiltered && filteredCount != originalCount {
+		logger.Info().
+			Strs("exact_conditions", exactTerms).
+			Int("original_count", originalCount).
+			Int("filtered_count", filteredCount).
+			Msg("Applied client-side exact condition matching")
+	}
+
+	response := &models.SearchResponse{
 		Trials:        trials,
 		TotalCount:    len(trials), // Note: This is filtered count, not API total
 		NextPageToken: apiResp.NextPageToken,
-		PageSize:      len(trials),
+		// Only set when requested with countTotal=true
+		UpstreamTotalCount: apiResp.TotalCount,
+		PageSize:           len(trials),
+	}
+	if filteredCount < originalCount {
+		response.FilteringNotice = FilteringNotice
+	}
+	return response
+}
+
+// InactiveStatuses are the statuses excluded from results unless include_inactive=true
+// or the status is explicitly requested
+var InactiveStatuses = []string{"TERMINATED", "WITHDRAWN", "SUSPENDED"}
+
+// excludesInactive reports whether a trial with the given status should be dropped.
+// Inactive statuses are excluded by default, independent of other filters, unless the request
+// sets IncludeInactive, explicitly lists the status in its status filter or asks for
+// specific trials by NCT ID.
+func excludesInactive(status string, req models.SearchRequest) bool {
+	if req.IncludeInactive || len(req.NCTIDs) > 0 || !containsPhase(InactiveStatuses, status) {
+		return false
 	}
+	return !containsPhase(req.Status, status)
 }
 
 // matchesPhaseFilter checks if a trial's phases match any of the requested phases
@@ -409,38 +1003,97 @@ func containsPhase(phases []string, phase string) bool {
 	return false
 }
 
-// parseAgeYears parses an age string and returns the numeric value in years
-// Handles formats like "18 Years", "18", "18Y", "18 Y", etc.
-// Returns 0 if parsing fails
-func parseAgeYears(ageStr string) int {
-	if ageStr == "" {
-		return 0
-	}
-
-	// Remove common words and whitespace
-	ageStr = strings.TrimSpace(ageStr)
-	ageStr = strings.ToLower(ageStr)
-	ageStr = strings.TrimSuffix(ageStr, "years")
-	ageStr = strings.TrimSuffix(ageStr, "year")
-	ageStr = strings.TrimSuffix(ageStr, "y")
-	ageStr = strings.TrimSpace(ageStr)
-
-	// Extract first numeric value
-	for i := 0; i < len(ageStr); i++ {
-		if ageStr[i] >= '0' && ageStr[i] <= '9' {
-			// Found start of number, extract it
-			numStr := ""
-			for j := i; j < len(ageStr) && ageStr[j] >= '0' && ageStr[j] <= '9'; j++ {
-				numStr += string(ageStr[j])
-			}
-			if num, err := strconv.Atoi(numStr); err == nil {
-				return num
-			}
-			break
+// matchesCountryFilter checks if a trial has at least one location in the requested country (case-insensitive)
+func (c *ClinicalTrialsClient) matchesCountryFilter(locations []models.Location, country string) bool {
+	for _, loc := range locations {
+		if strings.EqualFold(strings.TrimSpace(loc.Country), strings.TrimSpace(country)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLocationsByCountry returns only the locations in the given country (case-insensitive)
+func filterLocationsByCountry(locations []models.Location, country string) []models.Location {
+	filtered := make([]models.Location, 0, len(locations))
+	for _, loc := range locations {
+		if strings.EqualFold(strings.TrimSpace(loc.Country), strings.TrimSpace(country)) {
+			filtered = append(filtered, loc)
 		}
 	}
+	return filtered
+}
 
-	return 0
+// requestedAgeRange returns the age bounds to filter on. An exact Age sets both bounds so only
+// trials accepting a person of that age match; explicit minimum/maximum strings take precedence.
+func requestedAgeRange(req models.SearchRequest) (minAge, maxAge string) {
+	minAge, maxAge = req.MinimumAge, req.MaximumAge
+	if req.Age > 0 {
+		age := strconv.Itoa(req.Age)
+		if minAge == "" {
+			minAge = age
+		}
+		if maxAge == "" {
+			maxAge = age
+		}
+	}
+	return minAge, maxAge
+}
+
+// AppliedFilters returns the effective filters a search request runs with, substituting the
+// same defaults buildQueryParams and convertToSearchResponse apply for empty filters.
+func AppliedFilters(req models.SearchRequest) *models.AppliedFilters {
+	minAge, maxAge := requestedAgeRange(req)
+	applied := &models.AppliedFilters{
+		Conditions:      req.Conditions,
+		Status:          req.Status,
+		IncludeInactive: req.IncludeInactive || len(req.NCTIDs) > 0,
+		Phase:           req.Phase,
+		MinimumAge:      minAge,
+		MaximumAge:      maxAge,
+		Country:         req.Country,
+		UpdatedSince:    req.UpdatedSince,
+		NCTIDs:          req.NCTIDs,
+		HasResults:      req.HasResults,
+		FunderType:      req.FunderType,
+
+		StartDateFrom:      req.StartDateFrom,
+		StartDateTo:        req.StartDateTo,
+		CompletionDateFrom: req.CompletionDateFrom,
+		CompletionDateTo:   req.CompletionDateTo,
+	}
+	if exactConditionTerms(req) != nil {
+		applied.Match = MatchExact
+	}
+	switch {
+	case req.AdvancedQuery != "":
+		applied.Conditions = nil
+		applied.AdvancedQuery = req.AdvancedQuery
+	case len(req.Conditions) > 0:
+		if len(req.Conditions) > 1 {
+			applied.ConditionLogic = ConditionLogicOr
+			if strings.EqualFold(req.ConditionLogic, ConditionLogicAnd) {
+				applied.ConditionLogic = ConditionLogicAnd
+			}
+		}
+	case req.Query != "":
+		applied.Conditions = []string{req.Query}
+	case len(req.NCTIDs) > 0:
+	default:
+		applied.Conditions = []string{DefaultConditionQuery}
+		applied.ConditionsDefaulted = true
+	}
+	if len(req.Status) == 0 && len(req.NCTIDs) == 0 {
+		applied.Status = RecruitingStatuses
+		applied.StatusDefaulted = true
+	}
+	if req.HasContact {
+		applied.ContactType = ContactTypeAny
+		if req.ContactType != "" {
+			applied.ContactType = strings.ToLower(req.ContactType)
+		}
+	}
+	return applied
 }
 
 // matchesAgeFilter checks if a trial's age range matches the requested age filters
@@ -450,11 +1103,11 @@ func parseAgeYears(ageStr string) int {
 // - If both specified: trial must overlap with requested range
 // - If trial has no age data: include by default (don't exclude)
 func (c *ClinicalTrialsClient) matchesAgeFilter(trialMinAge, trialMaxAge, requestedMinAge, requestedMaxAge string) bool {
-	// Parse ages to integers
-	reqMin := parseAgeYears(requestedMinAge)
-	reqMax := parseAgeYears(requestedMaxAge)
-	trialMin := parseAgeYears(trialMinAge)
-	trialMax := parseAgeYears(trialMaxAge)
+	// Parse ages to years, honoring units such as months and weeks
+	reqMin := ageYears(requestedMinAge)
+	reqMax := ageYears(requestedMaxAge)
+	trialMin := ageYears(trialMinAge)
+	trialMax := ageYears(trialMaxAge)
 
 	// If no age filters requested, include all trials
 	if reqMin == 0 && reqMax == 0 {
@@ -514,20 +1167,61 @@ func (c *ClinicalTrialsClient) convertStudyToTrial(study StudyData) models.Trial
 		NCTID:    protocol.IdentificationModule.NCTID,
 		Title:    protocol.IdentificationModule.BriefTitle,
 		Status:   protocol.StatusModule.OverallStatus,
-		Registry: "clinicaltrials.gov",
+		Registry: RegistryClinicalTrialsGov,
 		URL:      fmt.Sprintf("https://clinicaltrials.gov/study/%s", protocol.IdentificationModule.NCTID),
 	}
 
+	// Secondary IDs
+	if protocol.IdentificationModule.SecondaryIDInfos != nil {
+		trial.SecondaryIDs = make([]models.SecondaryID, 0, len(protocol.IdentificationModule.SecondaryIDInfos))
+		for _, info := range protocol.IdentificationModule.SecondaryIDInfos {
+			if info.ID == "" {
+				continue
+			}
+			trial.SecondaryIDs = append(trial.SecondaryIDs, models.SecondaryID{
+				Type:   info.Type,
+				ID:     info.ID,
+				Domain: info.Domain,
+			})
+		}
+	}
+
 	// Phase
 	if protocol.DesignModule.Phases != nil {
 		trial.Phase = protocol.DesignModule.Phases
 	}
 
+	// Design
+	designInfo := protocol.DesignModule.DesignInfo
+	if designInfo.Allocation != "" || designInfo.InterventionModel != "" || designInfo.PrimaryPurpose != "" || designInfo.MaskingInfo.Masking != "" {
+		trial.Design = &models.Design{
+			Allocation:        designInfo.Allocation,
+			InterventionModel: designInfo.InterventionModel,
+			Masking:           designInfo.MaskingInfo.Masking,
+			PrimaryPurpose:    designInfo.PrimaryPurpose,
+		}
+	}
+	for _, arm := range protocol.ArmsInterventionsModule.ArmGroups {
+		trial.Arms = append(trial.Arms, models.Arm{
+			Label:       arm.Label,
+			Type:        arm.Type,
+			Description: arm.Description,
+		})
+	}
+
 	// Conditions
 	if protocol.ConditionsModule.Conditions != nil {
 		trial.Conditions = protocol.ConditionsModule.Conditions
 	}
 
+	// Reason a terminated, withdrawn or suspended trial stopped
+	if whyStopped := strings.TrimSpace(protocol.StatusModule.WhyStopped); whyStopped != "" {
+		trial.WhyStopped = whyStopped
+	}
+
+	// Posted results
+	trial.HasResults = study.HasResults || len(study.ResultsSection) > 0
+
 	// Dates
 	if protocol.StatusModule.StartDateStruct.Date != "" {
 		trial.StartDate = protocol.StatusModule.StartDateStruct.Date
@@ -535,13 +1229,16 @@ func (c *ClinicalTrialsClient) convertStudyToTrial(study StudyData) models.Trial
 	if protocol.StatusModule.CompletionDateStruct.Date != "" {
 		trial.CompletionDate = protocol.StatusModule.CompletionDateStruct.Date
 	}
+	trial.LastUpdateDate = protocol.StatusModule.LastUpdatePostDate.Date
 
 	// Eligibility
 	if protocol.EligibilityModule.EligibilityCriteria != "" {
 		trial.Eligibility.Criteria = protocol.EligibilityModule.EligibilityCriteria
+		trial.Eligibility.Inclusion, trial.Eligibility.Exclusion = ParseEligibilityCriteria(trial.Eligibility.Criteria)
 	}
 	trial.Eligibility.MinimumAge = protocol.EligibilityModule.MinimumAge
 	trial.Eligibility.MaximumAge = protocol.EligibilityModule.MaximumAge
+	setAgeYears(&trial.Eligibility)
 	trial.Eligibility.Gender = protocol.EligibilityModule.Gender
 
 	// Locations
@@ -570,18 +1267,26 @@ func (c *ClinicalTrialsClient) convertStudyToTrial(study StudyData) models.Trial
 		for _, contact := range protocol.ContactsLocationsModule.Contacts.CentralContacts {
 			trial.Contacts = append(trial.Contacts, models.Contact{
 				Name:  contact.Name,
+				Role:  contact.Role,
 				Phone: contact.Phone,
 				Email: contact.Email,
 			})
 		}
 	}
+	for _, official := range protocol.ContactsLocationsModule.OverallOfficials {
+		trial.OverallOfficials = append(trial.OverallOfficials, models.Official{
+			Name:        official.Name,
+			Affiliation: official.Affiliation,
+			Role:        official.Role,
+		})
+	}
 
 	// Sponsor (from protocolSection, not derivedSection)
 	if protocol.SponsorCollaboratorsModule.LeadSponsor.Name != "" {
 		trial.Sponsor = models.Sponsor{
 			Name:     protocol.SponsorCollaboratorsModule.LeadSponsor.Name,
 			Type:     protocol.SponsorCollaboratorsModule.LeadSponsor.Class,
-			Category: protocol.SponsorCollaboratorsModule.LeadSponsor.Class,
+			Category: FunderTypeLabel(protocol.SponsorCollaboratorsModule.LeadSponsor.Class),
 		}
 	}
 
@@ -593,11 +1298,77 @@ func (c *ClinicalTrialsClient) convertStudyToTrial(study StudyData) models.Trial
 		trial.DetailedSummary = protocol.DescriptionModule.DetailedDescription
 	}
 
+	// Useful fields not worth a typed field
+	for _, field := range additionalDataFields {
+		if value := field.value(protocol); value != nil {
+			if trial.AdditionalData == nil {
+				trial.AdditionalData = make(map[string]interface{})
+			}
+			trial.AdditionalData[field.key] = value
+		}
+	}
+
 	return trial
 }
 
+// additionalDataFields lists the upstream fields carried in Trial.AdditionalData instead of
+// the typed model. Fields whose value is nil are left out.
+var additionalDataFields = []struct {
+	key   string
+	value func(ProtocolSection) interface{}
+}{
+	{"study_type", func(p ProtocolSection) interface{} { return optionalString(p.DesignModule.StudyType) }},
+	{"enrollment", func(p ProtocolSection) interface{} {
+		enrollment := p.DesignModule.EnrollmentInfo
+		if enrollment.Count == 0 {
+			return nil
+		}
+		return map[string]interface{}{"count": enrollment.Count, "type": enrollment.Type}
+	}},
+	{"responsible_party", func(p ProtocolSection) interface{} {
+		party := p.SponsorCollaboratorsModule.ResponsibleParty
+		values := map[string]interface{}{}
+		for key, value := range map[string]string{
+			"type":                     party.Type,
+			"investigator_name":        party.InvestigatorFullName,
+			"investigator_title":       party.InvestigatorTitle,
+			"investigator_affiliation": party.InvestigatorAffiliation,
+		} {
+			if value != "" {
+				values[key] = value
+			}
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return values
+	}},
+}
+
+// optionalString returns s, or nil when it is empty
+func optionalString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // GetTrialDetails retrieves detailed information for a specific trial by NCT ID
-func (c *ClinicalTrialsClient) GetTrialDetails(nctID string) (*models.Trial, error) {
+func (c *ClinicalTrialsClient) GetTrialDetails(ctx context.Context, nctID string) (*models.Trial, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	if !c.breaker.allow() {
+		logger := upstreamLogger(ctx).Logger()
+		logger.Warn().
+			Str("api", "clinicaltrials.gov").
+			Str("nct_id", nctID).
+			Msg("Upstream circuit breaker open, failing fast")
+		return nil, ErrCircuitOpen
+	}
+
 	start := time.Now()
 	c.rateLimit()
 
@@ -607,15 +1378,19 @@ func (c *ClinicalTrialsClient) GetTrialDetails(nctID string) (*models.Trial, err
 	fullURL = fmt.Sprintf("%s?%s", fullURL, params.Encode())
 
 	// Log outbound API call
-	baseLogger := log.With().
+	baseLogger := upstreamLogger(ctx).
 		Str("api", "clinicaltrials.gov").
 		Str("method", "GET").
 		Str("nct_id", nctID).
 		Str("url", fullURL).
 		Logger()
 
-	resp, err := c.httpClient.Get(fullURL)
+	resp, err := c.get(ctx, fullURL)
 	duration := time.Since(start)
+	c.recordUpstreamResult(ctx, resp, err)
+	if err == nil {
+		c.logResponseHeaders(baseLogger, resp)
+	}
 
 	if err != nil {
 		baseLogger.Error().
@@ -643,15 +1418,26 @@ func (c *ClinicalTrialsClient) GetTrialDetails(nctID string) (*models.Trial, err
 	}
 
 	// Single trial endpoint returns the study directly, not wrapped in a response structure
-	var studyData StudyData
-	if err := json.NewDecoder(resp.Body).Decode(&studyData); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
 		baseLogger.Error().
+			Err(err).
+			Int("status_code", resp.StatusCode).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("Failed to read external API response")
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var studyData StudyData
+	if err := json.Unmarshal(body, &studyData); err != nil {
+		withDecodeDiagnostics(baseLogger.Error(), body, err).
 			Err(err).
 			Int("status_code", resp.StatusCode).
 			Int64("duration_ms", duration.Milliseconds()).
 			Msg("Failed to decode external API response")
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	c.logUnmappedFields(baseLogger, []json.RawMessage{body})
 
 	baseLogger.Info().
 		Int("status_code", resp.StatusCode).
@@ -659,5 +1445,8 @@ func (c *ClinicalTrialsClient) GetTrialDetails(nctID string) (*models.Trial, err
 		Msg("External API call completed")
 
 	trial := c.convertStudyToTrial(studyData)
+	if len(body) <= MaxRawStudyBytes {
+		trial.Raw = json.RawMessage(body)
+	}
 	return &trial, nil
 }
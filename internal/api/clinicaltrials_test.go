@@ -1,7 +1,16 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -103,5 +112,929 @@ func TestBuildQueryParamsDefaultSCI(t *testing.T) {
 	}
 }
 
+func TestCountryFilter(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	apiResp := &ClinicalTrialsGovResponse{
+		Studies: []StudyData{
+			studyWithCountries("NCT00000001", "United States"),
+			studyWithCountries("NCT00000002", "Brazil"),
+			studyWithCountries("NCT00000003", "Brazil", "United States", "Canada"),
+			studyWithCountries("NCT00000004"),
+		},
+	}
+
+	tests := []struct {
+		name      string
+		country   string
+		prune     bool
+		wantIDs   []string
+		wantSites map[string]int
+	}{
+		{
+			name:      "matching country is case-insensitive",
+			country:   "united states",
+			wantIDs:   []string{"NCT00000001", "NCT00000003"},
+			wantSites: map[string]int{"NCT00000001": 1, "NCT00000003": 3},
+		},
+		{
+			name:    "non-matching country excludes all trials",
+			country: "Germany",
+			wantIDs: []string{},
+		},
+		{
+			name:      "multi-country trial is pruned to requested country",
+			country:   "Brazil",
+			prune:     true,
+			wantIDs:   []string{"NCT00000002", "NCT00000003"},
+			wantSites: map[string]int{"NCT00000002": 1, "NCT00000003": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, models.SearchRequest{Country: tt.country, PruneLocations: tt.prune})
+
+			if len(resp.Trials) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d trials, got %d", len(tt.wantIDs), len(resp.Trials))
+			}
+			for i, trial := range resp.Trials {
+				if trial.NCTID != tt.wantIDs[i] {
+					t.Errorf("Expected trial %s at index %d, got %s", tt.wantIDs[i], i, trial.NCTID)
+				}
+				if want, ok := tt.wantSites[trial.NCTID]; ok && len(trial.Locations) != want {
+					t.Errorf("Expected %d locations for %s, got %d", want, trial.NCTID, len(trial.Locations))
+				}
+				if tt.prune {
+					for _, loc := range trial.Locations {
+						if !strings.EqualFold(loc.Country, tt.country) {
+							t.Errorf("Expected pruned locations in %s, got %s", tt.country, loc.Country)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// studyWithCountries builds a minimal study with one location per country
+func studyWithCountries(nctID string, countries ...string) StudyData {
+	study := StudyData{}
+	study.ProtocolSection.IdentificationModule.NCTID = nctID
+	for _, country := range countries {
+		study.ProtocolSection.ContactsLocationsModule.Locations = append(
+			study.ProtocolSection.ContactsLocationsModule.Locations,
+			LocationData{City: "City in " + country, Country: country},
+		)
+	}
+	return study
+}
+
+func TestSecondaryIDDecoding(t *testing.T) {
+	payload := `{
+		"protocolSection": {
+			"identificationModule": {
+				"nctId": "NCT04567890",
+				"briefTitle": "Epidural stimulation after SCI",
+				"secondaryIdInfos": [
+					{"id": "2020-001234-56", "type": "EUDRACT_NUMBER"},
+					{"id": "ESTIM-SCI-01"},
+					{"id": "R01NS012345", "type": "NIH", "link": "https://reporter.nih.gov/quickSearch/R01NS012345"},
+					{"id": "U1111-1234-5678", "type": "REGISTRY", "domain": "WHO UTN"}
+				]
+			}
+		}
+	}`
+
+	var study StudyData
+	if err := json.Unmarshal([]byte(payload), &study); err != nil {
+		t.Fatalf("Failed to decode study: %v", err)
+	}
+	trial := NewClinicalTrialsClient().convertStudyToTrial(study)
+
+	expected := []models.SecondaryID{
+		{Type: "EUDRACT_NUMBER", ID: "2020-001234-56"},
+		{ID: "ESTIM-SCI-01"},
+		{Type: "NIH", ID: "R01NS012345"},
+		{Type: "REGISTRY", ID: "U1111-1234-5678", Domain: "WHO UTN"},
+	}
+	if !reflect.DeepEqual(trial.SecondaryIDs, expected) {
+		t.Errorf("Unexpected secondary IDs:\n got: %+v\nwant: %+v", trial.SecondaryIDs, expected)
+	}
+
+	// Only registry-style IDs are used to link cross-registered trials
+	ids := trialIdentifiers(trial)
+	wantIDs := []string{"NCT04567890", "2020-001234-56", "U1111-1234-5678"}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Errorf("Expected identifiers %v, got %v", wantIDs, ids)
+	}
+}
+
+func TestDesignDecoding(t *testing.T) {
+	payload := `{
+		"protocolSection": {
+			"identificationModule": {"nctId": "NCT05000001"},
+			"designModule": {
+				"studyType": "INTERVENTIONAL",
+				"phases": ["PHASE3"],
+				"designInfo": {
+					"allocation": "RANDOMIZED",
+					"interventionModel": "PARALLEL",
+					"primaryPurpose": "TREATMENT",
+					"maskingInfo": {"masking": "DOUBLE", "whoMasked": ["PARTICIPANT", "INVESTIGATOR"]}
+				}
+			}
+		}
+	}`
+
+	var study StudyData
+	if err := json.Unmarshal([]byte(payload), &study); err != nil {
+		t.Fatalf("Failed to decode study: %v", err)
+	}
+	client := NewClinicalTrialsClient()
+	trial := client.convertStudyToTrial(study)
+
+	expected := &models.Design{
+		Allocation:        "RANDOMIZED",
+		InterventionModel: "PARALLEL",
+		Masking:           "DOUBLE",
+		PrimaryPurpose:    "TREATMENT",
+	}
+	if !reflect.DeepEqual(trial.Design, expected) {
+		t.Errorf("Unexpected design:\n got: %+v\nwant: %+v", trial.Design, expected)
+	}
+
+	// Studies without design info omit the field entirely
+	var bare StudyData
+	bare.ProtocolSection.IdentificationModule.NCTID = "NCT05000002"
+	out, err := json.Marshal(client.convertStudyToTrial(bare))
+	if err != nil {
+		t.Fatalf("Failed to encode trial: %v", err)
+	}
+	if strings.Contains(string(out), `"design"`) {
+		t.Errorf("Expected design to be omitted, got %s", out)
+	}
+}
+
+func TestAdditionalData(t *testing.T) {
+	payload := `{
+		"protocolSection": {
+			"identificationModule": {"nctId": "NCT05000003"},
+			"statusModule": {"overallStatus": "TERMINATED", "whyStopped": "Slow enrollment"},
+			"designModule": {"studyType": "INTERVENTIONAL", "enrollmentInfo": {"count": 12, "type": "ACTUAL"}},
+			"sponsorCollaboratorsModule": {
+				"leadSponsor": {"name": "University Hospital", "class": "OTHER"},
+				"responsibleParty": {"type": "PRINCIPAL_INVESTIGATOR", "investigatorFullName": "Ana Souza", "investigatorAffiliation": "University Hospital"}
+			}
+		}
+	}`
+
+	var study StudyData
+	if err := json.Unmarshal([]byte(payload), &study); err != nil {
+		t.Fatalf("Failed to decode study: %v", err)
+	}
+	client := NewClinicalTrialsClient()
+	trial := client.convertStudyToTrial(study)
+
+	expected := map[string]interface{}{
+		"study_type": "INTERVENTIONAL",
+		"enrollment": map[string]interface{}{"count": 12, "type": "ACTUAL"},
+		"responsible_party": map[string]interface{}{
+			"type":                     "PRINCIPAL_INVESTIGATOR",
+			"investigator_name":        "Ana Souza",
+			"investigator_affiliation": "University Hospital",
+		},
+	}
+	if !reflect.DeepEqual(trial.AdditionalData, expected) {
+		t.Errorf("Unexpected additional data:\n got: %v\nwant: %v", trial.AdditionalData, expected)
+	}
+
+	// Studies without any of the fields omit additional_data entirely
+	var bare StudyData
+	bare.ProtocolSection.IdentificationModule.NCTID = "NCT05000004"
+	out, err := json.Marshal(client.convertStudyToTrial(bare))
+	if err != nil {
+		t.Fatalf("Failed to encode trial: %v", err)
+	}
+	if strings.Contains(string(out), `"additional_data"`) {
+		t.Errorf("Expected additional_data to be omitted, got %s", out)
+	}
+}
+
+func TestWhyStopped(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{
+			name:    "terminated with reason",
+			payload: `{"protocolSection":{"identificationModule":{"nctId":"NCT05000005"},"statusModule":{"overallStatus":"TERMINATED","whyStopped":"Sponsor decision "}}}`,
+			want:    "Sponsor decision",
+		},
+		{
+			name:    "terminated without reason",
+			payload: `{"protocolSection":{"identificationModule":{"nctId":"NCT05000006"},"statusModule":{"overallStatus":"TERMINATED"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var study StudyData
+			if err := json.Unmarshal([]byte(tt.payload), &study); err != nil {
+				t.Fatalf("Failed to decode study: %v", err)
+			}
+			trial := client.convertStudyToTrial(study)
+			if trial.WhyStopped != tt.want {
+				t.Errorf("Expected why_stopped %q, got %q", tt.want, trial.WhyStopped)
+			}
+			out, err := json.Marshal(trial)
+			if err != nil {
+				t.Fatalf("Failed to encode trial: %v", err)
+			}
+			if got := strings.Contains(string(out), `"why_stopped"`); got != (tt.want != "") {
+				t.Errorf("Expected why_stopped present=%v, got %s", tt.want != "", out)
+			}
+		})
+	}
+}
+
+func TestContactRolesAndOfficials(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	payload := `{"protocolSection":{"identificationModule":{"nctId":"NCT05000007"},"contactsLocationsModule":{
+		"contacts":{"centralContacts":[
+			{"name":"Ana Souza","role":"CONTACT","phone":"555-0100","email":"ana@example.org"},
+			{"name":"Backup Desk","role":"CONTACT","phone":"555-0101"}]},
+		"overallOfficials":[
+			{"name":"Dr. Lee","affiliation":"Mock University","role":"PRINCIPAL_INVESTIGATOR"},
+			{"name":"Dr. Kim","affiliation":"Mock Hospital","role":"STUDY_DIRECTOR"}]}}}`
+
+	var study StudyData
+	if err := json.Unmarshal([]byte(payload), &study); err != nil {
+		t.Fatalf("Failed to decode study: %v", err)
+	}
+	trial := client.convertStudyToTrial(study)
+
+	wantContacts := []models.Contact{
+		{Name: "Ana Souza", Role: "CONTACT", Phone: "555-0100", Email: "ana@example.org"},
+		{Name: "Backup Desk", Role: "CONTACT", Phone: "555-0101"},
+	}
+	if !reflect.DeepEqual(trial.Contacts, wantContacts) {
+		t.Errorf("Expected contacts %+v, got %+v", wantContacts, trial.Contacts)
+	}
+	wantOfficials := []models.Official{
+		{Name: "Dr. Lee", Affiliation: "Mock University", Role: "PRINCIPAL_INVESTIGATOR"},
+		{Name: "Dr. Kim", Affiliation: "Mock Hospital", Role: "STUDY_DIRECTOR"},
+	}
+	if !reflect.DeepEqual(trial.OverallOfficials, wantOfficials) {
+		t.Errorf("Expected officials %+v, got %+v", wantOfficials, trial.OverallOfficials)
+	}
+
+	// Studies without officials or roles omit the fields
+	bare := client.convertStudyToTrial(StudyData{ProtocolSection: ProtocolSection{
+		ContactsLocationsModule: ContactsLocationsModule{Contacts: Contacts{CentralContacts: []CentralContact{{Name: "X"}}}},
+	}})
+	out, err := json.Marshal(bare)
+	if err != nil {
+		t.Fatalf("Failed to encode trial: %v", err)
+	}
+	if strings.Contains(string(out), `"overall_officials"`) || strings.Contains(string(out), `"role"`) {
+		t.Errorf("Expected overall_officials and role omitted, got %s", out)
+	}
+}
+
+func TestArmGroups(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	payload := `{"protocolSection":{"identificationModule":{"nctId":"NCT05000008"},
+		"designModule":{"designInfo":{"allocation":"RANDOMIZED","interventionModel":"PARALLEL"}},
+		"armsInterventionsModule":{"armGroups":[
+			{"label":"Stimulation","type":"EXPERIMENTAL","description":"Spinal stimulation plus rehabilitation","interventionNames":["Device: Stimulator"]},
+			{"label":"Sham","type":"SHAM_COMPARATOR","description":"Sham stimulation plus rehabilitation"},
+			{"label":"Rehabilitation only","type":"ACTIVE_COMPARATOR"}]}}}`
+
+	var study StudyData
+	if err := json.Unmarshal([]byte(payload), &study); err != nil {
+		t.Fatalf("Failed to decode study: %v", err)
+	}
+	trial := client.convertStudyToTrial(study)
+
+	want := []models.Arm{
+		{Label: "Stimulation", Type: "EXPERIMENTAL", Description: "Spinal stimulation plus rehabilitation"},
+		{Label: "Sham", Type: "SHAM_COMPARATOR", Description: "Sham stimulation plus rehabilitation"},
+		{Label: "Rehabilitation only", Type: "ACTIVE_COMPARATOR"},
+	}
+	if !reflect.DeepEqual(trial.Arms, want) {
+		t.Errorf("Expected arms %+v, got %+v", want, trial.Arms)
+	}
+
+	// Studies without arm groups omit the field
+	out, err := json.Marshal(client.convertStudyToTrial(StudyData{}))
+	if err != nil {
+		t.Fatalf("Failed to encode trial: %v", err)
+	}
+	if strings.Contains(string(out), `"arms"`) {
+		t.Errorf("Expected arms omitted, got %s", out)
+	}
+}
+
+func TestInactiveStatusExclusion(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	statuses := []string{"RECRUITING", "TERMINATED", "WITHDRAWN", "SUSPENDED", "COMPLETED"}
+	apiResp := &ClinicalTrialsGovResponse{}
+	for i, status := range statuses {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = fmt.Sprintf("NCT0000000%d", i)
+		study.ProtocolSection.StatusModule.OverallStatus = status
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	tests := []struct {
+		name string
+		req  models.SearchRequest
+		want []string
+	}{
+		{
+			name: "excluded by default",
+			req:  models.SearchRequest{Conditions: []string{"paraplegia"}},
+			want: []string{"RECRUITING", "COMPLETED"},
+		},
+		{
+			name: "excluded even with a broad explicit status filter",
+			req:  models.SearchRequest{Status: []string{"RECRUITING", "COMPLETED"}},
+			want: []string{"RECRUITING", "COMPLETED"},
+		},
+		{
+			name: "explicitly requested status is kept",
+			req:  models.SearchRequest{Status: []string{"terminated"}},
+			want: []string{"RECRUITING", "TERMINATED", "COMPLETED"},
+		},
+		{
+			name: "include_inactive keeps all",
+			req:  models.SearchRequest{IncludeInactive: true},
+			want: statuses,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, tt.req)
+			got := make([]string, 0, len(resp.Trials))
+			for _, trial := range resp.Trials {
+				got = append(got, trial.Status)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected statuses %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildQueryParamsConditionLogic(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	conditions := []string{"diabetes", "heart failure"}
+
+	tests := []struct {
+		logic    string
+		expected string
+	}{
+		{"", "diabetes OR heart failure"},
+		{ConditionLogicOr, "diabetes OR heart failure"},
+		{ConditionLogicAnd, "(diabetes) AND (heart failure)"},
+		{"AND", "(diabetes) AND (heart failure)"},
+	}
+
+	for _, tt := range tests {
+		t.Run("logic="+tt.logic, func(t *testing.T) {
+			params := client.buildQueryParams(models.SearchRequest{Conditions: conditions, ConditionLogic: tt.logic})
+			if got := params.Get("query.cond"); got != tt.expected {
+				t.Errorf("Expected query.cond %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// A single condition needs no grouping
+	params := client.buildQueryParams(models.SearchRequest{Conditions: []string{"diabetes"}, ConditionLogic: ConditionLogicAnd})
+	if got := params.Get("query.cond"); got != "diabetes" {
+		t.Errorf("Expected single condition unchanged, got %q", got)
+	}
+}
+
+func TestNormalizeConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []string
+		expected   []string
+	}{
+		{"whitespace", []string{"  heart   failure ", "diabetes\t"}, []string{"heart failure", "diabetes"}},
+		{"duplicates", []string{"diabetes", "asthma", "diabetes"}, []string{"diabetes", "asthma"}},
+		{"casing keeps the first spelling", []string{"Spinal Cord Injury", "spinal cord  injury", "SPINAL CORD INJURY"}, []string{"Spinal Cord Injury"}},
+		{"empty entries", []string{"", "   ", "asthma"}, []string{"asthma"}},
+		{"all empty", []string{" ", ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeConditions(tt.conditions); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	client := NewClinicalTrialsClient()
+	params := client.buildQueryParams(models.SearchRequest{Conditions: []string{" Diabetes ", "diabetes", "heart  failure", ""}})
+	if got := params.Get("query.cond"); got != "Diabetes OR heart failure" {
+		t.Errorf("Expected a normalized condition query, got %q", got)
+	}
+	params = client.buildQueryParams(models.SearchRequest{Conditions: []string{" "}})
+	if got := params.Get("query.cond"); got != DefaultConditionQuery {
+		t.Errorf("Expected blank conditions to fall back to the default query, got %q", got)
+	}
+}
+
+func TestAdvancedQuery(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	expr := "AREA[Phase]PHASE2 AND AREA[Condition]paraplegia"
+
+	params := client.buildQueryParams(models.SearchRequest{
+		AdvancedQuery: expr,
+		Conditions:    []string{"tetraplegia"},
+		Status:        []string{"COMPLETED"},
+	})
+	if got := params.Get("query.term"); got != expr {
+		t.Errorf("Expected query.term %q, got %q", expr, got)
+	}
+	if params.Has("query.cond") {
+		t.Errorf("Expected no query.cond with an advanced query, got %q", params.Get("query.cond"))
+	}
+	if got := params.Get("filter.overallStatus"); got != "COMPLETED" {
+		t.Errorf("Expected the status filter to still apply, got %q", got)
+	}
+
+	// Client-side phase and age filters still apply to advanced query results
+	apiResp := &ClinicalTrialsGovResponse{}
+	for _, s := range []struct{ id, phase, minAge string }{
+		{"NCT00000001", "PHASE2", "18 Years"},
+		{"NCT00000002", "PHASE3", "18 Years"},
+		{"NCT00000003", "PHASE2", "70 Years"},
+	} {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = s.id
+		study.ProtocolSection.DesignModule.Phases = []string{s.phase}
+		study.ProtocolSection.EligibilityModule.MinimumAge = s.minAge
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+	resp := client.convertToSearchResponse(apiResp, models.SearchRequest{AdvancedQuery: expr, Phase: []string{"PHASE2"}, Age: 40})
+	if len(resp.Trials) != 1 || resp.Trials[0].NCTID != "NCT00000001" {
+		t.Errorf("Expected only NCT00000001 after client-side filters, got %+v", resp.Trials)
+	}
+}
+
+func TestBuildQueryParamsNCTIDs(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	params := client.buildQueryParams(models.SearchRequest{NCTIDs: []string{"NCT00000001", "NCT00000002"}})
+	if got := params.Get("filter.ids"); got != "NCT00000001,NCT00000002" {
+		t.Errorf("Expected filter.ids NCT00000001,NCT00000002, got %q", got)
+	}
+	if params.Has("query.cond") || params.Has("filter.overallStatus") {
+		t.Errorf("Expected no default condition or status filter, got %v", params)
+	}
+
+	// Explicit filters still combine with the ID list
+	params = client.buildQueryParams(models.SearchRequest{
+		NCTIDs:     []string{"NCT00000001"},
+		Conditions: []string{"paraplegia"},
+		Status:     []string{"COMPLETED"},
+	})
+	if params.Get("query.cond") != "paraplegia" || params.Get("filter.overallStatus") != "COMPLETED" {
+		t.Errorf("Expected explicit condition and status filters, got %v", params)
+	}
+}
+
+func TestNCTIDsKeepInactiveTrials(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	apiResp := &ClinicalTrialsGovResponse{}
+	for id, status := range map[string]string{"NCT00000001": "TERMINATED", "NCT00000002": "RECRUITING"} {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = id
+		study.ProtocolSection.StatusModule.OverallStatus = status
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	resp := client.convertToSearchResponse(apiResp, models.SearchRequest{NCTIDs: []string{"NCT00000001", "NCT00000002"}})
+	if len(resp.Trials) != 2 {
+		t.Errorf("Expected an explicitly requested terminated trial to be returned, got %d trials", len(resp.Trials))
+	}
+	if applied := AppliedFilters(models.SearchRequest{NCTIDs: []string{"NCT00000001"}}); !applied.IncludeInactive {
+		t.Error("Expected applied filters to report inactive trials included")
+	}
+
+	// Without an ID list the terminated trial is still dropped
+	if resp := client.convertToSearchResponse(apiResp, models.SearchRequest{}); len(resp.Trials) != 1 {
+		t.Errorf("Expected the terminated trial dropped by default, got %d trials", len(resp.Trials))
+	}
+}
+
+func TestContactFilter(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	contacts := map[string][]CentralContact{
+		"NCT00000001": {{Name: "A", Email: "a@example.org", Phone: "555-0100"}},
+		"NCT00000002": {{Name: "B", Email: "b@example.org"}},
+		"NCT00000003": {{Name: "C"}, {Name: "D", Phone: "555-0101"}},
+		"NCT00000004": {{Name: "No way to reach", Email: " "}},
+		"NCT00000005": nil,
+	}
+	apiResp := &ClinicalTrialsGovResponse{}
+	for _, id := range []string{"NCT00000001", "NCT00000002", "NCT00000003", "NCT00000004", "NCT00000005"} {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = id
+		study.ProtocolSection.ContactsLocationsModule.Contacts.CentralContacts = contacts[id]
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	tests := []struct {
+		name string
+		req  models.SearchRequest
+		want []string
+	}{
+		{"no filter", models.SearchRequest{}, []string{"NCT00000001", "NCT00000002", "NCT00000003", "NCT00000004", "NCT00000005"}},
+		{"any", models.SearchRequest{HasContact: true}, []string{"NCT00000001", "NCT00000002", "NCT00000003"}},
+		{"email", models.SearchRequest{HasContact: true, ContactType: ContactTypeEmail}, []string{"NCT00000001", "NCT00000002"}},
+		{"phone", models.SearchRequest{HasContact: true, ContactType: "PHONE"}, []string{"NCT00000001", "NCT00000003"}},
+		{"type without has_contact", models.SearchRequest{ContactType: ContactTypeEmail}, []string{"NCT00000001", "NCT00000002", "NCT00000003", "NCT00000004", "NCT00000005"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, tt.req)
+			got := make([]string, 0, len(resp.Trials))
+			for _, trial := range resp.Trials {
+				got = append(got, trial.NCTID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected trials %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExactConditionMatch(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	conditions := map[string][]string{
+		"NCT00000001": {"Spinal Cord Injury"},
+		"NCT00000002": {"Spinal Cord Injuries, Chronic", "Neuropathic Pain"},
+		"NCT00000003": {"Tetraplegia", "neuropathic pain"},
+		"NCT00000004": {"Stroke"},
+	}
+	apiResp := &ClinicalTrialsGovResponse{}
+	for _, id := range []string{"NCT00000001", "NCT00000002", "NCT00000003", "NCT00000004"} {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = id
+		study.ProtocolSection.ConditionsModule.Conditions = conditions[id]
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	tests := []struct {
+		name string
+		req  models.SearchRequest
+		want []string
+	}{
+		{"partial keeps upstream results", models.SearchRequest{Conditions: []string{"spinal cord injury"}}, []string{"NCT00000001", "NCT00000002", "NCT00000003", "NCT00000004"}},
+		{"exact", models.SearchRequest{Conditions: []string{"spinal cord injury"}, Match: MatchExact}, []string{"NCT00000001"}},
+		{"exact any condition", models.SearchRequest{Conditions: []string{"Neuropathic Pain", "stroke"}, Match: "EXACT"}, []string{"NCT00000002", "NCT00000003", "NCT00000004"}},
+		{"exact all conditions", models.SearchRequest{Conditions: []string{"tetraplegia", "neuropathic pain"}, ConditionLogic: ConditionLogicAnd, Match: MatchExact}, []string{"NCT00000003"}},
+		{"exact default terms", models.SearchRequest{Match: MatchExact}, []string{"NCT00000001", "NCT00000003"}},
+		{"exact ignored for nct_ids", models.SearchRequest{NCTIDs: []string{"NCT00000004"}, Match: MatchExact}, []string{"NCT00000001", "NCT00000002", "NCT00000003", "NCT00000004"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, tt.req)
+			got := make([]string, 0, len(resp.Trials))
+			for _, trial := range resp.Trials {
+				got = append(got, trial.NCTID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected trials %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHasResults(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	// Studies flag posted results with hasResults; older payloads only carry the resultsSection
+	body := `{"studies":[
+		{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}},"hasResults":true},
+		{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"}},"resultsSection":{"participantFlowModule":{}}},
+		{"protocolSection":{"identificationModule":{"nctId":"NCT00000003"}},"hasResults":false}
+	]}`
+	var apiResp ClinicalTrialsGovResponse
+	if err := json.Unmarshal([]byte(body), &apiResp); err != nil {
+		t.Fatalf("Failed to decode studies: %v", err)
+	}
+
+	resp := client.convertToSearchResponse(&apiResp, models.SearchRequest{})
+	want := map[string]bool{"NCT00000001": true, "NCT00000002": true, "NCT00000003": false}
+	for _, trial := range resp.Trials {
+		if trial.HasResults != want[trial.NCTID] {
+			t.Errorf("Expected has_results=%v for %s, got %v", want[trial.NCTID], trial.NCTID, trial.HasResults)
+		}
+	}
+
+	resp = client.convertToSearchResponse(&apiResp, models.SearchRequest{HasResults: true})
+	got := make([]string, 0, len(resp.Trials))
+	for _, trial := range resp.Trials {
+		got = append(got, trial.NCTID)
+	}
+	if !reflect.DeepEqual(got, []string{"NCT00000001", "NCT00000002"}) {
+		t.Errorf("Expected only trials with results, got %v", got)
+	}
+
+	if params := client.buildQueryParams(models.SearchRequest{HasResults: true}); params.Get("aggFilters") != "results:with" {
+		t.Errorf("Expected aggFilters results:with, got %q", params.Get("aggFilters"))
+	}
+	if params := client.buildQueryParams(models.SearchRequest{}); params.Has("aggFilters") {
+		t.Errorf("Expected no aggFilters without has_results, got %q", params.Get("aggFilters"))
+	}
+}
+
+func TestFilteringNotice(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	apiResp := &ClinicalTrialsGovResponse{NextPageToken: "next"}
+	for _, s := range []struct{ id, status, phase string }{
+		{"NCT00000001", "RECRUITING", "PHASE2"},
+		{"NCT00000002", "RECRUITING", "PHASE2"},
+		{"NCT00000003", "TERMINATED", "PHASE2"},
+	} {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = s.id
+		study.ProtocolSection.StatusModule.OverallStatus = s.status
+		study.ProtocolSection.DesignModule.Phases = []string{s.phase}
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	tests := []struct {
+		name       string
+		req        models.SearchRequest
+		wantNotice bool
+	}{
+		{"nothing removed", models.SearchRequest{IncludeInactive: true}, false},
+		{"filter removed nothing", models.SearchRequest{IncludeInactive: true, Phase: []string{"PHASE2"}}, false},
+		{"phase filter removed trials", models.SearchRequest{IncludeInactive: true, Phase: []string{"PHASE3"}}, true},
+		{"inactive trial removed", models.SearchRequest{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, tt.req)
+			if got := resp.FilteringNotice != ""; got != tt.wantNotice {
+				t.Errorf("Expected notice present=%v, got %q", tt.wantNotice, resp.FilteringNotice)
+			}
+		})
+	}
+}
+
+func TestExactAgeFilter(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	ranges := []struct {
+		id, min, max string
+	}{
+		{"NCT00000001", "18 Years", "65 Years"},
+		{"NCT00000002", "18 Years", ""},
+		{"NCT00000003", "", "17 Years"},
+		{"NCT00000004", "", ""},
+		{"NCT00000005", "66 Years", "80 Years"},
+	}
+	apiResp := &ClinicalTrialsGovResponse{}
+	for _, r := range ranges {
+		study := StudyData{}
+		study.ProtocolSection.IdentificationModule.NCTID = r.id
+		study.ProtocolSection.EligibilityModule.MinimumAge = r.min
+		study.ProtocolSection.EligibilityModule.MaximumAge = r.max
+		apiResp.Studies = append(apiResp.Studies, study)
+	}
+
+	tests := []struct {
+		age  int
+		want []string
+	}{
+		{17, []string{"NCT00000003", "NCT00000004"}},
+		{18, []string{"NCT00000001", "NCT00000002", "NCT00000004"}},
+		{65, []string{"NCT00000001", "NCT00000002", "NCT00000004"}},
+		{66, []string{"NCT00000002", "NCT00000004", "NCT00000005"}},
+		{81, []string{"NCT00000002", "NCT00000004"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("age=%d", tt.age), func(t *testing.T) {
+			resp := client.convertToSearchResponse(apiResp, models.SearchRequest{Age: tt.age})
+			got := make([]string, 0, len(resp.Trials))
+			for _, trial := range resp.Trials {
+				got = append(got, trial.NCTID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected trials %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFillPage(t *testing.T) {
+	// Four upstream pages of four studies; only the first study of each page is PHASE2
+	var calls atomic.Int32
+	var failThirdPage atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		page := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			page, _ = strconv.Atoi(token)
+		}
+		if page == 2 && failThirdPage.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		studies := make([]string, 4)
+		for i := range studies {
+			phase := "PHASE3"
+			if i == 0 {
+				phase = "PHASE2"
+			}
+			studies[i] = fmt.Sprintf(`{"protocolSection":{"identificationModule":{"nctId":"NCT%08d"},"designModule":{"phases":["%s"]}}}`, page*4+i, phase)
+		}
+		next := ""
+		if page < 3 {
+			next = fmt.Sprintf(`,"nextPageToken":"%d"`, page+1)
+		}
+		fmt.Fprintf(w, `{"studies":[%s],"totalCount":16%s}`, strings.Join(studies, ","), next)
+	}))
+	defer server.Close()
+
+	ids := func(resp *models.SearchResponse) []string {
+		got := make([]string, 0, len(resp.Trials))
+		for _, trial := range resp.Trials {
+			got = append(got, trial.NCTID)
+		}
+		return got
+	}
+	req := models.SearchRequest{Phase: []string{"PHASE2"}, PageSize: 3, FillPage: true}
+
+	t.Run("fills the page", func(t *testing.T) {
+		calls.Store(0)
+		resp, err := newTestClient(server.URL).SearchTrials(context.Background(), req)
+		if err != nil {
+			t.Fatalf("SearchTrials failed: %v", err)
+		}
+		if want := []string{"NCT00000000", "NCT00000004", "NCT00000008"}; !reflect.DeepEqual(ids(resp), want) {
+			t.Errorf("Expected %v, got %v", want, ids(resp))
+		}
+		if resp.NextPageToken != "3" || resp.FilteringNotice != "" || calls.Load() != 3 {
+			t.Errorf("Expected 3 upstream calls and a token for page 3, got %d calls, token %q, notice %q", calls.Load(), resp.NextPageToken, resp.FilteringNotice)
+		}
+	})
+
+	t.Run("page bound", func(t *testing.T) {
+		calls.Store(0)
+		resp, err := newTestClient(server.URL, WithMaxFillPages(2)).SearchTrials(context.Background(), req)
+		if err != nil {
+			t.Fatalf("SearchTrials failed: %v", err)
+		}
+		if len(resp.Trials) != 2 || resp.NextPageToken != "2" || calls.Load() != 2 {
+			t.Errorf("Expected 2 trials from 2 pages with a token for page 2, got %v, token %q, %d calls", ids(resp), resp.NextPageToken, calls.Load())
+		}
+		if resp.FilteringNotice == "" {
+			t.Error("Expected a filtering notice for a page left short")
+		}
+	})
+
+	t.Run("later page fails", func(t *testing.T) {
+		failThirdPage.Store(true)
+		defer failThirdPage.Store(false)
+		resp, err := newTestClient(server.URL, WithCircuitBreaker(100, time.Minute)).SearchTrials(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected partial results, got error %v", err)
+		}
+		if len(resp.Trials) != 2 || resp.NextPageToken != "2" {
+			t.Errorf("Expected the 2 trials collected and the failed page's token, got %v, token %q", ids(resp), resp.NextPageToken)
+		}
+		if !resp.Partial {
+			t.Error("Expected the page to be marked partial")
+		}
+	})
+
+	t.Run("without fill_page", func(t *testing.T) {
+		single := req
+		single.FillPage = false
+		resp, err := newTestClient(server.URL).SearchTrials(context.Background(), single)
+		if err != nil {
+			t.Fatalf("SearchTrials failed: %v", err)
+		}
+		if len(resp.Trials) != 1 || resp.NextPageToken != "1" {
+			t.Errorf("Expected a single upstream page, got %v, token %q", ids(resp), resp.NextPageToken)
+		}
+	})
+}
+
+// newTestClient creates a client pointed at a mock upstream with rate limiting disabled
+func newTestClient(baseURL string, opts ...Option) *ClinicalTrialsClient {
+	return NewClinicalTrialsClient(append([]Option{WithBaseURL(baseURL), WithRateLimitDelay(0)}, opts...)...)
+}
+
 // Note: Integration tests that actually call the API should be in a separate file
 // and can be run with: go test -tags=integration
+
+func TestFunderTypeFilter(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	// One study per lead sponsor class, plus one without a sponsor
+	var studies []string
+	for i, class := range FunderTypes {
+		studies = append(studies, fmt.Sprintf(`{"protocolSection":{"identificationModule":{"nctId":"NCT%08d"},"sponsorCollaboratorsModule":{"leadSponsor":{"name":"Sponsor %d","class":%q}}}}`, i+1, i+1, class))
+	}
+	studies = append(studies, `{"protocolSection":{"identificationModule":{"nctId":"NCT99999999"}}}`)
+	var apiResp ClinicalTrialsGovResponse
+	if err := json.Unmarshal([]byte(`{"studies":[`+strings.Join(studies, ",")+`]}`), &apiResp); err != nil {
+		t.Fatalf("Failed to decode studies: %v", err)
+	}
+
+	for i, class := range FunderTypes {
+		t.Run(class, func(t *testing.T) {
+			resp := client.convertToSearchResponse(&apiResp, models.SearchRequest{FunderType: []string{strings.ToLower(class)}})
+			if len(resp.Trials) != 1 || resp.Trials[0].NCTID != fmt.Sprintf("NCT%08d", i+1) {
+				t.Fatalf("Expected only the %s-sponsored trial, got %v", class, resp.Trials)
+			}
+			if resp.Trials[0].Sponsor.Type != class {
+				t.Errorf("Expected sponsor type %s, got %q", class, resp.Trials[0].Sponsor.Type)
+			}
+		})
+	}
+
+	resp := client.convertToSearchResponse(&apiResp, models.SearchRequest{FunderType: []string{"NIH", "INDUSTRY"}})
+	if len(resp.Trials) != 2 {
+		t.Errorf("Expected the NIH and industry trials, got %d trials", len(resp.Trials))
+	}
+	if resp := client.convertToSearchResponse(&apiResp, models.SearchRequest{}); len(resp.Trials) != len(FunderTypes)+1 {
+		t.Errorf("Expected no funder filtering by default, got %d trials", len(resp.Trials))
+	}
+}
+
+func TestSponsorTypeAndCategory(t *testing.T) {
+	client := NewClinicalTrialsClient()
+	for _, tt := range []struct {
+		class, category string
+	}{
+		{"INDUSTRY", "Industry"},
+		{"NIH", "NIH"},
+		{"OTHER", "Other (academic, hospital or nonprofit)"},
+		{"NEW_CLASS", "NEW_CLASS"}, // Unlabeled classes are passed through
+	} {
+		var study StudyData
+		body := fmt.Sprintf(`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"sponsorCollaboratorsModule":{"leadSponsor":{"name":"Sponsor","class":%q}}}}`, tt.class)
+		if err := json.Unmarshal([]byte(body), &study); err != nil {
+			t.Fatalf("Failed to decode study: %v", err)
+		}
+		sponsor := client.convertStudyToTrial(study).Sponsor
+		if sponsor.Name != "Sponsor" || sponsor.Type != tt.class || sponsor.Category != tt.category {
+			t.Errorf("%s: expected type %q and category %q, got %+v", tt.class, tt.class, tt.category, sponsor)
+		}
+	}
+}
+
+func TestFillPageCountsTotalOnce(t *testing.T) {
+	// Three upstream pages with one PHASE2 study each; like the real API, totalCount is only
+	// reported when countTotal=true
+	var mu sync.Mutex
+	var countTotals []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		countTotals = append(countTotals, r.URL.Query().Get("countTotal"))
+		mu.Unlock()
+		page, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		next, total := "", ""
+		if page < 2 {
+			next = fmt.Sprintf(`,"nextPageToken":"%d"`, page+1)
+		}
+		if r.URL.Query().Get("countTotal") == "true" {
+			total = `,"totalCount":3`
+		}
+		fmt.Fprintf(w, `{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT%08d"},"designModule":{"phases":["PHASE2"]}}}]%s%s}`, page, total, next)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	resp, err := client.SearchTrials(context.Background(), models.SearchRequest{PageSize: 3, FillPage: true})
+	if err != nil {
+		t.Fatalf("SearchTrials failed: %v", err)
+	}
+	if !reflect.DeepEqual(countTotals, []string{"true", "false", "false"}) {
+		t.Errorf("Expected only the first page to request the total, got countTotal=%v", countTotals)
+	}
+	if resp.UpstreamTotalCount != 3 || len(resp.Trials) != 3 {
+		t.Errorf("Expected the first page's total of 3 to be carried over, got %d with %d trials", resp.UpstreamTotalCount, len(resp.Trials))
+	}
+
+	if params := client.buildQueryParams(models.SearchRequest{}); params.Get("countTotal") != "true" {
+		t.Errorf("Expected a standalone search to request the total, got %q", params.Get("countTotal"))
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestMaxConcurrentUpstreamCalls(t *testing.T) {
+	var current, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, WithMaxConcurrent(2))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&peak); got > 2 {
+		t.Errorf("Expected at most 2 concurrent upstream calls, got %d", got)
+	}
+	if got := atomic.LoadInt32(&peak); got < 2 {
+		t.Errorf("Expected calls to run concurrently up to the cap, peak was %d", got)
+	}
+}
+
+func TestMaxConcurrentRespectsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, WithMaxConcurrent(1))
+
+	// Occupy the only slot; the search must finish before the test returns so it does not
+	// log after other tests swap the logger
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.SearchTrials(context.Background(), models.SearchRequest{})
+	}()
+	defer func() {
+		close(release)
+		<-done
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetTrialDetails(ctx, "NCT00000001"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected waiting caller to give up with its context, got %v", err)
+	}
+	if state := client.BreakerState(); state != BreakerClosed {
+		t.Errorf("Expected abandoned waits not to affect the breaker, got %s", state)
+	}
+}
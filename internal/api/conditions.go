@@ -0,0 +1,95 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+const (
+	// ConditionLogicOr matches trials studying any of the requested conditions (default)
+	ConditionLogicOr = "or"
+	// ConditionLogicAnd matches only trials studying all of the requested conditions
+	ConditionLogicAnd = "and"
+
+	// MatchPartial keeps every trial the upstream condition search returns (default)
+	MatchPartial = "partial"
+	// MatchExact keeps only trials listing a requested condition verbatim, ignoring case
+	MatchExact = "exact"
+)
+
+// JoinConditions builds the upstream condition expression for a list of conditions.
+//
+// OR-joined conditions keep the plain "a OR b" form. For AND each condition is
+// parenthesized so multi-word terms stay grouped, e.g.
+// "(diabetes) AND (heart failure)", which the ClinicalTrials.gov Essie syntax
+// evaluates as requiring both conditions.
+func JoinConditions(conditions []string, logic string) string {
+	if !strings.EqualFold(logic, ConditionLogicAnd) || len(conditions) < 2 {
+		return strings.Join(conditions, " OR ")
+	}
+	grouped := make([]string, len(conditions))
+	for i, condition := range conditions {
+		grouped[i] = "(" + condition + ")"
+	}
+	return strings.Join(grouped, " AND ")
+}
+
+// NormalizeConditions trims each condition, collapses runs of internal whitespace to a
+// single space and drops empty entries and case-insensitive duplicates, keeping the first
+// spelling of each. Equivalent condition lists thus produce the same upstream query and
+// cache key.
+func NormalizeConditions(conditions []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(conditions))
+	for _, condition := range conditions {
+		condition = strings.Join(strings.Fields(condition), " ")
+		key := strings.ToLower(condition)
+		if condition == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, condition)
+	}
+	return normalized
+}
+
+// exactConditionTerms returns the conditions a match=exact search compares trial conditions
+// against: the requested conditions, the free-text query or the default SCI terms. It returns
+// nil when exact matching does not apply, i.e. for partial matching, advanced queries and
+// NCT ID lookups without conditions.
+func exactConditionTerms(req models.SearchRequest) []string {
+	if !strings.EqualFold(req.Match, MatchExact) || req.AdvancedQuery != "" {
+		return nil
+	}
+	switch {
+	case len(req.Conditions) > 0:
+		return req.Conditions
+	case req.Query != "":
+		return []string{req.Query}
+	case len(req.NCTIDs) > 0:
+		return nil
+	default:
+		return strings.Split(DefaultConditionQuery, " OR ")
+	}
+}
+
+// matchesConditionsExactly reports whether a trial's conditions contain a case-insensitive exact
+// match for any requested condition, or for every one of them with condition_logic=and
+func matchesConditionsExactly(trialConditions, requested []string, logic string) bool {
+	listed := make(map[string]bool, len(trialConditions))
+	for _, condition := range trialConditions {
+		listed[strings.ToLower(strings.TrimSpace(condition))] = true
+	}
+	requireAll := strings.EqualFold(logic, ConditionLogicAnd)
+	for _, condition := range requested {
+		found := listed[strings.ToLower(strings.TrimSpace(condition))]
+		if found && !requireAll {
+			return true
+		}
+		if !found && requireAll {
+			return false
+		}
+	}
+	return requireAll
+}
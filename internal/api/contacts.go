@@ -0,0 +1,39 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+const (
+	// ContactTypeAny accepts a contact with either an email or a phone (default)
+	ContactTypeAny = "any"
+	// ContactTypeEmail requires a contact with an email
+	ContactTypeEmail = "email"
+	// ContactTypePhone requires a contact with a phone
+	ContactTypePhone = "phone"
+)
+
+// hasContact reports whether any contact can be reached by the given contact type
+func hasContact(contacts []models.Contact, contactType string) bool {
+	for _, contact := range contacts {
+		email := strings.TrimSpace(contact.Email) != ""
+		phone := strings.TrimSpace(contact.Phone) != ""
+		switch strings.ToLower(contactType) {
+		case ContactTypeEmail:
+			if email {
+				return true
+			}
+		case ContactTypePhone:
+			if phone {
+				return true
+			}
+		default:
+			if email || phone {
+				return true
+			}
+		}
+	}
+	return false
+}
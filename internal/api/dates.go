@@ -0,0 +1,51 @@
+package api
+
+import (
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// NormalizeDate converts a YYYY-MM-DD or YYYY-MM date to YYYY-MM-DD, treating a month as its
+// first day, so dates of either granularity compare correctly as strings. Registries record
+// start and completion dates at either granularity.
+func NormalizeDate(date string) (string, bool) {
+	if _, err := time.Parse(time.DateOnly, date); err == nil {
+		return date, true
+	}
+	if month, err := time.Parse("2006-01", date); err == nil {
+		return month.Format(time.DateOnly), true
+	}
+	return "", false
+}
+
+// inDateRange reports whether date falls within from..to, both inclusive and either open.
+// Dates that are missing or not understood never match a set bound.
+func inDateRange(date, from, to string) bool {
+	if from == "" && to == "" {
+		return true
+	}
+	date, ok := NormalizeDate(date)
+	if !ok {
+		return false
+	}
+	if from, ok := NormalizeDate(from); ok && date < from {
+		return false
+	}
+	if to, ok := NormalizeDate(to); ok && date > to {
+		return false
+	}
+	return true
+}
+
+// hasDateRange reports whether req filters on the start or completion date
+func hasDateRange(req models.SearchRequest) bool {
+	return req.StartDateFrom != "" || req.StartDateTo != "" || req.CompletionDateFrom != "" || req.CompletionDateTo != ""
+}
+
+// matchesDateRanges reports whether a trial's start and completion dates fall within the
+// ranges requested in req
+func matchesDateRanges(trial models.Trial, req models.SearchRequest) bool {
+	return inDateRange(trial.StartDate, req.StartDateFrom, req.StartDateTo) &&
+		inDateRange(trial.CompletionDate, req.CompletionDateFrom, req.CompletionDateTo)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestNormalizeDate(t *testing.T) {
+	tests := []struct {
+		date, want string
+		wantOK     bool
+	}{
+		{"2024-03-15", "2024-03-15", true},
+		{"2024-03", "2024-03-01", true},
+		{"2024", "", false},
+		{"15/03/2024", "", false},
+		{"2024-13", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := NormalizeDate(tt.date); got != tt.want || ok != tt.wantOK {
+			t.Errorf("NormalizeDate(%q) = %q, %v; expected %q, %v", tt.date, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestInDateRange(t *testing.T) {
+	tests := []struct {
+		name           string
+		date, from, to string
+		want           bool
+	}{
+		{"no bounds", "", "", "", true},
+		{"inside", "2024-03-15", "2024-01-01", "2024-12-31", true},
+		{"on from boundary", "2024-01-01", "2024-01-01", "2024-12-31", true},
+		{"on to boundary", "2024-12-31", "2024-01-01", "2024-12-31", true},
+		{"day before from", "2023-12-31", "2024-01-01", "", false},
+		{"day after to", "2025-01-01", "", "2024-12-31", false},
+		{"month date is its first day", "2024-03", "2024-03-01", "2024-03-01", true},
+		{"month date before a mid-month from", "2024-03", "2024-03-02", "", false},
+		{"month bound is its first day", "2024-03-15", "", "2024-03", false},
+		{"month bounds around a day", "2024-03-15", "2024-03", "2024-04", true},
+		{"missing date with a bound", "", "2024-01-01", "", false},
+		{"unparseable date with a bound", "March 2024", "", "2025-01-01", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inDateRange(tt.date, tt.from, tt.to); got != tt.want {
+				t.Errorf("inDateRange(%q, %q, %q) = %v; expected %v", tt.date, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesDateRanges(t *testing.T) {
+	trial := models.Trial{StartDate: "2023-06", CompletionDate: "2025-12-31"}
+	req := models.SearchRequest{StartDateFrom: "2023-01-01", CompletionDateTo: "2025-12"}
+	if matchesDateRanges(trial, req) {
+		t.Error("Expected a completion date after the completion range to be excluded")
+	}
+	req.CompletionDateTo = "2026-01"
+	if !matchesDateRanges(trial, req) {
+		t.Error("Expected a trial within both ranges to match")
+	}
+	if !matchesDateRanges(models.Trial{}, models.SearchRequest{}) {
+		t.Error("Expected trials without dates to match when no range is set")
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// decodeSnippetRadius is the number of body bytes logged on each side of a decode error
+const decodeSnippetRadius = 80
+
+// withDecodeDiagnostics adds where and why decoding an upstream JSON body failed to a log
+// event: the error kind, byte offset, offending field and a bounded snippet of the body
+// around the offset. This makes upstream schema drift quick to pin down from logs.
+func withDecodeDiagnostics(event *zerolog.Event, body []byte, err error) *zerolog.Event {
+	event = event.Int("body_size", len(body))
+
+	offset := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+		event = event.Str("decode_error_kind", "syntax")
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+		event = event.
+			Str("decode_error_kind", "type").
+			Str("json_field", e.Field).
+			Str("json_value", e.Value).
+			Str("expected_type", e.Type.String())
+	default:
+		// No position information; show the end of the body
+		offset = int64(len(body))
+		event = event.Str("decode_error_kind", "other")
+	}
+
+	return event.
+		Int64("json_offset", offset).
+		Str("body_snippet", bodySnippet(body, offset))
+}
+
+// bodySnippet returns up to decodeSnippetRadius bytes on each side of offset
+func bodySnippet(body []byte, offset int64) string {
+	start := max(offset-decodeSnippetRadius, 0)
+	end := min(offset+decodeSnippetRadius, int64(len(body)))
+	if start > end {
+		return ""
+	}
+	return string(body[start:end])
+}
+
+var (
+	studyFields    = jsonFieldNames(reflect.TypeOf(StudyData{}))
+	protocolFields = jsonFieldNames(reflect.TypeOf(ProtocolSection{}))
+)
+
+// jsonFieldNames returns the JSON keys a struct type maps
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// unmappedStudyFields returns the top-level study keys and protocolSection modules that
+// StudyData does not map, e.g. "resultsSection" or "protocolSection.outcomesModule".
+// It is a shadow pass over an already-decoded study and never fails the real decode.
+func unmappedStudyFields(study json.RawMessage) []string {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(study, &top); err != nil {
+		return nil
+	}
+
+	var unmapped []string
+	for key := range top {
+		if !studyFields[key] {
+			unmapped = append(unmapped, key)
+		}
+	}
+
+	var protocol map[string]json.RawMessage
+	if err := json.Unmarshal(top["protocolSection"], &protocol); err == nil {
+		for key := range protocol {
+			if !protocolFields[key] {
+				unmapped = append(unmapped, "protocolSection."+key)
+			}
+		}
+	}
+
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// logUnmappedFields logs, at debug level, the upstream study fields this service does not map
+// yet. It only runs with strict decoding enabled and gives early warning of schema additions.
+func (c *ClinicalTrialsClient) logUnmappedFields(logger zerolog.Logger, studies []json.RawMessage) {
+	if !c.strictDecode || logger.GetLevel() > zerolog.DebugLevel {
+		return
+	}
+
+	seen := make(map[string]bool)
+	var fields []string
+	affected := 0
+	for _, study := range studies {
+		unmapped := unmappedStudyFields(study)
+		if len(unmapped) > 0 {
+			affected++
+		}
+		for _, field := range unmapped {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	sort.Strings(fields)
+	logger.Debug().
+		Strs("unmapped_fields", fields).
+		Int("studies_affected", affected).
+		Msg("Upstream study data has unmapped fields")
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+	"github.com/rs/zerolog"
+)
+
+func TestDecodeErrorDiagnostics(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		kind    string
+		field   string
+		snippet string
+	}{
+		{
+			name:    "type mismatch",
+			body:    `{"studies":[{"protocolSection":{"identificationModule":{"nctId":12345}}}],"totalCount":1}`,
+			kind:    "type",
+			field:   "protocolSection.identificationModule.nctId",
+			snippet: `"nctId":12345`,
+		},
+		{
+			name:    "syntax error",
+			body:    `{"studies":[{"protocolSection":}],"totalCount":1}`,
+			kind:    "syntax",
+			snippet: `"protocolSection":}`,
+		},
+		{
+			name:    "truncated body",
+			body:    `{"studies":[{"protocolSection":{"identificationModule"`,
+			kind:    "syntax",
+			snippet: `"identificationModule"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t, zerolog.InfoLevel)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			if _, err := newTestClient(server.URL).SearchTrials(context.Background(), models.SearchRequest{}); err == nil {
+				t.Fatal("Expected a decode error")
+			}
+
+			entry := findLogEntry(buf, "Failed to decode external API response")
+			if entry == nil {
+				t.Fatalf("Expected decode failure log, got %s", buf.String())
+			}
+			if entry["decode_error_kind"] != tt.kind {
+				t.Errorf("Expected decode_error_kind %q, got %v", tt.kind, entry["decode_error_kind"])
+			}
+			if field, _ := entry["json_field"].(string); !strings.HasSuffix(field, tt.field) {
+				t.Errorf("Expected json_field %q, got %v", tt.field, entry["json_field"])
+			}
+			if offset, ok := entry["json_offset"].(float64); !ok || offset <= 0 || int(offset) > len(tt.body) {
+				t.Errorf("Expected json_offset within the body, got %v", entry["json_offset"])
+			}
+			if snippet, _ := entry["body_snippet"].(string); !strings.Contains(snippet, tt.snippet) {
+				t.Errorf("Expected body_snippet containing %q, got %q", tt.snippet, snippet)
+			}
+			if entry["body_size"] != float64(len(tt.body)) {
+				t.Errorf("Expected body_size %d, got %v", len(tt.body), entry["body_size"])
+			}
+		})
+	}
+}
+
+func TestBodySnippetIsBounded(t *testing.T) {
+	body := []byte(strings.Repeat("a", 1000))
+	if got := bodySnippet(body, 500); len(got) != 2*decodeSnippetRadius {
+		t.Errorf("Expected snippet of %d bytes, got %d", 2*decodeSnippetRadius, len(got))
+	}
+	if got := bodySnippet(body, 0); len(got) != decodeSnippetRadius {
+		t.Errorf("Expected snippet clipped at the start, got %d bytes", len(got))
+	}
+	if got := bodySnippet(body, 1000); len(got) != decodeSnippetRadius {
+		t.Errorf("Expected snippet clipped at the end, got %d bytes", len(got))
+	}
+}
+
+func TestStrictDecodingLogsUnmappedFields(t *testing.T) {
+	body := `{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"outcomesModule":{}},"documentSection":{},"annotationSection":{}}],"totalCount":1}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	t.Run("enabled", func(t *testing.T) {
+		buf := captureLogs(t, zerolog.DebugLevel)
+		client := newTestClient(server.URL, WithStrictDecoding(true))
+
+		resp, err := client.SearchTrials(context.Background(), models.SearchRequest{})
+		if err != nil {
+			t.Fatalf("Strict decoding must not fail the real decode: %v", err)
+		}
+		if len(resp.Trials) != 1 || resp.Trials[0].NCTID != "NCT00000001" {
+			t.Fatalf("Expected the study to decode normally, got %+v", resp.Trials)
+		}
+
+		entry := findLogEntry(buf, "Upstream study data has unmapped fields")
+		if entry == nil {
+			t.Fatalf("Expected unmapped fields log, got %s", buf.String())
+		}
+		fields, _ := entry["unmapped_fields"].([]interface{})
+		want := []string{"annotationSection", "documentSection", "protocolSection.outcomesModule"}
+		if len(fields) != len(want) {
+			t.Fatalf("Expected unmapped fields %v, got %v", want, fields)
+		}
+		for i, field := range want {
+			if fields[i] != field {
+				t.Errorf("Expected unmapped field %q at %d, got %v", field, i, fields[i])
+			}
+		}
+		if entry["level"] != "debug" {
+			t.Errorf("Expected debug level, got %v", entry["level"])
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		buf := captureLogs(t, zerolog.DebugLevel)
+		client := newTestClient(server.URL)
+
+		if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if entry := findLogEntry(buf, "Upstream study data has unmapped fields"); entry != nil {
+			t.Errorf("Expected no unmapped fields log without strict decoding, got %v", entry)
+		}
+	})
+}
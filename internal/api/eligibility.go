@@ -0,0 +1,98 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	sectionNone = iota
+	sectionInclusion
+	sectionExclusion
+)
+
+var (
+	// criteriaHeader matches section headers such as "Inclusion Criteria:", "KEY EXCLUSION CRITERIA",
+	// "**Inclusion criteria:** text" or "Exclusion:", capturing the kind, the optional colon and any
+	// text following the header on the same line
+	criteriaHeader = regexp.MustCompile(`(?i)^[#*_\s]*(?:(?:key|main|general|major)\s+)?(inclusion|exclusion)(\s+criteria)?[*_\s]*(:)?[*_\s]*(.*)$`)
+	// criteriaBullet matches list markers: "*", "-", "•", "1.", "2)", "a.", "(iii)"
+	criteriaBullet = regexp.MustCompile(`^(?:[*\-•·●▪◦+]|\d{1,3}[.)]|[a-zA-Z][.)]|\(\w{1,4}\))\s+(.*)$`)
+)
+
+// ParseEligibilityCriteria splits free-text eligibility criteria into inclusion and exclusion
+// items. Sections start at "Inclusion Criteria" / "Exclusion Criteria" style headers; items are
+// bullet or numbered lines, or blank-line separated paragraphs, with wrapped lines joined.
+// Text before the first recognized header is ignored, so criteria without headers yield no items.
+func ParseEligibilityCriteria(text string) (inclusion, exclusion []string) {
+	section := sectionNone
+	var item []string
+
+	flush := func() {
+		if len(item) == 0 {
+			return
+		}
+		joined := strings.Join(item, " ")
+		item = nil
+		switch section {
+		case sectionInclusion:
+			inclusion = append(inclusion, joined)
+		case sectionExclusion:
+			exclusion = append(exclusion, joined)
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			flush()
+			continue
+		}
+		if kind, rest, ok := parseCriteriaHeader(line); ok {
+			flush()
+			section = kind
+			if rest != "" {
+				item = append(item, rest)
+			}
+			continue
+		}
+		if section == sectionNone {
+			continue
+		}
+		if match := criteriaBullet.FindStringSubmatch(line); match != nil {
+			flush()
+			line = strings.TrimSpace(match[1])
+		}
+		if line != "" {
+			item = append(item, line)
+		}
+	}
+	flush()
+	return inclusion, exclusion
+}
+
+// parseCriteriaHeader reports whether line is an inclusion or exclusion header and returns
+// the criterion text that follows the header on the same line, if any
+func parseCriteriaHeader(line string) (int, string, bool) {
+	match := criteriaHeader.FindStringSubmatch(line)
+	if match == nil {
+		return sectionNone, "", false
+	}
+	hasCriteria, hasColon, rest := match[2] != "", match[3] != "", strings.TrimSpace(match[4])
+	switch {
+	case hasColon:
+	case hasCriteria && rest == "":
+	case hasCriteria && strings.HasSuffix(rest, ":"):
+		// "Inclusion criteria are as follows:" introduces the list without being an item
+		rest = ""
+	default:
+		// Prose that merely starts with the word, e.g. "Inclusion of women of childbearing potential"
+		return sectionNone, "", false
+	}
+
+	kind := sectionInclusion
+	if strings.EqualFold(match[1], "exclusion") {
+		kind = sectionExclusion
+	}
+	return kind, rest, true
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEligibilityCriteria(t *testing.T) {
+	tests := []struct {
+		name          string
+		criteria      string
+		wantInclusion []string
+		wantExclusion []string
+	}{
+		{
+			name: "clinicaltrials.gov markdown bullets",
+			criteria: "Inclusion Criteria:\n\n* Traumatic spinal cord injury at C5-T12\n* At least 12 months post-injury\n\n" +
+				"Exclusion Criteria:\n\n* Pregnancy\n* Uncontrolled autonomic dysreflexia",
+			wantInclusion: []string{"Traumatic spinal cord injury at C5-T12", "At least 12 months post-injury"},
+			wantExclusion: []string{"Pregnancy", "Uncontrolled autonomic dysreflexia"},
+		},
+		{
+			name: "legacy dashes with wrapped lines",
+			criteria: "Inclusion Criteria:\r\n\r\n  - Age 18 to 65 years with a complete or incomplete\r\n    injury (AIS A-D)\r\n  - Able to give consent\r\n\r\n" +
+				"Exclusion Criteria:\r\n\r\n  - Active pressure ulcers",
+			wantInclusion: []string{"Age 18 to 65 years with a complete or incomplete injury (AIS A-D)", "Able to give consent"},
+			wantExclusion: []string{"Active pressure ulcers"},
+		},
+		{
+			name:          "numbered items and upper-case headers",
+			criteria:      "INCLUSION CRITERIA\n1. Chronic SCI\n2) Wheelchair user\nEXCLUSION CRITERIA\n1. Prior stem cell therapy",
+			wantInclusion: []string{"Chronic SCI", "Wheelchair user"},
+			wantExclusion: []string{"Prior stem cell therapy"},
+		},
+		{
+			name:          "bold headers with inline text",
+			criteria:      "**Key Inclusion Criteria:** Tetraplegia\n\n**Key Exclusion Criteria:** Ventilator dependence",
+			wantInclusion: []string{"Tetraplegia"},
+			wantExclusion: []string{"Ventilator dependence"},
+		},
+		{
+			name: "paragraphs and introductory headers",
+			criteria: "Inclusion criteria are as follows:\nParticipants with paraplegia\n\nParticipants with tetraplegia\n" +
+				"Exclusion:\nInclusion of participants in another trial within 30 days",
+			wantInclusion: []string{"Participants with paraplegia", "Participants with tetraplegia"},
+			wantExclusion: []string{"Inclusion of participants in another trial within 30 days"},
+		},
+		{
+			name:          "ictrp layout",
+			criteria:      "Inclusion Criteria:\nAdults with chronic SCI\n\nExclusion Criteria:\n",
+			wantInclusion: []string{"Adults with chronic SCI"},
+		},
+		{
+			name:     "no headers",
+			criteria: "Adults with spinal cord injury\n* Able to walk 10 meters",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inclusion, exclusion := ParseEligibilityCriteria(tt.criteria)
+			if !reflect.DeepEqual(inclusion, tt.wantInclusion) {
+				t.Errorf("Inclusion: expected %q, got %q", tt.wantInclusion, inclusion)
+			}
+			if !reflect.DeepEqual(exclusion, tt.wantExclusion) {
+				t.Errorf("Exclusion: expected %q, got %q", tt.wantExclusion, exclusion)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import "sync/atomic"
+
+const (
+	// DefaultErrorWindow is the number of recent upstream calls the error rate is computed over
+	DefaultErrorWindow = 20
+	// DefaultErrorRateThreshold is the recent error rate above which the upstream counts as degraded
+	DefaultErrorRateThreshold = 0.5
+	// minErrorSamples is how many calls must be recorded before the upstream can count as
+	// degraded, so a single failure right after startup does not flip readiness
+	minErrorSamples = 5
+)
+
+// Outcome states of an errorTracker slot
+const (
+	outcomeEmpty int32 = iota
+	outcomeSuccess
+	outcomeFailure
+)
+
+// errorTracker records the outcome of the last window upstream calls in a ring buffer. It is
+// lock-free: each call claims a slot with an atomic counter and swaps its outcome in, and the
+// failure count is adjusted by what the swap replaced, so it always matches the ring.
+type errorTracker struct {
+	slots     []atomic.Int32
+	next      atomic.Uint64 // Total outcomes recorded; next%len(slots) is the slot to overwrite
+	failures  atomic.Int64  // Failed outcomes currently in the ring
+	threshold float64
+}
+
+// newErrorTracker creates a tracker over the last window calls that reports degraded above
+// threshold. Non-positive values use the defaults.
+func newErrorTracker(window int, threshold float64) *errorTracker {
+	if window <= 0 {
+		window = DefaultErrorWindow
+	}
+	if threshold <= 0 || threshold > 1 {
+		threshold = DefaultErrorRateThreshold
+	}
+	return &errorTracker{slots: make([]atomic.Int32, window), threshold: threshold}
+}
+
+// record adds the outcome of one upstream call, evicting the oldest one once the window is full
+func (t *errorTracker) record(failed bool) {
+	outcome := outcomeSuccess
+	if failed {
+		outcome = outcomeFailure
+	}
+	slot := (t.next.Add(1) - 1) % uint64(len(t.slots))
+	previous := t.slots[slot].Swap(outcome)
+	if previous == outcomeFailure {
+		t.failures.Add(-1)
+	}
+	if outcome == outcomeFailure {
+		t.failures.Add(1)
+	}
+}
+
+// errorRate returns the failure rate of the recorded calls in the window and how many there are
+func (t *errorTracker) errorRate() (float64, int) {
+	samples := int(min(t.next.Load(), uint64(len(t.slots))))
+	if samples == 0 {
+		return 0, 0
+	}
+	rate := float64(t.failures.Load()) / float64(samples)
+	return min(max(rate, 0), 1), samples // Concurrent records may briefly skew the count
+}
+
+// UpstreamHealth summarizes the outcome of recent upstream calls
+type UpstreamHealth struct {
+	ErrorRate float64 // Failed fraction of the recorded calls in the window
+	Samples   int     // Calls recorded in the window
+	Degraded  bool    // ErrorRate is above the threshold over enough samples
+}
+
+// health returns the current error rate and whether it is above the threshold
+func (t *errorTracker) health() UpstreamHealth {
+	rate, samples := t.errorRate()
+	return UpstreamHealth{
+		ErrorRate: rate,
+		Samples:   samples,
+		Degraded:  samples >= min(minErrorSamples, len(t.slots)) && rate > t.threshold,
+	}
+}
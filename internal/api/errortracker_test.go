@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestUpstreamHealthDegradesAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	// A high breaker threshold keeps the circuit closed so only the error rate is exercised
+	client := newTestClient(server.URL, WithCircuitBreaker(1000, time.Minute), WithErrorTracking(10, 0.5))
+	search := func(n int) {
+		for i := 0; i < n; i++ {
+			client.SearchTrials(context.Background(), models.SearchRequest{})
+		}
+	}
+
+	if health := client.UpstreamHealth(); health.Degraded || health.Samples != 0 {
+		t.Fatalf("Expected a fresh client to be healthy with no samples, got %+v", health)
+	}
+
+	search(4)
+	healthy.Store(false)
+	search(6)
+	health := client.UpstreamHealth()
+	if !health.Degraded || health.Samples != 10 || health.ErrorRate != 0.6 {
+		t.Fatalf("Expected degraded at a 0.6 error rate over 10 calls, got %+v", health)
+	}
+
+	// Successes push the oldest outcomes out of the window: the first 4 replace successes,
+	// the 5th replaces a failure
+	healthy.Store(true)
+	search(4)
+	if !client.UpstreamHealth().Degraded {
+		t.Error("Expected to stay degraded while the failures are in the window")
+	}
+	search(1)
+	if health := client.UpstreamHealth(); health.Degraded || health.ErrorRate != 0.5 {
+		t.Errorf("Expected recovery at the 0.5 threshold, got %+v", health)
+	}
+	search(10)
+	if health := client.UpstreamHealth(); health.Degraded || health.ErrorRate != 0 {
+		t.Errorf("Expected a clean window after recovery, got %+v", health)
+	}
+}
+
+func TestErrorTrackerMinSamples(t *testing.T) {
+	tracker := newErrorTracker(20, 0.5)
+	for i := 0; i < minErrorSamples-1; i++ {
+		tracker.record(true)
+	}
+	if health := tracker.health(); health.Degraded || health.ErrorRate != 1 {
+		t.Errorf("Expected no degradation below %d samples, got %+v", minErrorSamples, health)
+	}
+	tracker.record(true)
+	if !tracker.health().Degraded {
+		t.Error("Expected degradation once enough samples failed")
+	}
+}
+
+func TestErrorTrackerConcurrentRecords(t *testing.T) {
+	tracker := newErrorTracker(16, 0.5)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				tracker.record(g%2 == 0)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Once writers are done the failure count must match the ring exactly
+	failed := 0
+	for i := range tracker.slots {
+		if tracker.slots[i].Load() == outcomeFailure {
+			failed++
+		}
+	}
+	if got := tracker.failures.Load(); got != int64(failed) {
+		t.Errorf("Expected failure count %d to match the ring, got %d", failed, got)
+	}
+	if _, samples := tracker.errorRate(); samples != 16 {
+		t.Errorf("Expected a full window of 16 samples, got %d", samples)
+	}
+}
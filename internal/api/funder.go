@@ -0,0 +1,52 @@
+package api
+
+import "strings"
+
+// FunderTypes are the ClinicalTrials.gov lead sponsor classes accepted by the funder_type filter
+var FunderTypes = []string{"NIH", "FED", "OTHER_GOV", "INDUSTRY", "NETWORK", "INDIV", "OTHER", "AMBIG", "UNKNOWN"}
+
+// FunderTypeLabels maps lead sponsor classes to labels suitable for display
+var FunderTypeLabels = map[string]string{
+	"NIH":       "NIH",
+	"FED":       "U.S. federal agency",
+	"OTHER_GOV": "Other government",
+	"INDUSTRY":  "Industry",
+	"NETWORK":   "Research network",
+	"INDIV":     "Individual",
+	"OTHER":     "Other (academic, hospital or nonprofit)",
+	"AMBIG":     "Ambiguous",
+	"UNKNOWN":   "Unknown",
+}
+
+// FunderTypeLabel returns the display label of a lead sponsor class, or the class itself
+// when it has no label
+func FunderTypeLabel(funderType string) string {
+	if label, ok := FunderTypeLabels[strings.ToUpper(funderType)]; ok {
+		return label
+	}
+	return funderType
+}
+
+// IsFunderType reports whether funderType (case-insensitive) is a known lead sponsor class
+func IsFunderType(funderType string) bool {
+	for _, known := range FunderTypes {
+		if strings.EqualFold(funderType, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFunderType reports whether a trial's lead sponsor class is one of the requested
+// funder types. Trials without a sponsor class never match.
+func matchesFunderType(sponsorType string, requested []string) bool {
+	if sponsorType == "" {
+		return false
+	}
+	for _, funderType := range requested {
+		if strings.EqualFold(sponsorType, funderType) {
+			return true
+		}
+	}
+	return false
+}
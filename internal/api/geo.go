@@ -0,0 +1,102 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// earthRadiusMiles is the mean Earth radius used for distance calculations
+const earthRadiusMiles = 3958.8
+
+// SortDistance orders results by the distance of each trial's nearest site to the search coordinates
+const SortDistance = "distance"
+
+// Distance units selectable with units=; distances are in miles unless kilometers are requested
+const (
+	UnitsMiles      = "mi"
+	UnitsKilometers = "km"
+)
+
+// kilometersPerMile converts between the two distance units
+const kilometersPerMile = 1.609344
+
+// distanceMiles converts a search radius given in units to whole miles, as the upstream geo
+// filter expects. Kilometers are rounded up so the radius never shrinks.
+func distanceMiles(distance int, units string) int {
+	if !strings.EqualFold(units, UnitsKilometers) {
+		return distance
+	}
+	return int(math.Ceil(float64(distance) / kilometersPerMile))
+}
+
+// ConvertMiles converts a distance computed in miles to units
+func ConvertMiles(miles float64, units string) float64 {
+	if strings.EqualFold(units, UnitsKilometers) {
+		return miles * kilometersPerMile
+	}
+	return miles
+}
+
+// RecruitingStatuses are the statuses of trials currently or soon accepting participants
+var RecruitingStatuses = []string{"RECRUITING", "NOT_YET_RECRUITING"}
+
+// haversineMiles returns the great-circle distance in miles between two coordinates
+func haversineMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusMiles * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// hasCoordinates reports whether a location has been geocoded by the upstream
+func hasCoordinates(loc models.Location) bool {
+	return loc.Latitude != 0 || loc.Longitude != 0
+}
+
+// nearestLocation returns the geocoded location closest to the given point, with its distance set.
+// Returns false if none of the locations have coordinates.
+func nearestLocation(locations []models.Location, lat, lon float64) (models.Location, bool) {
+	var nearest models.Location
+	found := false
+	for _, loc := range locations {
+		if !hasCoordinates(loc) {
+			continue
+		}
+		loc.Distance = haversineMiles(lat, lon, loc.Latitude, loc.Longitude)
+		if !found || loc.Distance < nearest.Distance {
+			nearest = loc
+			found = true
+		}
+	}
+	return nearest, found
+}
+
+// SortByDistance orders trials by the distance of their nearest geocoded site to the given
+// point, closest first. Trials without geocoded sites go last, keeping their upstream order.
+func SortByDistance(trials []models.Trial, lat, lon float64) {
+	type rankedTrial struct {
+		trial    models.Trial
+		distance float64
+		located  bool
+	}
+	ranked := make([]rankedTrial, len(trials))
+	for i, trial := range trials {
+		nearest, ok := nearestLocation(trial.Locations, lat, lon)
+		ranked[i] = rankedTrial{trial: trial, distance: nearest.Distance, located: ok}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].located != ranked[j].located {
+			return ranked[i].located
+		}
+		return ranked[i].distance < ranked[j].distance
+	})
+	for i := range ranked {
+		trials[i] = ranked[i].trial
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestHaversineMiles(t *testing.T) {
+	// Los Angeles to New York is roughly 2445 miles
+	got := haversineMiles(34.0522, -118.2437, 40.7128, -74.0060)
+	if math.Abs(got-2445) > 10 {
+		t.Errorf("Expected ~2445 miles between LA and NYC, got %f", got)
+	}
+
+	if d := haversineMiles(34.0522, -118.2437, 34.0522, -118.2437); d != 0 {
+		t.Errorf("Expected zero distance for identical points, got %f", d)
+	}
+}
+
+func TestNearestOnly(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	study := StudyData{}
+	study.ProtocolSection.IdentificationModule.NCTID = "NCT00000001"
+	study.ProtocolSection.ContactsLocationsModule.Locations = []LocationData{
+		{City: "New York", GeoPoint: GeoPoint{Lat: 40.7128, Lon: -74.0060}},
+		{City: "Unknown"}, // Not geocoded, must never be selected
+		{City: "San Diego", GeoPoint: GeoPoint{Lat: 32.7157, Lon: -117.1611}},
+		{City: "Chicago", GeoPoint: GeoPoint{Lat: 41.8781, Lon: -87.6298}},
+	}
+
+	req := models.SearchRequest{Latitude: 34.0522, Longitude: -118.2437, NearestOnly: true}
+	resp := client.convertToSearchResponse(&ClinicalTrialsGovResponse{Studies: []StudyData{study}}, req)
+
+	if len(resp.Trials) != 1 {
+		t.Fatalf("Expected 1 trial, got %d", len(resp.Trials))
+	}
+	locations := resp.Trials[0].Locations
+	if len(locations) != 1 {
+		t.Fatalf("Expected a single nearest location, got %d", len(locations))
+	}
+	if locations[0].City != "San Diego" {
+		t.Errorf("Expected San Diego as nearest location, got %s", locations[0].City)
+	}
+
+	// The selected location must be at least as close as every other geocoded site
+	for _, loc := range study.ProtocolSection.ContactsLocationsModule.Locations {
+		if loc.GeoPoint.Lat == 0 && loc.GeoPoint.Lon == 0 {
+			continue
+		}
+		d := haversineMiles(req.Latitude, req.Longitude, loc.GeoPoint.Lat, loc.GeoPoint.Lon)
+		if d < locations[0].Distance {
+			t.Errorf("Location %s (%f mi) is closer than selected %s (%f mi)", loc.City, d, locations[0].City, locations[0].Distance)
+		}
+	}
+}
+
+func TestNearestOnlyWithoutCoordinates(t *testing.T) {
+	client := NewClinicalTrialsClient()
+
+	study := StudyData{}
+	study.ProtocolSection.IdentificationModule.NCTID = "NCT00000002"
+	study.ProtocolSection.ContactsLocationsModule.Locations = []LocationData{
+		{City: "San Diego", GeoPoint: GeoPoint{Lat: 32.7157, Lon: -117.1611}},
+		{City: "Chicago", GeoPoint: GeoPoint{Lat: 41.8781, Lon: -87.6298}},
+	}
+
+	// Without search coordinates the flag has no effect
+	resp := client.convertToSearchResponse(&ClinicalTrialsGovResponse{Studies: []StudyData{study}}, models.SearchRequest{NearestOnly: true})
+	if got := len(resp.Trials[0].Locations); got != 2 {
+		t.Errorf("Expected all locations to be kept without coordinates, got %d", got)
+	}
+}
+
+func TestSortByDistance(t *testing.T) {
+	trials := []models.Trial{
+		{NCTID: "NYC", Locations: []models.Location{{City: "New York", Latitude: 40.7128, Longitude: -74.0060}}},
+		{NCTID: "NONE", Locations: []models.Location{{City: "Unknown"}}},
+		{NCTID: "SD", Locations: []models.Location{
+			{City: "Chicago", Latitude: 41.8781, Longitude: -87.6298},
+			{City: "San Diego", Latitude: 32.7157, Longitude: -117.1611},
+		}},
+		{NCTID: "EMPTY"},
+		{NCTID: "CHI", Locations: []models.Location{{City: "Chicago", Latitude: 41.8781, Longitude: -87.6298}}},
+	}
+
+	// From Los Angeles: San Diego, then Chicago, then New York; ungeocoded trials last in upstream order
+	SortByDistance(trials, 34.0522, -118.2437)
+
+	want := []string{"SD", "CHI", "NYC", "NONE", "EMPTY"}
+	for i, id := range want {
+		if trials[i].NCTID != id {
+			t.Errorf("Position %d: expected %s, got %s", i, id, trials[i].NCTID)
+		}
+	}
+}
+
+func TestDistanceUnits(t *testing.T) {
+	for _, tt := range []struct {
+		distance int
+		units    string
+		want     int
+	}{
+		{50, "", 50},
+		{50, UnitsMiles, 50},
+		{100, UnitsKilometers, 63}, // 62.14 miles, rounded up so the radius never shrinks
+		{161, "KM", 101},
+		{0, UnitsKilometers, 0},
+	} {
+		if got := distanceMiles(tt.distance, tt.units); got != tt.want {
+			t.Errorf("distanceMiles(%d, %q) = %d; expected %d", tt.distance, tt.units, got, tt.want)
+		}
+	}
+
+	if got := ConvertMiles(100, UnitsKilometers); math.Abs(got-160.9344) > 1e-9 {
+		t.Errorf("Expected 100 miles to be 160.9344 km, got %f", got)
+	}
+	if got := ConvertMiles(100, UnitsMiles); got != 100 {
+		t.Errorf("Expected miles to be kept, got %f", got)
+	}
+}
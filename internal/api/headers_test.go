@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/middleware"
+	"github.com/clinical-trials-microservice/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// captureLogs redirects the global logger to a buffer at the given level for the duration of the test
+func captureLogs(t *testing.T, level zerolog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf).Level(level)
+	t.Cleanup(func() { log.Logger = original })
+	return &buf
+}
+
+// findLogEntry returns the first JSON log entry with the given message
+func findLogEntry(buf *bytes.Buffer, message string) map[string]interface{} {
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		if entry["message"] == message {
+			return entry
+		}
+	}
+	return nil
+}
+
+func TestLoggedResponseHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.Header().Set("X-RateLimit-Limit", "50")
+		w.Header().Set("X-RateLimit-Remaining", "49")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Internal-Token", "secret")
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	t.Run("logs only allowlisted headers", func(t *testing.T) {
+		buf := captureLogs(t, zerolog.DebugLevel)
+		client := newTestClient(server.URL, WithLoggedResponseHeaders("retry-after", "X-RateLimit-*"))
+
+		if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+
+		entry := findLogEntry(buf, "Upstream response headers")
+		if entry == nil {
+			t.Fatalf("Expected upstream header log entry, got %s", buf.String())
+		}
+		expected := map[string]interface{}{
+			"Retry-After":           "30",
+			"X-Ratelimit-Limit":     "50",
+			"X-Ratelimit-Remaining": "49",
+		}
+		if !reflect.DeepEqual(entry["response_headers"], expected) {
+			t.Errorf("Expected headers %v, got %v", expected, entry["response_headers"])
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		buf := captureLogs(t, zerolog.DebugLevel)
+		client := newTestClient(server.URL)
+
+		if _, err := client.GetTrialDetails(context.Background(), "NCT00000001"); err != nil {
+			t.Fatalf("GetTrialDetails failed: %v", err)
+		}
+		if entry := findLogEntry(buf, "Upstream response headers"); entry != nil {
+			t.Errorf("Expected no header logging without an allowlist, got %v", entry)
+		}
+	})
+}
+
+func TestUserAgentHeader(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+		if strings.HasSuffix(r.URL.Path, "/NCT00000001") {
+			w.Write([]byte(`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}}}`))
+			return
+		}
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err != nil {
+		t.Fatalf("SearchTrials failed: %v", err)
+	}
+	if _, err := client.GetTrialDetails(context.Background(), "NCT00000001"); err != nil {
+		t.Fatalf("GetTrialDetails failed: %v", err)
+	}
+	for _, ua := range got {
+		if ua != DefaultUserAgent() || !strings.Contains(ua, ServiceContactURL) {
+			t.Errorf("Expected default User-Agent %q, got %q", DefaultUserAgent(), ua)
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 upstream requests, got %d", len(got))
+	}
+
+	got = nil
+	client = newTestClient(server.URL, WithUserAgent("trials-test/1.0 (+https://example.org)"))
+	if _, err := client.SearchTrials(context.Background(), models.SearchRequest{}); err != nil {
+		t.Fatalf("SearchTrials failed: %v", err)
+	}
+	if len(got) != 1 || got[0] != "trials-test/1.0 (+https://example.org)" {
+		t.Errorf("Expected configured User-Agent, got %v", got)
+	}
+}
+
+func TestUpstreamLogsIncludeRequestID(t *testing.T) {
+	buf := captureLogs(t, zerolog.InfoLevel)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[],"totalCount":0}`))
+	}))
+	defer server.Close()
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey{}, "req-123")
+	if _, err := newTestClient(server.URL).SearchTrials(ctx, models.SearchRequest{}); err != nil {
+		t.Fatalf("SearchTrials failed: %v", err)
+	}
+
+	entry := findLogEntry(buf, "External API call completed")
+	if entry == nil {
+		t.Fatalf("Expected upstream call log, got %s", buf.String())
+	}
+	if entry["request_id"] != "req-123" {
+		t.Errorf("Expected request_id on upstream log, got %v", entry["request_id"])
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultHighlightPre is inserted before each highlighted term
+	DefaultHighlightPre = "<em>"
+	// DefaultHighlightPost is inserted after each highlighted term
+	DefaultHighlightPost = "</em>"
+)
+
+// isWordRune reports whether r is part of a word for matching purposes
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// HighlightTerms wraps whole-word, case-insensitive occurrences of the query tokens in text
+// with pre and post. Only complete words match, so "cord" never highlights part of "cordless",
+// and consecutive matched words are wrapped individually.
+func HighlightTerms(text, query, pre, post string) string {
+	tokens := make(map[string]bool)
+	for _, token := range queryTokens(query) {
+		tokens[token] = true
+	}
+	if len(tokens) == 0 || text == "" {
+		return text
+	}
+
+	var b strings.Builder
+	wordStart := -1
+	flush := func(end int) {
+		word := text[wordStart:end]
+		if tokens[strings.ToLower(word)] {
+			b.WriteString(pre)
+			b.WriteString(word)
+			b.WriteString(post)
+		} else {
+			b.WriteString(word)
+		}
+		wordStart = -1
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if isWordRune(r) {
+			if wordStart < 0 {
+				wordStart = i
+			}
+		} else {
+			if wordStart >= 0 {
+				flush(i)
+			}
+			b.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+	if wordStart >= 0 {
+		flush(len(text))
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package api
+
+import "testing"
+
+func TestHighlightTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{
+			name:  "multi-term query",
+			text:  "Epidural Stimulation for Spinal Cord Injury",
+			query: "spinal cord injury OR stimulation",
+			want:  "Epidural <em>Stimulation</em> for <em>Spinal</em> <em>Cord</em> <em>Injury</em>",
+		},
+		{
+			name:  "no partial-word matches",
+			text:  "Cordless spinal-cord devices; injury-free injuries",
+			query: "cord injury",
+			want:  "Cordless spinal-<em>cord</em> devices; <em>injury</em>-free injuries",
+		},
+		{
+			name:  "overlapping and repeated terms are wrapped once each",
+			text:  "cord cord, CORD",
+			query: "cord Cord cord",
+			want:  "<em>cord</em> <em>cord</em>, <em>CORD</em>",
+		},
+		{
+			name:  "stop words and operators are ignored",
+			text:  "Walking and standing or sitting",
+			query: "walking AND standing",
+			want:  "<em>Walking</em> and <em>standing</em> or sitting",
+		},
+		{
+			name:  "unicode words",
+			text:  "Lesão medular traumática",
+			query: "lesão",
+			want:  "<em>Lesão</em> medular traumática",
+		},
+		{
+			name:  "empty query leaves text unchanged",
+			text:  "Spinal cord injury",
+			query: "",
+			want:  "Spinal cord injury",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HighlightTerms(tt.text, tt.query, DefaultHighlightPre, DefaultHighlightPost)
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHighlightTermsCustomDelimiters(t *testing.T) {
+	got := HighlightTerms("Spinal cord injury", "injury", "**", "**")
+	if got != "Spinal cord **injury**" {
+		t.Errorf("Expected custom delimiters, got %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// ErrTrialNotFound is returned when the upstream has no record for the requested trial
+var ErrTrialNotFound = errors.New("trial not found")
+
+// historyResponse is the upstream record history of a study
+type historyResponse struct {
+	Changes []historyChange `json:"changes"`
+}
+
+// historyChange is one version of a study record
+type historyChange struct {
+	Version      int      `json:"version"`
+	Date         string   `json:"date,omitempty"`
+	Status       string   `json:"status,omitempty"`
+	ModuleLabels []string `json:"moduleLabels,omitempty"` // Sections changed in this version
+}
+
+// GetTrialHistory retrieves the versions of a trial's ClinicalTrials.gov record, oldest first
+func (c *ClinicalTrialsClient) GetTrialHistory(ctx context.Context, nctID string) (*models.TrialHistory, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	if !c.breaker.allow() {
+		logger := upstreamLogger(ctx).Logger()
+		logger.Warn().
+			Str("api", "clinicaltrials.gov").
+			Str("nct_id", nctID).
+			Msg("Upstream circuit breaker open, failing fast")
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	c.rateLimit()
+
+	fullURL := fmt.Sprintf("%s/%s/history", c.historyURL, nctID)
+	baseLogger := upstreamLogger(ctx).
+		Str("api", "clinicaltrials.gov").
+		Str("method", "GET").
+		Str("nct_id", nctID).
+		Str("url", fullURL).
+		Logger()
+
+	resp, err := c.get(ctx, fullURL)
+	duration := time.Since(start)
+	c.recordUpstreamResult(ctx, resp, err)
+	if err != nil {
+		baseLogger.Error().
+			Err(err).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("External API call failed")
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	c.logResponseHeaders(baseLogger, resp)
+
+	if resp.StatusCode == http.StatusNotFound {
+		baseLogger.Warn().
+			Int("status_code", resp.StatusCode).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("Trial history not found in external API")
+		return nil, fmt.Errorf("%w: %s", ErrTrialNotFound, nctID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		baseLogger.Error().
+			Int("status_code", resp.StatusCode).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("External API returned error status")
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		baseLogger.Error().
+			Err(err).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("Failed to read external API response")
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var history historyResponse
+	if err := json.Unmarshal(body, &history); err != nil {
+		withDecodeDiagnostics(baseLogger.Error(), body, err).
+			Err(err).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("Failed to decode external API response")
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	baseLogger.Info().
+		Int("status_code", resp.StatusCode).
+		Int("versions", len(history.Changes)).
+		Int64("duration_ms", duration.Milliseconds()).
+		Msg("External API call completed")
+
+	result := &models.TrialHistory{
+		NCTID:    nctID,
+		Versions: make([]models.TrialVersion, 0, len(history.Changes)),
+	}
+	for _, change := range history.Changes {
+		result.Versions = append(result.Versions, models.TrialVersion{
+			Version:        change.Version,
+			Date:           change.Date,
+			Status:         change.Status,
+			ChangedModules: change.ModuleLabels,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+const mockHistoryPayload = `{"changes":[
+	{"version":0,"date":"2021-03-10","status":"NOT_YET_RECRUITING","moduleLabels":["Study Identification","Study Status","Eligibility"]},
+	{"version":1,"date":"2021-06-02","status":"RECRUITING","moduleLabels":["Study Status","Contacts/Locations"]},
+	{"version":2,"date":"2023-01-15","status":"COMPLETED","moduleLabels":["Study Status"]}]}`
+
+func TestGetTrialHistory(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.URL.Path != "/NCT00000001/history" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(mockHistoryPayload))
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL)
+
+	history, err := client.GetTrialHistory(context.Background(), "NCT00000001")
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	want := &models.TrialHistory{NCTID: "NCT00000001", Versions: []models.TrialVersion{
+		{Version: 0, Date: "2021-03-10", Status: "NOT_YET_RECRUITING", ChangedModules: []string{"Study Identification", "Study Status", "Eligibility"}},
+		{Version: 1, Date: "2021-06-02", Status: "RECRUITING", ChangedModules: []string{"Study Status", "Contacts/Locations"}},
+		{Version: 2, Date: "2023-01-15", Status: "COMPLETED", ChangedModules: []string{"Study Status"}},
+	}}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("Expected history %+v, got %+v", want, history)
+	}
+
+	if _, err := client.GetTrialHistory(context.Background(), "NCT99999999"); !errors.Is(err, ErrTrialNotFound) {
+		t.Errorf("Expected ErrTrialNotFound for an unknown trial, got %v", err)
+	}
+	if path != "/NCT99999999/history" {
+		t.Errorf("Expected the history path under the base URL, got %q", path)
+	}
+}
+
+func TestGetTrialHistoryUpstreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(server.URL).GetTrialHistory(context.Background(), "NCT00000001")
+	if err == nil || errors.Is(err, ErrTrialNotFound) {
+		t.Errorf("Expected an upstream error distinct from not found, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// ICTRPClient handles interactions with the WHO ICTRP XML web service.
+// Access to the service requires an agreement with the WHO Secretariat, so there is no
+// default endpoint; the partner-provided URL is passed to NewICTRPClient.
+type ICTRPClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewICTRPClient creates a new WHO ICTRP client for the given web service URL
+func NewICTRPClient(baseURL string) *ICTRPClient {
+	return &ICTRPClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns the registry identifier for WHO ICTRP
+func (c *ICTRPClient) Name() string {
+	return RegistryICTRP
+}
+
+// ICTRPResponse represents the ICTRP XML export structure
+type ICTRPResponse struct {
+	XMLName xml.Name     `xml:"Trials_downloaded_from_ICTRP"`
+	Trials  []ICTRPTrial `xml:"Trial"`
+}
+
+// ICTRPTrial represents a trial in the ICTRP XML export
+type ICTRPTrial struct {
+	TrialID           string `xml:"TrialID"`
+	PublicTitle       string `xml:"Public_title"`
+	ScientificTitle   string `xml:"Scientific_title"`
+	PrimarySponsor    string `xml:"Primary_sponsor"`
+	SourceRegister    string `xml:"Source_Register"`
+	WebAddress        string `xml:"web_address"`
+	RecruitmentStatus string `xml:"Recruitment_Status"`
+	InclusionAgeMin   string `xml:"Inclusion_agemin"`
+	InclusionAgeMax   string `xml:"Inclusion_agemax"`
+	InclusionGender   string `xml:"Inclusion_gender"`
+	DateEnrollment    string `xml:"Date_enrollement"` // ICTRP's spelling
+	Phase             string `xml:"Phase"`
+	Countries         string `xml:"Countries"`
+	ContactFirstname  string `xml:"Contact_Firstname"`
+	ContactLastname   string `xml:"Contact_Lastname"`
+	ContactEmail      string `xml:"Contact_Email"`
+	ContactTel        string `xml:"Contact_Tel"`
+	InclusionCriteria string `xml:"Inclusion_Criteria"`
+	ExclusionCriteria string `xml:"Exclusion_Criteria"`
+	Condition         string `xml:"Condition"`
+	SecondaryID       string `xml:"Secondary_ID"`
+}
+
+// Search searches ICTRP for trials matching the request's conditions and recruitment status
+func (c *ICTRPClient) Search(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	params := url.Values{}
+	switch {
+	case len(req.Conditions) > 0:
+		params.Set("condition", JoinConditions(req.Conditions, req.ConditionLogic))
+	case req.Query != "":
+		params.Set("condition", req.Query)
+	default:
+		params.Set("condition", DefaultConditionQuery)
+	}
+	// ICTRP only distinguishes recruiting from not recruiting; the default status filter is recruiting
+	if len(req.Status) == 0 || containsPhase(req.Status, "RECRUITING") {
+		params.Set("recruiting", "true")
+	}
+
+	icResp, err := c.fetch(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	exactTerms := exactConditionTerms(req)
+	trials := make([]models.Trial, 0, len(icResp.Trials))
+	for _, icTrial := range icResp.Trials {
+		trial := convertICTRPTrial(icTrial)
+		if excludesInactive(trial.Status, req) {
+			continue
+		}
+		if exactTerms != nil && !matchesConditionsExactly(trial.Conditions, exactTerms, req.ConditionLogic) {
+			continue
+		}
+		if req.HasContact && !hasContact(trial.Contacts, req.ContactType) {
+			continue
+		}
+		if !matchesDateRanges(trial, req) {
+			continue
+		}
+		trials = append(trials, trial)
+	}
+	filtered := len(trials) < len(icResp.Trials)
+	if req.PageSize > 0 && len(trials) > req.PageSize {
+		trials = trials[:req.PageSize]
+	}
+
+	response := &models.SearchResponse{
+		Trials:     trials,
+		TotalCount: len(trials),
+		PageSize:   len(trials),
+	}
+	if filtered {
+		response.FilteringNotice = FilteringNotice
+	}
+	return response, nil
+}
+
+// GetByID retrieves a single trial by its ICTRP trial ID (e.g. RBR-xxxxxx, ISRCTN..., NCT...)
+func (c *ICTRPClient) GetByID(ctx context.Context, id string) (*models.Trial, error) {
+	params := url.Values{}
+	params.Set("TrialID", id)
+
+	icResp, err := c.fetch(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, icTrial := range icResp.Trials {
+		if strings.EqualFold(strings.TrimSpace(icTrial.TrialID), id) {
+			trial := convertICTRPTrial(icTrial)
+			return &trial, nil
+		}
+	}
+	return nil, fmt.Errorf("trial not found: %s", id)
+}
+
+// fetch calls the ICTRP web service and decodes the XML response
+func (c *ICTRPClient) fetch(ctx context.Context, params url.Values) (*ICTRPResponse, error) {
+	start := time.Now()
+	fullURL := fmt.Sprintf("%s?%s", c.baseURL, params.Encode())
+
+	// Log outbound API call
+	baseLogger := upstreamLogger(ctx).
+		Str("api", RegistryICTRP).
+		Str("method", "GET").
+		Str("url", fullURL).
+		Logger()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	httpReq, span := startUpstreamSpan(ctx, RegistryICTRP, httpReq)
+	resp, err := c.httpClient.Do(httpReq)
+	endUpstreamSpan(span, resp, err)
+	duration := time.Since(start)
+
+	if err != nil {
+		baseLogger.Error().
+			Err(err).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("External API call failed")
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		baseLogger.Error().
+			Int("status_code", resp.StatusCode).
+			Int64("duration_ms", duration.Milliseconds()).
+			Str("response_body", string(body)).
+			Msg("External API returned error status")
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var icResp ICTRPResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&icResp); err != nil {
+		baseLogger.Error().
+			Err(err).
+			Int("status_code", resp.StatusCode).
+			Int64("duration_ms", duration.Milliseconds()).
+			Msg("Failed to decode external API response")
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	baseLogger.Info().
+		Int("status_code", resp.StatusCode).
+		Int64("duration_ms", duration.Milliseconds()).
+		Int("studies_returned", len(icResp.Trials)).
+		Msg("External API call completed")
+
+	return &icResp, nil
+}
+
+// ictrpListSeparator matches the separators ICTRP uses in multi-valued text fields
+var ictrpListSeparator = regexp.MustCompile(`(?i);|<br\s*/?>`)
+
+// splitICTRPList splits a multi-valued ICTRP field into trimmed, non-empty values
+func splitICTRPList(value string) []string {
+	var values []string
+	for _, part := range ictrpListSeparator.Split(value, -1) {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// ictrpPhasePattern extracts phase numbers from ICTRP phase text such as "Phase 2/Phase 3"
+var ictrpPhasePattern = regexp.MustCompile(`(?i)phase\s*([0-4])`)
+
+// normalizeICTRPPhases maps ICTRP phase text to ClinicalTrials.gov phase values (PHASE1..PHASE4, NA)
+func normalizeICTRPPhases(phase string) []string {
+	phase = strings.TrimSpace(phase)
+	if phase == "" {
+		return nil
+	}
+	var phases []string
+	for _, match := range ictrpPhasePattern.FindAllStringSubmatch(phase, -1) {
+		phases = append(phases, "PHASE"+match[1])
+	}
+	if len(phases) == 0 {
+		lower := strings.ToLower(phase)
+		if strings.Contains(lower, "not applicable") || lower == "n/a" || lower == "na" {
+			return []string{"NA"}
+		}
+	}
+	return phases
+}
+
+// normalizeICTRPStatus maps ICTRP recruitment status text to an upper-snake-case status
+func normalizeICTRPStatus(status string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "":
+		return ""
+	case "recruiting":
+		return "RECRUITING"
+	case "not recruiting":
+		return "NOT_RECRUITING"
+	default:
+		return strings.ToUpper(strings.Join(strings.Fields(status), "_"))
+	}
+}
+
+// normalizeICTRPDate converts ICTRP's dd/mm/yyyy dates to ISO 8601, leaving other formats as-is
+func normalizeICTRPDate(date string) string {
+	date = strings.TrimSpace(date)
+	if parsed, err := time.Parse("02/01/2006", date); err == nil {
+		return parsed.Format("2006-01-02")
+	}
+	return date
+}
+
+// convertICTRPTrial converts an ICTRP trial to our Trial model
+func convertICTRPTrial(icTrial ICTRPTrial) models.Trial {
+	id := strings.TrimSpace(icTrial.TrialID)
+	trial := models.Trial{
+		NCTID:      id,
+		Title:      strings.TrimSpace(icTrial.PublicTitle),
+		Status:     normalizeICTRPStatus(icTrial.RecruitmentStatus),
+		Phase:      normalizeICTRPPhases(icTrial.Phase),
+		Conditions: splitICTRPList(icTrial.Condition),
+		StartDate:  normalizeICTRPDate(icTrial.DateEnrollment),
+		URL:        strings.TrimSpace(icTrial.WebAddress),
+		Registry:   RegistryICTRP,
+	}
+	if trial.Title == "" {
+		trial.Title = strings.TrimSpace(icTrial.ScientificTitle)
+	}
+
+	// Eligibility
+	trial.Eligibility.MinimumAge = strings.TrimSpace(icTrial.InclusionAgeMin)
+	trial.Eligibility.MaximumAge = strings.TrimSpace(icTrial.InclusionAgeMax)
+	setAgeYears(&trial.Eligibility)
+	trial.Eligibility.Gender = strings.TrimSpace(icTrial.InclusionGender)
+	inclusion := strings.TrimSpace(icTrial.InclusionCriteria)
+	exclusion := strings.TrimSpace(icTrial.ExclusionCriteria)
+	if inclusion != "" || exclusion != "" {
+		trial.Eligibility.Criteria = fmt.Sprintf("Inclusion Criteria:\n%s\n\nExclusion Criteria:\n%s", inclusion, exclusion)
+		trial.Eligibility.Inclusion, trial.Eligibility.Exclusion = ParseEligibilityCriteria(trial.Eligibility.Criteria)
+	}
+
+	// Locations (ICTRP only provides recruitment countries)
+	for _, country := range splitICTRPList(icTrial.Countries) {
+		trial.Locations = append(trial.Locations, models.Location{Country: country})
+	}
+
+	// Contacts
+	name := strings.TrimSpace(strings.TrimSpace(icTrial.ContactFirstname) + " " + strings.TrimSpace(icTrial.ContactLastname))
+	if name != "" || icTrial.ContactEmail != "" || icTrial.ContactTel != "" {
+		trial.Contacts = []models.Contact{{
+			Name:  name,
+			Phone: strings.TrimSpace(icTrial.ContactTel),
+			Email: strings.TrimSpace(icTrial.ContactEmail),
+		}}
+	}
+
+	// Sponsor
+	if sponsor := strings.TrimSpace(icTrial.PrimarySponsor); sponsor != "" {
+		trial.Sponsor = models.Sponsor{Name: sponsor}
+	}
+
+	// Secondary IDs (ICTRP does not type them; they are usually other registrations of the same trial)
+	for _, id := range splitICTRPList(icTrial.SecondaryID) {
+		trial.SecondaryIDs = append(trial.SecondaryIDs, models.SecondaryID{ID: id})
+	}
+
+	// Keep the primary register the record came from (ICTRP aggregates many registries)
+	if source := strings.TrimSpace(icTrial.SourceRegister); source != "" {
+		trial.AdditionalData = map[string]interface{}{"source_register": source}
+	}
+
+	return trial
+}
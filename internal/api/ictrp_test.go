@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+const ictrpSampleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Trials_downloaded_from_ICTRP>
+  <Trial>
+    <TrialID>RBR-7abc12</TrialID>
+    <Public_title>Robotic gait training after spinal cord injury</Public_title>
+    <Scientific_title>Effects of robotic gait training in incomplete SCI</Scientific_title>
+    <Primary_sponsor>Universidade de Sao Paulo</Primary_sponsor>
+    <Source_Register>REBEC</Source_Register>
+    <web_address>https://ensaiosclinicos.gov.br/rg/RBR-7abc12</web_address>
+    <Recruitment_Status>Recruiting</Recruitment_Status>
+    <Inclusion_agemin>18Y</Inclusion_agemin>
+    <Inclusion_agemax>60Y</Inclusion_agemax>
+    <Inclusion_gender>Both</Inclusion_gender>
+    <Date_enrollement>15/03/2024</Date_enrollement>
+    <Phase>Phase 2/Phase 3</Phase>
+    <Countries>Brazil;Argentina</Countries>
+    <Contact_Firstname>Maria</Contact_Firstname>
+    <Contact_Lastname>Silva</Contact_Lastname>
+    <Contact_Email>maria@example.org</Contact_Email>
+    <Contact_Tel>+55 11 5555-0000</Contact_Tel>
+    <Inclusion_Criteria>Incomplete SCI</Inclusion_Criteria>
+    <Exclusion_Criteria>Pressure ulcers</Exclusion_Criteria>
+    <Condition>Spinal Cord Injuries;Paraplegia&lt;br&gt;Tetraplegia</Condition>
+  </Trial>
+  <Trial>
+    <TrialID>ISRCTN12345678</TrialID>
+    <Public_title></Public_title>
+    <Scientific_title>Stem cells in chronic SCI</Scientific_title>
+    <Recruitment_Status>Not recruiting</Recruitment_Status>
+    <Phase>Not applicable</Phase>
+    <Secondary_ID>NCT04567890;2020-001234-56</Secondary_ID>
+  </Trial>
+</Trials_downloaded_from_ICTRP>`
+
+func TestICTRPSearchMapping(t *testing.T) {
+	var gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(ictrpSampleXML))
+	}))
+	defer server.Close()
+
+	var registry Registry = NewICTRPClient(server.URL)
+	if registry.Name() != RegistryICTRP {
+		t.Errorf("Expected registry name %s, got %s", RegistryICTRP, registry.Name())
+	}
+
+	resp, err := registry.Search(context.Background(), models.SearchRequest{Conditions: []string{"spinal cord injury"}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if gotQuery != "condition=spinal+cord+injury&recruiting=true" {
+		t.Errorf("Unexpected upstream query: %s", gotQuery)
+	}
+	if len(resp.Trials) != 2 {
+		t.Fatalf("Expected 2 trials, got %d", len(resp.Trials))
+	}
+
+	trial := resp.Trials[0]
+	expected := models.Trial{
+		NCTID:      "RBR-7abc12",
+		Title:      "Robotic gait training after spinal cord injury",
+		Status:     "RECRUITING",
+		Phase:      []string{"PHASE2", "PHASE3"},
+		Conditions: []string{"Spinal Cord Injuries", "Paraplegia", "Tetraplegia"},
+		Locations:  []models.Location{{Country: "Brazil"}, {Country: "Argentina"}},
+		Eligibility: models.Eligibility{
+			MinimumAge:      "18Y",
+			MaximumAge:      "60Y",
+			MinimumAgeYears: 18,
+			MaximumAgeYears: 60,
+			Gender:          "Both",
+			Criteria:        "Inclusion Criteria:\nIncomplete SCI\n\nExclusion Criteria:\nPressure ulcers",
+			Inclusion:       []string{"Incomplete SCI"},
+			Exclusion:       []string{"Pressure ulcers"},
+		},
+		Sponsor:        models.Sponsor{Name: "Universidade de Sao Paulo"},
+		Contacts:       []models.Contact{{Name: "Maria Silva", Phone: "+55 11 5555-0000", Email: "maria@example.org"}},
+		StartDate:      "2024-03-15",
+		URL:            "https://ensaiosclinicos.gov.br/rg/RBR-7abc12",
+		Registry:       RegistryICTRP,
+		AdditionalData: map[string]interface{}{"source_register": "REBEC"},
+	}
+	if !reflect.DeepEqual(trial, expected) {
+		t.Errorf("Unexpected mapping:\n got: %+v\nwant: %+v", trial, expected)
+	}
+
+	// Scientific title is used when there is no public title
+	second := resp.Trials[1]
+	if second.Title != "Stem cells in chronic SCI" || second.Status != "NOT_RECRUITING" {
+		t.Errorf("Unexpected title/status fallback: %+v", second)
+	}
+	if !reflect.DeepEqual(second.Phase, []string{"NA"}) {
+		t.Errorf("Expected NA phase, got %v", second.Phase)
+	}
+	wantSecondary := []models.SecondaryID{{ID: "NCT04567890"}, {ID: "2020-001234-56"}}
+	if !reflect.DeepEqual(second.SecondaryIDs, wantSecondary) {
+		t.Errorf("Expected secondary IDs %v, got %v", wantSecondary, second.SecondaryIDs)
+	}
+}
+
+func TestICTRPGetByID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ictrpSampleXML))
+	}))
+	defer server.Close()
+
+	client := NewICTRPClient(server.URL)
+
+	trial, err := client.GetByID(context.Background(), "ISRCTN12345678")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if trial.NCTID != "ISRCTN12345678" || trial.Registry != RegistryICTRP {
+		t.Errorf("Unexpected trial: %+v", trial)
+	}
+
+	if _, err := client.GetByID(context.Background(), "RBR-missing"); err == nil {
+		t.Error("Expected not found error for unknown trial ID")
+	}
+}
+
+func TestClinicalTrialsClientImplementsRegistry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}}}],"totalCount":1}`))
+	}))
+	defer server.Close()
+
+	var registry Registry = newTestClient(server.URL)
+	if registry.Name() != RegistryClinicalTrialsGov {
+		t.Errorf("Expected registry name %s, got %s", RegistryClinicalTrialsGov, registry.Name())
+	}
+
+	resp, err := registry.Search(context.Background(), models.SearchRequest{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(resp.Trials) != 1 || resp.Trials[0].Registry != RegistryClinicalTrialsGov {
+		t.Errorf("Expected one clinicaltrials.gov trial, got %+v", resp.Trials)
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// mockStudiesJSON holds the synthetic studies served in mock mode, in the upstream response format
+//
+//go:embed fixtures/mock_studies.json
+var mockStudiesJSON []byte
+
+// WithMockUpstream serves ClinicalTrials.gov requests from embedded synthetic studies instead of
+// the network, for load tests and demos. Only the transport is replaced: queries are still built,
+// decoded, filtered, sorted and paginated by the real client code. Rate limiting is disabled.
+func WithMockUpstream() Option {
+	return func(c *ClinicalTrialsClient) {
+		c.httpClient = &http.Client{Transport: newMockTransport()}
+		c.minDelay = 0
+	}
+}
+
+// mockStudy is a fixture study together with the fields the mock upstream filters on
+type mockStudy struct {
+	raw   json.RawMessage
+	study StudyData
+}
+
+// mockTransport answers upstream search and get-by-ID requests from the fixture studies.
+// It applies the filters the real upstream applies server-side (conditions, status, geo
+// distance and pagination); advanced query.term expressions are not evaluated.
+type mockTransport struct {
+	studies []mockStudy
+}
+
+// newMockTransport loads the embedded fixtures; they are part of the binary, so failing to
+// decode them is a programming error
+func newMockTransport() *mockTransport {
+	var fixtures struct {
+		Studies []json.RawMessage `json:"studies"`
+	}
+	if err := json.Unmarshal(mockStudiesJSON, &fixtures); err != nil {
+		panic("invalid mock fixtures: " + err.Error())
+	}
+	t := &mockTransport{}
+	for _, raw := range fixtures.Studies {
+		var study StudyData
+		if err := json.Unmarshal(raw, &study); err != nil {
+			panic("invalid mock fixture study: " + err.Error())
+		}
+		t.studies = append(t.studies, mockStudy{raw: raw, study: study})
+	}
+	return t
+}
+
+// RoundTrip serves /studies searches, /studies/{nct_id} lookups and /studies/{nct_id}/history
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	if path == "" || strings.HasSuffix(path, "/studies") {
+		return t.search(req)
+	}
+	path, history := strings.CutSuffix(path, "/history")
+	id := path[strings.LastIndex(path, "/")+1:]
+	for _, s := range t.studies {
+		if strings.EqualFold(s.study.ProtocolSection.IdentificationModule.NCTID, id) {
+			if history {
+				return mockHistory(req, s.study)
+			}
+			return mockResponse(req, http.StatusOK, s.raw), nil
+		}
+	}
+	return mockResponse(req, http.StatusNotFound, []byte(fmt.Sprintf("study %s not found", id))), nil
+}
+
+// mockHistory answers a record history request with a single version holding the
+// fixture's current status
+func mockHistory(req *http.Request, study StudyData) (*http.Response, error) {
+	body, err := json.Marshal(historyResponse{Changes: []historyChange{{
+		Version: 0,
+		Date:    study.ProtocolSection.StatusModule.LastUpdatePostDate.Date,
+		Status:  study.ProtocolSection.StatusModule.OverallStatus,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return mockResponse(req, http.StatusOK, body), nil
+}
+
+// search filters the fixtures like the upstream would and returns one page of them.
+// Page tokens are the decimal offset of the page's first study.
+func (t *mockTransport) search(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+
+	var matched []json.RawMessage
+	for _, s := range t.studies {
+		if mockMatches(s.study, query.Get("query.cond"), query.Get("filter.overallStatus"), query.Get("filter.geo")) {
+			matched = append(matched, s.raw)
+		}
+	}
+
+	pageSize, err := strconv.Atoi(query.Get("pageSize"))
+	if err != nil || pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	offset := 0
+	if token := query.Get("pageToken"); token != "" {
+		offset, err = strconv.Atoi(token)
+		if err != nil || offset < 0 || offset > len(matched) {
+			return mockResponse(req, http.StatusBadRequest, []byte("invalid pageToken")), nil
+		}
+	}
+	end := min(offset+pageSize, len(matched))
+
+	page := struct {
+		Studies       []json.RawMessage `json:"studies"`
+		NextPageToken string            `json:"nextPageToken,omitempty"`
+		TotalCount    int               `json:"totalCount"`
+	}{Studies: matched[offset:end], TotalCount: len(matched)}
+	if end < len(matched) {
+		page.NextPageToken = strconv.Itoa(end)
+	}
+	body, err := json.Marshal(page)
+	if err != nil {
+		return nil, err
+	}
+	return mockResponse(req, http.StatusOK, body), nil
+}
+
+// mockMatches applies the upstream-side condition, status and geo filters to a fixture study.
+// Conditions are "a OR b" or "(a) AND (b)" expressions matched as substrings of the study's
+// conditions and title.
+func mockMatches(study StudyData, cond, statuses, geo string) bool {
+	if statuses != "" && !containsPhase(strings.Split(statuses, ","), study.ProtocolSection.StatusModule.OverallStatus) {
+		return false
+	}
+
+	if cond != "" {
+		text := strings.ToLower(study.ProtocolSection.IdentificationModule.BriefTitle + "\n" +
+			strings.Join(study.ProtocolSection.ConditionsModule.Conditions, "\n"))
+		for _, group := range strings.Split(cond, " AND ") {
+			found := false
+			for _, term := range strings.Split(strings.Trim(group, "()"), " OR ") {
+				if term = strings.ToLower(strings.TrimSpace(term)); term != "" && strings.Contains(text, term) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	if geo != "" {
+		var lat, lon float64
+		var miles int
+		if _, err := fmt.Sscanf(geo, "distance(%f,%f,%dmi)", &lat, &lon, &miles); err != nil {
+			return false
+		}
+		for _, loc := range study.ProtocolSection.ContactsLocationsModule.Locations {
+			if (loc.GeoPoint.Lat != 0 || loc.GeoPoint.Lon != 0) &&
+				haversineMiles(lat, lon, loc.GeoPoint.Lat, loc.GeoPoint.Lon) <= float64(miles) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// mockResponse builds an upstream response for the mock transport
+func mockResponse(req *http.Request, status int, body []byte) *http.Response {
+	contentType := "application/json"
+	if status != http.StatusOK {
+		contentType = "text/plain"
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
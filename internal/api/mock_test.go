@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestMockUpstream(t *testing.T) {
+	client := NewClinicalTrialsClient(WithMockUpstream())
+	ctx := context.Background()
+	ids := func(resp *models.SearchResponse) []string {
+		got := make([]string, 0, len(resp.Trials))
+		for _, trial := range resp.Trials {
+			got = append(got, trial.NCTID)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name string
+		req  models.SearchRequest
+		want []string
+	}{
+		{"default recruiting SCI search", models.SearchRequest{},
+			[]string{"NCT90000001", "NCT90000002", "NCT90000003", "NCT90000004", "NCT90000007", "NCT90000008"}},
+		{"conditions", models.SearchRequest{Conditions: []string{"paraplegia"}}, []string{"NCT90000003"}},
+		{"conditions AND", models.SearchRequest{Conditions: []string{"tetraplegia", "neuropathic pain"}, ConditionLogic: ConditionLogicAnd},
+			[]string{"NCT90000008"}},
+		{"status with inactive", models.SearchRequest{Status: []string{"COMPLETED", "TERMINATED"}},
+			[]string{"NCT90000005", "NCT90000006"}},
+		{"client-side phase filter", models.SearchRequest{Phase: []string{"PHASE2"}},
+			[]string{"NCT90000001", "NCT90000002", "NCT90000008"}},
+		{"client-side age filter", models.SearchRequest{Age: 10}, []string{"NCT90000007"}},
+		{"client-side country filter", models.SearchRequest{Country: "Brazil"}, []string{"NCT90000003", "NCT90000008"}},
+		{"geo distance", models.SearchRequest{Latitude: 42.36, Longitude: -71.06, Distance: 10},
+			[]string{"NCT90000001", "NCT90000007"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.SearchTrials(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("SearchTrials failed: %v", err)
+			}
+			if got := ids(resp); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var got []string
+		req := models.SearchRequest{PageSize: 4}
+		for pages := 0; pages < 5; pages++ {
+			resp, err := client.SearchTrials(ctx, req)
+			if err != nil {
+				t.Fatalf("SearchTrials failed: %v", err)
+			}
+			got = append(got, ids(resp)...)
+			if resp.NextPageToken == "" {
+				break
+			}
+			req.PageToken = resp.NextPageToken
+		}
+		if len(got) != 6 {
+			t.Errorf("Expected 6 trials across pages, got %v", got)
+		}
+	})
+
+	t.Run("invalid page token", func(t *testing.T) {
+		if _, err := client.SearchTrials(ctx, models.SearchRequest{PageToken: "bogus"}); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("Expected ErrInvalidPageToken, got %v", err)
+		}
+	})
+
+	t.Run("get by id", func(t *testing.T) {
+		trial, err := client.GetTrialDetails(ctx, "NCT90000006")
+		if err != nil {
+			t.Fatalf("GetTrialDetails failed: %v", err)
+		}
+		if trial.Status != "TERMINATED" || trial.WhyStopped != "Sponsor decision" || trial.Raw == nil {
+			t.Errorf("Expected the terminated fixture with its raw study, got %+v", trial)
+		}
+		if _, err := client.GetTrialDetails(ctx, "NCT00000000"); err == nil {
+			t.Error("Expected an error for an unknown NCT ID")
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		history, err := client.GetTrialHistory(ctx, "NCT90000006")
+		if err != nil {
+			t.Fatalf("GetTrialHistory failed: %v", err)
+		}
+		if len(history.Versions) != 1 || history.Versions[0].Status != "TERMINATED" {
+			t.Errorf("Expected one version with the fixture status, got %+v", history.Versions)
+		}
+		if _, err := client.GetTrialHistory(ctx, "NCT00000000"); !errors.Is(err, ErrTrialNotFound) {
+			t.Errorf("Expected ErrTrialNotFound for an unknown NCT ID, got %v", err)
+		}
+	})
+}
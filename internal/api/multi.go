@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// RegistryAll identifies the combined search across every configured registry
+const RegistryAll = "all"
+
+// MultiRegistry fans out to several registries concurrently and merges their results,
+// deduplicating trials that are cross-registered under the same identifiers.
+type MultiRegistry struct {
+	registries []Registry
+}
+
+// NewMultiRegistry creates a combined registry; earlier registries take precedence when merging duplicates
+func NewMultiRegistry(registries ...Registry) *MultiRegistry {
+	return &MultiRegistry{registries: registries}
+}
+
+// Name returns the registry identifier for the combined search
+func (m *MultiRegistry) Name() string {
+	return RegistryAll
+}
+
+// Search queries all registries concurrently and merges the results.
+// Registries that fail are logged and skipped; an error is returned only if all of them fail.
+// Pagination tokens are registry-specific, so merged responses never carry a next page token.
+func (m *MultiRegistry) Search(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	responses := make([]*models.SearchResponse, len(m.registries))
+	errs := make([]error, len(m.registries))
+
+	var wg sync.WaitGroup
+	for i, registry := range m.registries {
+		wg.Add(1)
+		go func(i int, registry Registry) {
+			defer wg.Done()
+			responses[i], errs[i] = registry.Search(ctx, req)
+		}(i, registry)
+	}
+	wg.Wait()
+
+	succeeded := make([]*models.SearchResponse, 0, len(responses))
+	var failures []string
+	for i, resp := range responses {
+		if errs[i] != nil {
+			logger := upstreamLogger(ctx).Logger()
+			logger.Warn().
+				Err(errs[i]).
+				Str("registry", m.registries[i].Name()).
+				Msg("Registry search failed, continuing with remaining registries")
+			failures = append(failures, fmt.Sprintf("%s: %v", m.registries[i].Name(), errs[i]))
+			continue
+		}
+		succeeded = append(succeeded, resp)
+	}
+	if len(succeeded) == 0 {
+		return nil, fmt.Errorf("all registries failed: %s", strings.Join(failures, "; "))
+	}
+
+	trials := mergeTrials(succeeded)
+	merged := &models.SearchResponse{
+		Trials:     trials,
+		TotalCount: len(trials),
+		PageSize:   len(trials),
+	}
+	for _, resp := range succeeded {
+		if resp.FilteringNotice != "" {
+			merged.FilteringNotice = resp.FilteringNotice
+		}
+	}
+	return merged, nil
+}
+
+// GetByID returns the trial from the first registry that has it
+func (m *MultiRegistry) GetByID(ctx context.Context, id string) (*models.Trial, error) {
+	var failures []string
+	for _, registry := range m.registries {
+		trial, err := registry.GetByID(ctx, id)
+		if err == nil {
+			return trial, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", registry.Name(), err))
+	}
+	return nil, fmt.Errorf("trial not found in any registry: %s", strings.Join(failures, "; "))
+}
+
+// trialIdentifiers returns the normalized IDs a trial is known by across registries
+func trialIdentifiers(trial models.Trial) []string {
+	var ids []string
+	if id := normalizeTrialID(trial.NCTID); id != "" {
+		ids = append(ids, id)
+	}
+	for _, secondary := range trial.SecondaryIDs {
+		if !isCrossRegistrationID(secondary) {
+			continue
+		}
+		if id := normalizeTrialID(secondary.ID); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// registryIDPattern matches identifier formats of WHO primary registries and EU registers
+var registryIDPattern = regexp.MustCompile(`(?i)^(NCT\d{8}|\d{4}-\d{6}-\d{2}(-\d{2})?|ISRCTN\d+|RBR-\w+|ACTRN\d+|ChiCTR[\w-]+|CTRI/[\d/]+|DRKS\d+|EUCTR[\w-]+|IRCT\w+|JPRN-\w+|KCT\d+|PACTR\d+|TCTR\d+|NTR\d+|NL\d+|SLCTR/[\d/]+|LBCTR\d+|ITMCTR\d+|RPCEC\d+|PER-[\d-]+)$`)
+
+// isCrossRegistrationID reports whether a secondary ID identifies the trial in another registry.
+// Grant and sponsor protocol numbers are not globally unique, so they are never used for dedup;
+// untyped IDs are only used when they look like a registry identifier.
+func isCrossRegistrationID(secondary models.SecondaryID) bool {
+	switch secondary.Type {
+	case "EUDRACT_NUMBER", "CTIS", "REGISTRY":
+		return true
+	case "":
+		return registryIDPattern.MatchString(strings.TrimSpace(secondary.ID))
+	default:
+		return false
+	}
+}
+
+// normalizeTrialID normalizes an identifier for comparison across registries
+func normalizeTrialID(id string) string {
+	return strings.ToUpper(strings.TrimSpace(id))
+}
+
+// mergeTrials merges result sets in order, folding cross-registered trials into the first occurrence
+// and recording every registry a trial appeared in.
+func mergeTrials(responses []*models.SearchResponse) []models.Trial {
+	merged := make([]models.Trial, 0)
+	indexByID := make(map[string]int)
+
+	for _, resp := range responses {
+		for _, trial := range resp.Trials {
+			ids := trialIdentifiers(trial)
+
+			existing := -1
+			for _, id := range ids {
+				if idx, ok := indexByID[id]; ok {
+					existing = idx
+					break
+				}
+			}
+
+			if existing < 0 {
+				trial.Registries = []string{trial.Registry}
+				merged = append(merged, trial)
+				existing = len(merged) - 1
+			} else if !containsString(merged[existing].Registries, trial.Registry) {
+				merged[existing].Registries = append(merged[existing].Registries, trial.Registry)
+			}
+
+			for _, id := range ids {
+				if _, ok := indexByID[id]; !ok {
+					indexByID[id] = existing
+				}
+			}
+		}
+	}
+
+	return merged
+}
+
+// containsString checks if a value exists in the slice
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
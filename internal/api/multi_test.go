@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// stubRegistry is an in-memory Registry for merge tests
+type stubRegistry struct {
+	name   string
+	trials []models.Trial
+	err    error
+}
+
+func (s *stubRegistry) Name() string { return s.name }
+
+func (s *stubRegistry) Search(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.SearchResponse{Trials: s.trials, TotalCount: len(s.trials)}, nil
+}
+
+func (s *stubRegistry) GetByID(ctx context.Context, id string) (*models.Trial, error) {
+	for i := range s.trials {
+		if s.trials[i].NCTID == id {
+			return &s.trials[i], nil
+		}
+	}
+	return nil, errors.New("trial not found: " + id)
+}
+
+func TestMultiRegistryMergesAndDedupes(t *testing.T) {
+	ctgov := &stubRegistry{name: RegistryClinicalTrialsGov, trials: []models.Trial{
+		{NCTID: "NCT00000001", Title: "CT.gov record", Registry: RegistryClinicalTrialsGov},
+		{NCTID: "NCT00000002", Title: "Only in CT.gov", Registry: RegistryClinicalTrialsGov},
+	}}
+	ictrp := &stubRegistry{name: RegistryICTRP, trials: []models.Trial{
+		// Same NCT ID registered via ICTRP
+		{NCTID: "nct00000001", Title: "ICTRP copy", Registry: RegistryICTRP},
+		// Brazilian registration cross-referencing an NCT ID
+		{NCTID: "RBR-7abc12", Title: "ReBEC record", Registry: RegistryICTRP,
+			SecondaryIDs: []models.SecondaryID{{ID: "NCT00000002"}}},
+		// Distinct trial
+		{NCTID: "ISRCTN12345678", Title: "Only in ICTRP", Registry: RegistryICTRP},
+	}}
+
+	resp, err := NewMultiRegistry(ctgov, ictrp).Search(context.Background(), models.SearchRequest{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	type result struct {
+		id         string
+		title      string
+		registries []string
+	}
+	expected := []result{
+		{"NCT00000001", "CT.gov record", []string{RegistryClinicalTrialsGov, RegistryICTRP}},
+		{"NCT00000002", "Only in CT.gov", []string{RegistryClinicalTrialsGov, RegistryICTRP}},
+		{"ISRCTN12345678", "Only in ICTRP", []string{RegistryICTRP}},
+	}
+
+	if len(resp.Trials) != len(expected) || resp.TotalCount != len(expected) {
+		t.Fatalf("Expected %d merged trials, got %d (total_count %d)", len(expected), len(resp.Trials), resp.TotalCount)
+	}
+	for i, want := range expected {
+		got := resp.Trials[i]
+		if got.NCTID != want.id || got.Title != want.title || !reflect.DeepEqual(got.Registries, want.registries) {
+			t.Errorf("Trial %d: expected %+v, got id=%s title=%s registries=%v", i, want, got.NCTID, got.Title, got.Registries)
+		}
+	}
+}
+
+func TestMultiRegistryPartialFailure(t *testing.T) {
+	ctgov := &stubRegistry{name: RegistryClinicalTrialsGov, err: errors.New("upstream down")}
+	ictrp := &stubRegistry{name: RegistryICTRP, trials: []models.Trial{{NCTID: "RBR-7abc12", Registry: RegistryICTRP}}}
+
+	resp, err := NewMultiRegistry(ctgov, ictrp).Search(context.Background(), models.SearchRequest{})
+	if err != nil {
+		t.Fatalf("Expected partial results, got error: %v", err)
+	}
+	if len(resp.Trials) != 1 {
+		t.Errorf("Expected 1 trial from the healthy registry, got %d", len(resp.Trials))
+	}
+
+	ictrp.err = errors.New("also down")
+	if _, err := NewMultiRegistry(ctgov, ictrp).Search(context.Background(), models.SearchRequest{}); err == nil {
+		t.Error("Expected error when all registries fail")
+	}
+}
+
+func TestMultiRegistryGetByID(t *testing.T) {
+	ctgov := &stubRegistry{name: RegistryClinicalTrialsGov}
+	ictrp := &stubRegistry{name: RegistryICTRP, trials: []models.Trial{{NCTID: "RBR-7abc12", Registry: RegistryICTRP}}}
+
+	trial, err := NewMultiRegistry(ctgov, ictrp).GetByID(context.Background(), "RBR-7abc12")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if trial.Registry != RegistryICTRP {
+		t.Errorf("Expected trial from ictrp, got %s", trial.Registry)
+	}
+}
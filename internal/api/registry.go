@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+const (
+	// RegistryClinicalTrialsGov identifies the ClinicalTrials.gov registry
+	RegistryClinicalTrialsGov = "clinicaltrials.gov"
+	// RegistryICTRP identifies the WHO International Clinical Trials Registry Platform
+	RegistryICTRP = "ictrp"
+)
+
+// Registry is a source of clinical trials that results are normalized from into the common Trial model
+type Registry interface {
+	// Name returns the registry identifier used in the registry query param and Trial.Registry
+	Name() string
+	// Search searches the registry for trials matching the request
+	Search(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error)
+	// GetByID retrieves a single trial by its registry-specific ID
+	GetByID(ctx context.Context, id string) (*models.Trial, error)
+}
+
+// Compile-time checks that the registry clients implement Registry
+var (
+	_ Registry = (*ClinicalTrialsClient)(nil)
+	_ Registry = (*ICTRPClient)(nil)
+	_ Registry = (*MultiRegistry)(nil)
+)
+
+// Name returns the registry identifier for ClinicalTrials.gov
+func (c *ClinicalTrialsClient) Name() string {
+	return RegistryClinicalTrialsGov
+}
+
+// Search implements Registry using SearchTrials
+func (c *ClinicalTrialsClient) Search(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	return c.SearchTrials(ctx, req)
+}
+
+// GetByID implements Registry using GetTrialDetails
+func (c *ClinicalTrialsClient) GetByID(ctx context.Context, id string) (*models.Trial, error) {
+	return c.GetTrialDetails(ctx, id)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// SortRelevance orders results by client-side relevance to the free-text query
+const SortRelevance = "relevance"
+
+// relevanceStopWords are query tokens ignored when scoring (including upstream boolean operators)
+var relevanceStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "or": true, "not": true, "the": true,
+	"of": true, "in": true, "on": true, "for": true, "with": true, "to": true,
+}
+
+// tokenize lowercases text and splits it into letter/digit tokens
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// queryTokens returns the distinct scoring tokens of a free-text query
+func queryTokens(query string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, token := range tokenize(query) {
+		if len(token) < 2 || relevanceStopWords[token] || seen[token] {
+			continue
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// relevanceScore counts occurrences of the query tokens in the trial's title, conditions and brief summary
+func relevanceScore(trial models.Trial, tokens []string) float64 {
+	counts := make(map[string]int)
+	fields := append([]string{trial.Title, trial.BriefSummary}, trial.Conditions...)
+	for _, field := range fields {
+		for _, token := range tokenize(field) {
+			counts[token]++
+		}
+	}
+
+	score := 0
+	for _, token := range tokens {
+		score += counts[token]
+	}
+	return float64(score)
+}
+
+// SortByRelevance scores each trial by term frequency of the query tokens and sorts by score descending.
+// Ties keep their upstream order, so the result is deterministic.
+func SortByRelevance(trials []models.Trial, query string) {
+	tokens := queryTokens(query)
+	for i := range trials {
+		trials[i].Score = relevanceScore(trials[i], tokens)
+	}
+	sort.SliceStable(trials, func(i, j int) bool {
+		return trials[i].Score > trials[j].Score
+	})
+}
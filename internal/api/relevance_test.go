@@ -0,0 +1,71 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+func TestSortByRelevance(t *testing.T) {
+	trials := []models.Trial{
+		{NCTID: "NCT-NONE", Title: "Diabetes management study"},
+		{NCTID: "NCT-ONE", Title: "Exoskeleton gait training"},
+		{NCTID: "NCT-MANY", Title: "Epidural stimulation for spinal cord injury",
+			Conditions:   []string{"Spinal Cord Injuries"},
+			BriefSummary: "Stimulation of the spinal cord to restore walking after injury."},
+		{NCTID: "NCT-SOME", Title: "Spinal cord injury rehabilitation"},
+		{NCTID: "NCT-ONE-B", Title: "Spinal fusion outcomes"},
+	}
+
+	SortByRelevance(trials, "spinal cord injury OR stimulation")
+
+	gotIDs := make([]string, 0, len(trials))
+	for _, trial := range trials {
+		gotIDs = append(gotIDs, trial.NCTID)
+	}
+	// Equal scores keep their original relative order
+	wantIDs := []string{"NCT-MANY", "NCT-SOME", "NCT-ONE-B", "NCT-NONE", "NCT-ONE"}
+	if !reflect.DeepEqual(gotIDs, wantIDs) {
+		t.Errorf("Expected order %v, got %v", wantIDs, gotIDs)
+	}
+
+	wantScores := []float64{10, 3, 1, 0, 0}
+	for i, trial := range trials {
+		if trial.Score != wantScores[i] {
+			t.Errorf("Expected %s score %v, got %v", trial.NCTID, wantScores[i], trial.Score)
+		}
+	}
+}
+
+func TestSortByRelevanceDeterministic(t *testing.T) {
+	build := func() []models.Trial {
+		return []models.Trial{
+			{NCTID: "A", Title: "tetraplegia"},
+			{NCTID: "B", Title: "tetraplegia"},
+			{NCTID: "C", Title: "tetraplegia tetraplegia"},
+			{NCTID: "D", Title: "tetraplegia"},
+		}
+	}
+
+	first := build()
+	SortByRelevance(first, "Tetraplegia")
+	for i := 0; i < 10; i++ {
+		again := build()
+		SortByRelevance(again, "Tetraplegia")
+		if !reflect.DeepEqual(first, again) {
+			t.Fatalf("Expected deterministic ordering, got %v then %v", first, again)
+		}
+	}
+	if first[0].NCTID != "C" || first[1].NCTID != "A" {
+		t.Errorf("Expected C first then original order, got %v", first)
+	}
+}
+
+func TestQueryTokens(t *testing.T) {
+	got := queryTokens("Spinal cord injury OR spinal-cord AND the paraplegia, a")
+	want := []string{"spinal", "cord", "injury", "paraplegia"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected tokens %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import "strings"
+
+// StatusLabels maps overall status values to labels suitable for display. It covers the
+// ClinicalTrials.gov statuses and the normalized ICTRP ones, and is the single list of
+// statuses the service knows about.
+var StatusLabels = map[string]string{
+	"ACTIVE_NOT_RECRUITING":     "Active, not recruiting",
+	"APPROVED_FOR_MARKETING":    "Approved for marketing",
+	"AVAILABLE":                 "Available",
+	"COMPLETED":                 "Completed",
+	"ENROLLING_BY_INVITATION":   "Enrolling by invitation",
+	"NO_LONGER_AVAILABLE":       "No longer available",
+	"NOT_RECRUITING":            "Not recruiting", // ICTRP
+	"NOT_YET_RECRUITING":        "Not yet recruiting",
+	"RECRUITING":                "Recruiting",
+	"SUSPENDED":                 "Suspended",
+	"TEMPORARILY_NOT_AVAILABLE": "Temporarily not available",
+	"TERMINATED":                "Terminated",
+	"UNKNOWN":                   "Unknown status",
+	"WITHDRAWN":                 "Withdrawn",
+	"WITHHELD":                  "Withheld",
+}
+
+// IsKnownStatus reports whether status, in any case, is listed in StatusLabels
+func IsKnownStatus(status string) bool {
+	_, ok := StatusLabels[strings.ToUpper(status)]
+	return ok
+}
+
+// StatusLabel returns the display label of a status. Statuses missing from StatusLabels,
+// such as free-text ICTRP statuses, are turned into sentence case ("ON_HOLD" -> "On hold").
+func StatusLabel(status string) string {
+	if label, ok := StatusLabels[strings.ToUpper(status)]; ok {
+		return label
+	}
+	words := strings.ToLower(strings.ReplaceAll(status, "_", " "))
+	if words == "" {
+		return ""
+	}
+	return strings.ToUpper(words[:1]) + words[1:]
+}
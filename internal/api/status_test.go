@@ -0,0 +1,54 @@
+package api
+
+import "testing"
+
+func TestStatusLabel(t *testing.T) {
+	tests := map[string]string{
+		"ACTIVE_NOT_RECRUITING":     "Active, not recruiting",
+		"APPROVED_FOR_MARKETING":    "Approved for marketing",
+		"AVAILABLE":                 "Available",
+		"COMPLETED":                 "Completed",
+		"ENROLLING_BY_INVITATION":   "Enrolling by invitation",
+		"NO_LONGER_AVAILABLE":       "No longer available",
+		"NOT_RECRUITING":            "Not recruiting",
+		"NOT_YET_RECRUITING":        "Not yet recruiting",
+		"RECRUITING":                "Recruiting",
+		"SUSPENDED":                 "Suspended",
+		"TEMPORARILY_NOT_AVAILABLE": "Temporarily not available",
+		"TERMINATED":                "Terminated",
+		"UNKNOWN":                   "Unknown status",
+		"WITHDRAWN":                 "Withdrawn",
+		"WITHHELD":                  "Withheld",
+		// Case-insensitive lookup, and a fallback for statuses outside the table
+		"recruiting":       "Recruiting",
+		"PENDING_APPROVAL": "Pending approval",
+		"":                 "",
+	}
+	for status, want := range tests {
+		if got := StatusLabel(status); got != want {
+			t.Errorf("StatusLabel(%q) = %q, want %q", status, got, want)
+		}
+	}
+	for status := range StatusLabels {
+		if _, ok := tests[status]; !ok {
+			t.Errorf("Status %s has no label test", status)
+		}
+	}
+}
+
+func TestIsKnownStatus(t *testing.T) {
+	// The default status lists must only use statuses validation accepts
+	for _, status := range append(append([]string{}, RecruitingStatuses...), InactiveStatuses...) {
+		if !IsKnownStatus(status) {
+			t.Errorf("Expected %s to be a known status", status)
+		}
+	}
+	if !IsKnownStatus("completed") {
+		t.Error("Expected status matching to ignore case")
+	}
+	for _, status := range []string{"OPEN", "", "RECRUITING "} {
+		if IsKnownStatus(status) {
+			t.Errorf("Expected %q to be unknown", status)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultSuggestLimit is the number of condition suggestions returned when the caller does not specify one
+	DefaultSuggestLimit = 10
+	// MaxSuggestLimit is the largest number of condition suggestions returned
+	MaxSuggestLimit = 50
+)
+
+// SuggestedConditions is the curated list condition suggestions are drawn from: the
+// spinal cord injury terms this service centers on, their common secondary conditions
+// and neighbouring neurological conditions, spelled as ClinicalTrials.gov lists them.
+var SuggestedConditions = []string{
+	"Spinal Cord Injuries",
+	"Spinal Cord Injury",
+	"Spinal Cord Injury, Acute",
+	"Spinal Cord Injury, Chronic",
+	"Spinal Cord Injury Cervical",
+	"Spinal Cord Injury Thoracic",
+	"Spinal Cord Injury Lumbar",
+	"Central Cord Syndrome",
+	"Tetraplegia",
+	"Quadriplegia",
+	"Paraplegia",
+	"Incomplete Spinal Cord Injury",
+	"Neuropathic Pain",
+	"Chronic Pain",
+	"Spasticity",
+	"Muscle Spasticity",
+	"Neurogenic Bladder",
+	"Neurogenic Bowel",
+	"Urinary Tract Infections",
+	"Pressure Ulcer",
+	"Autonomic Dysreflexia",
+	"Orthostatic Hypotension",
+	"Respiratory Insufficiency",
+	"Sleep Apnea",
+	"Osteoporosis",
+	"Depression",
+	"Anxiety",
+	"Spina Bifida",
+	"Transverse Myelitis",
+	"Syringomyelia",
+	"Spinal Stenosis",
+	"Spinal Muscular Atrophy",
+	"Multiple Sclerosis",
+	"Amyotrophic Lateral Sclerosis",
+	"Guillain-Barre Syndrome",
+	"Peripheral Nerve Injuries",
+	"Traumatic Brain Injury",
+	"Stroke",
+	"Cerebral Palsy",
+	"Parkinson Disease",
+}
+
+// SuggestConditions returns up to limit conditions from SuggestedConditions matching the
+// typed prefix, ignoring case. Conditions starting with the prefix rank first, then those
+// with a later word starting with it; shorter names rank first within each group.
+func SuggestConditions(prefix string, limit int) []string {
+	prefix = strings.ToLower(strings.Join(strings.Fields(prefix), " "))
+	if prefix == "" || limit <= 0 {
+		return []string{}
+	}
+
+	type suggestion struct {
+		condition string
+		rank      int
+	}
+	var matches []suggestion
+	for _, condition := range SuggestedConditions {
+		lower := strings.ToLower(condition)
+		switch {
+		case strings.HasPrefix(lower, prefix):
+			matches = append(matches, suggestion{condition, 0})
+		case strings.Contains(lower, " "+prefix) || strings.Contains(lower, "-"+prefix):
+			matches = append(matches, suggestion{condition, 1})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		if len(matches[i].condition) != len(matches[j].condition) {
+			return len(matches[i].condition) < len(matches[j].condition)
+		}
+		return matches[i].condition < matches[j].condition
+	})
+
+	suggestions := make([]string, 0, min(limit, len(matches)))
+	for _, match := range matches[:min(limit, len(matches))] {
+		suggestions = append(suggestions, match.condition)
+	}
+	return suggestions
+}
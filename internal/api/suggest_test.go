@@ -0,0 +1,32 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestConditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"prefix ranks shorter names first", "spinal cord inj", 3,
+			[]string{"Spinal Cord Injury", "Spinal Cord Injuries", "Spinal Cord Injury Lumbar"}},
+		{"case and spacing ignored", "  TETRA ", 10, []string{"Tetraplegia"}},
+		{"word prefix after name prefix", "para", 10, []string{"Paraplegia"}},
+		{"later words match", "pain", 10, []string{"Chronic Pain", "Neuropathic Pain"}},
+		{"name prefix before word prefix", "spa", 10, []string{"Spasticity", "Muscle Spasticity"}},
+		{"hyphenated words", "barre", 10, []string{"Guillain-Barre Syndrome"}},
+		{"mid-word does not match", "plegia", 10, []string{}},
+		{"empty prefix", " ", 10, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SuggestConditions(tt.prefix, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SuggestConditions(%q, %d) = %v, want %v", tt.prefix, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
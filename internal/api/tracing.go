@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/clinical-trials-microservice/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startUpstreamSpan starts a client span for an upstream call and propagates the trace
+// context to the registry through the traceparent header
+func startUpstreamSpan(ctx context.Context, registry string, httpReq *http.Request) (*http.Request, trace.Span) {
+	ctx, span := tracing.Tracer().Start(ctx, httpReq.Method+" "+registry,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", httpReq.Method),
+			attribute.String("server.address", httpReq.URL.Host),
+			attribute.String("url.full", httpReq.URL.String()),
+		),
+	)
+	httpReq = httpReq.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	return httpReq, span
+}
+
+// endUpstreamSpan records the outcome of an upstream call and ends its span
+func endUpstreamSpan(span trace.Span, resp *http.Response, err error) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+}
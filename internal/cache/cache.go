@@ -1,61 +1,416 @@
 package cache
 
 import (
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/clinical-trials-microservice/internal/logging"
 	gocache "github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog"
 )
 
+const (
+	// DefaultTTL is used when no cache TTL is configured
+	DefaultTTL = 6 * time.Hour
+	// MinTTL is the shortest accepted cache TTL
+	MinTTL = time.Minute
+	// MaxTTL is the longest accepted cache TTL; trial data should not be served staler than this
+	MaxTTL = 7 * 24 * time.Hour
+)
+
+// MaxTTLJitterPercent bounds the TTL jitter so entries never live less than half the TTL
+const MaxTTLJitterPercent = 50
+
+// DefaultKeyVersion namespaces every cache key. Bump it whenever the shape of cached
+// values changes so entries written by an older release are never read back.
+const DefaultKeyVersion = "v1"
+
+// DefaultMaxValueBytes is the suggested cap on the JSON size of a single cached value
+const DefaultMaxValueBytes = 4 << 20
+
+// MaxShards bounds the number of cache shards
+const MaxShards = 256
+
 // Cache provides caching functionality for trial data
 type Cache struct {
-	memCache *gocache.Cache
+	// shards split the entries by key hash, each behind its own lock, so concurrent requests
+	// for different keys rarely contend. A single shard behaves like a plain go-cache.
+	shards     []*gocache.Cache
+	shardCount int
+	defaultTTL time.Duration
+	logger     zerolog.Logger
+	keyVersion string
+	jitter     float64 // Fraction of the default TTL entries may expire early or late
+	// maxValueBytes caps the JSON size of a cached value; larger values are not cached. 0 disables the cap.
+	maxValueBytes int
+	hits          atomic.Int64
+	misses        atomic.Int64
+	evictions     atomic.Int64 // Entries removed by expiry cleanup or Delete
+	// cleanupInterval is how often expired entries are removed; 0 derives it from the TTL
+	cleanupInterval time.Duration
+	stopJanitor     chan struct{}
+	closeOnce       sync.Once
+}
+
+// Stats is a point-in-time snapshot of cache effectiveness
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Items     int   `json:"items"`     // May include expired entries not yet cleaned up
+	Evictions int64 `json:"evictions"` // Entries removed since the cache was created
+}
+
+// Entry describes a cached key, for debugging what is in the cache
+type Entry struct {
+	Key       string
+	ExpiresAt time.Time // Zero for entries that never expire
+}
+
+// Option configures optional Cache behavior
+type Option func(*Cache)
+
+// WithLogger sets the logger used for debug logging of cache operations
+func WithLogger(logger zerolog.Logger) Option {
+	return func(c *Cache) {
+		c.logger = logger
+	}
+}
+
+// WithKeyVersion overrides the version prefix applied to every key, invalidating entries
+// stored under any other version
+func WithKeyVersion(version string) Option {
+	return func(c *Cache) {
+		c.keyVersion = version
+	}
+}
+
+// WithCleanupInterval sets how often expired entries are removed. By default it is half the
+// TTL, but at least a minute.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(c *Cache) {
+		c.cleanupInterval = interval
+	}
+}
+
+// WithTTLJitter randomizes the TTL of entries stored with the default TTL by up to ±percent
+// so entries cached together, e.g. during a traffic spike, do not all expire at once.
+// Values are clamped to 0..MaxTTLJitterPercent.
+func WithTTLJitter(percent int) Option {
+	return func(c *Cache) {
+		c.jitter = float64(min(max(percent, 0), MaxTTLJitterPercent)) / 100
+	}
+}
+
+// WithMaxValueBytes skips caching values whose JSON encoding exceeds n bytes, keeping
+// memory predictable when a few trials carry enormous descriptions. 0 disables the cap.
+func WithMaxValueBytes(n int) Option {
+	return func(c *Cache) {
+		c.maxValueBytes = max(n, 0)
+	}
+}
+
+// WithShards splits the cache into n shards, chosen by a hash of the key, to reduce lock
+// contention under high concurrency. Values are clamped to 1..MaxShards; the default is 1.
+func WithShards(n int) Option {
+	return func(c *Cache) {
+		c.shardCount = min(max(n, 1), MaxShards)
+	}
+}
+
+// NewCache creates a new cache instance with default TTL.
+// A zero TTL uses DefaultTTL; values outside MinTTL..MaxTTL are clamped with a warning.
+func NewCache(defaultTTL time.Duration, opts ...Option) *Cache {
+	c := &Cache{
+		logger:     logging.Logger(logging.ComponentCache),
+		keyVersion: DefaultKeyVersion,
+		shardCount: 1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.defaultTTL = c.validTTL(defaultTTL)
+	if c.cleanupInterval <= 0 {
+		c.cleanupInterval = c.defaultTTL / 2
+		if c.cleanupInterval < time.Minute {
+			c.cleanupInterval = time.Minute
+		}
+	}
+
+	// Expired entries are removed by our own janitor rather than go-cache's so each cleanup
+	// cycle can report how many entries it evicted
+	c.shards = make([]*gocache.Cache, c.shardCount)
+	for i := range c.shards {
+		c.shards[i] = gocache.New(c.defaultTTL, 0)
+		c.shards[i].OnEvicted(func(string, interface{}) { c.evictions.Add(1) })
+	}
+	c.stopJanitor = make(chan struct{})
+	go c.runJanitor()
+	return c
+}
+
+// CleanupInterval returns how often expired entries are removed
+func (c *Cache) CleanupInterval() time.Duration {
+	return c.cleanupInterval
+}
+
+// Shards returns the number of shards entries are split across
+func (c *Cache) Shards() int {
+	return len(c.shards)
+}
+
+// shard returns the shard holding storageKey, picked by its 32-bit FNV-1a hash
+func (c *Cache) shard(storageKey string) *gocache.Cache {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	hash := uint32(2166136261)
+	for i := 0; i < len(storageKey); i++ {
+		hash ^= uint32(storageKey[i])
+		hash *= 16777619
+	}
+	return c.shards[hash%uint32(len(c.shards))]
+}
+
+// itemCount returns the number of entries across all shards
+func (c *Cache) itemCount() int {
+	count := 0
+	for _, shard := range c.shards {
+		count += shard.ItemCount()
+	}
+	return count
+}
+
+// Close stops the background cleanup of expired entries
+func (c *Cache) Close() {
+	c.closeOnce.Do(func() { close(c.stopJanitor) })
 }
 
-// NewCache creates a new cache instance with default TTL
-func NewCache(defaultTTL time.Duration) *Cache {
-	if defaultTTL == 0 {
-		defaultTTL = 6 * time.Hour // Default 6 hour cache
+// runJanitor removes expired entries every cleanup interval until Close is called
+func (c *Cache) runJanitor() {
+	ticker := time.NewTicker(c.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.cleanup()
+		case <-c.stopJanitor:
+			return
+		}
 	}
-	cleanupInterval := defaultTTL / 2
-	if cleanupInterval < time.Minute {
-		cleanupInterval = time.Minute
+}
+
+// cleanup removes expired entries from every shard and logs how many were evicted
+func (c *Cache) cleanup() {
+	start := time.Now()
+	before := c.evictions.Load()
+	for _, shard := range c.shards {
+		shard.DeleteExpired()
 	}
-	return &Cache{
-		memCache: gocache.New(defaultTTL, cleanupInterval),
+	c.logger.Debug().
+		Int64("evicted", c.evictions.Load()-before).
+		Int("items", c.itemCount()).
+		Dur("duration", time.Since(start)).
+		Msg("Cache cleanup")
+}
+
+// validTTL applies the default TTL and clamps out-of-range values
+func (c *Cache) validTTL(ttl time.Duration) time.Duration {
+	switch {
+	case ttl == 0:
+		return DefaultTTL
+	case ttl < MinTTL:
+		c.logger.Warn().Dur("ttl", ttl).Dur("min_ttl", MinTTL).Msg("Cache TTL too small, clamping")
+		return MinTTL
+	case ttl > MaxTTL:
+		c.logger.Warn().Dur("ttl", ttl).Dur("max_ttl", MaxTTL).Msg("Cache TTL too large, clamping")
+		return MaxTTL
 	}
+	return ttl
 }
 
-// Get retrieves a value from the cache
+// TTL returns the effective default TTL after validation
+func (c *Cache) TTL() time.Duration {
+	return c.defaultTTL
+}
+
+// Get retrieves a value from the cache, counting the lookup as a hit or miss
 func (c *Cache) Get(key string) (interface{}, bool) {
-	return c.memCache.Get(key)
+	storageKey := c.storageKey(key)
+	value, found := c.shard(storageKey).Get(storageKey)
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return value, found
+}
+
+// Stats returns the hit, miss and eviction counts since the cache was created and the current
+// item count, across all shards
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Items:     c.itemCount(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// Entries returns the unexpired entries under the current key version, sorted by key.
+// Keys are returned as callers passed them, without the version prefix. It copies every
+// shard's items, so it is meant for debugging rather than hot paths.
+func (c *Cache) Entries() []Entry {
+	prefix := c.storageKey("")
+	var entries []Entry
+	for _, shard := range c.shards {
+		for storageKey, item := range shard.Items() {
+			key, ok := strings.CutPrefix(storageKey, prefix)
+			if !ok {
+				continue // Written under another key version
+			}
+			entry := Entry{Key: key}
+			if item.Expiration > 0 {
+				entry.ExpiresAt = time.Unix(0, item.Expiration)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Keys returns the keys of the unexpired entries under the current key version, sorted
+func (c *Cache) Keys() []string {
+	entries := c.Entries()
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	return keys
 }
 
-// Set stores a value in the cache with the default TTL
+// storageKey namespaces a caller key with the key version. Search keys from GenerateCacheKey
+// and per-trial keys both go through it, so a version change invalidates all of them.
+func (c *Cache) storageKey(key string) string {
+	if c.keyVersion == "" {
+		return key
+	}
+	return c.keyVersion + ":" + key
+}
+
+// Set stores a value in the cache with the default TTL, jittered if configured
 func (c *Cache) Set(key string, value interface{}) {
-	c.memCache.Set(key, value, gocache.DefaultExpiration)
+	if c.oversized(key, value) {
+		return
+	}
+	ttl := c.entryTTL()
+	storageKey := c.storageKey(key)
+	c.shard(storageKey).Set(storageKey, value, ttl)
+	c.logSet(key, ttl)
+}
+
+// oversized reports whether value is over the size cap, logging the skipped write.
+// Values that cannot be encoded are not measured and always fit.
+func (c *Cache) oversized(key string, value interface{}) bool {
+	if c.maxValueBytes == 0 {
+		return false
+	}
+	data, err := json.Marshal(value)
+	if err != nil || len(data) <= c.maxValueBytes {
+		return false
+	}
+	c.logger.Debug().
+		Str("cache_key", key).
+		Int("size_bytes", len(data)).
+		Int("max_value_bytes", c.maxValueBytes).
+		Msg("Cache value too large, not caching")
+	return true
+}
+
+// entryTTL returns the default TTL spread uniformly within ±jitter
+func (c *Cache) entryTTL() time.Duration {
+	if c.jitter == 0 {
+		return c.defaultTTL
+	}
+	spread := (rand.Float64()*2 - 1) * c.jitter
+	return c.defaultTTL + time.Duration(spread*float64(c.defaultTTL))
 }
 
 // SetWithTTL stores a value in the cache with a custom TTL
 func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
-	c.memCache.Set(key, value, ttl)
+	if c.oversized(key, value) {
+		return
+	}
+	storageKey := c.storageKey(key)
+	c.shard(storageKey).Set(storageKey, value, ttl)
+	if ttl == gocache.DefaultExpiration {
+		ttl = c.defaultTTL
+	}
+	c.logSet(key, ttl)
+}
+
+// Add stores a value with the default (jittered) TTL only if the key is not already cached.
+// Returns false if an unexpired value already exists or the value is over the size cap.
+func (c *Cache) Add(key string, value interface{}) bool {
+	if c.oversized(key, value) {
+		return false
+	}
+	ttl := c.entryTTL()
+	storageKey := c.storageKey(key)
+	if err := c.shard(storageKey).Add(storageKey, value, ttl); err != nil {
+		return false
+	}
+	c.logSet(key, ttl)
+	return true
 }
 
 // Delete removes a value from the cache
 func (c *Cache) Delete(key string) {
-	c.memCache.Delete(key)
+	storageKey := c.storageKey(key)
+	c.shard(storageKey).Delete(storageKey)
+	c.logger.Debug().
+		Str("cache_key", key).
+		Msg("Cache delete")
 }
 
-// Clear removes all values from the cache
+// logSet logs a cache write with its key, TTL and resulting expiration
+func (c *Cache) logSet(key string, ttl time.Duration) {
+	event := c.logger.Debug().
+		Str("cache_key", key).
+		Dur("ttl", ttl)
+	if ttl > 0 {
+		event = event.Time("expires_at", time.Now().Add(ttl))
+	}
+	event.Msg("Cache set")
+}
+
+// Clear removes all values from every shard
 func (c *Cache) Clear() {
-	c.memCache.Flush()
+	for _, shard := range c.shards {
+		shard.Flush()
+	}
 }
 
 // GenerateCacheKey generates a cache key from search parameters
 func GenerateCacheKey(base string, params map[string]interface{}) string {
-	// Simple key generation - could be improved with hashing
+	// Simple key generation - could be improved with hashing.
+	// Params are visited in sorted order so equal requests always map to the same key.
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
 	key := base
-	for k, v := range params {
-		key += ":" + k + "=" + toString(v)
+	for _, k := range names {
+		key += ":" + k + "=" + toString(params[k])
 	}
 	return key
 }
@@ -75,9 +430,9 @@ func toString(v interface{}) string {
 		}
 		return result
 	case int:
-		return string(rune(val))
+		return strconv.Itoa(val)
 	case float64:
-		return string(rune(val))
+		return strconv.FormatFloat(val, 'f', -1, 64)
 	default:
 		return ""
 	}
@@ -0,0 +1,486 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog"
+)
+
+// decodeLogLines parses newline-delimited JSON log output
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestCacheOperationLogging(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCache(time.Hour, WithLogger(zerolog.New(&buf).Level(zerolog.DebugLevel)))
+
+	c.Set("search:a", "value")
+	c.SetWithTTL("trial:NCT00000001", "value", 5*time.Minute)
+	c.Delete("search:a")
+
+	entries := decodeLogLines(t, &buf)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 log entries, got %d: %s", len(entries), buf.String())
+	}
+
+	expected := []struct {
+		msg string
+		key string
+		ttl float64 // milliseconds, zerolog's default duration unit
+	}{
+		{"Cache set", "search:a", float64(time.Hour.Milliseconds())},
+		{"Cache set", "trial:NCT00000001", float64((5 * time.Minute).Milliseconds())},
+		{"Cache delete", "search:a", 0},
+	}
+	for i, want := range expected {
+		entry := entries[i]
+		if entry["level"] != "debug" {
+			t.Errorf("Entry %d: expected debug level, got %v", i, entry["level"])
+		}
+		if entry["message"] != want.msg {
+			t.Errorf("Entry %d: expected message %q, got %v", i, want.msg, entry["message"])
+		}
+		if entry["cache_key"] != want.key {
+			t.Errorf("Entry %d: expected cache_key %q, got %v", i, want.key, entry["cache_key"])
+		}
+		if want.ttl > 0 {
+			if entry["ttl"] != want.ttl {
+				t.Errorf("Entry %d: expected ttl %v, got %v", i, want.ttl, entry["ttl"])
+			}
+			if _, ok := entry["expires_at"]; !ok {
+				t.Errorf("Entry %d: expected expires_at field", i)
+			}
+		}
+	}
+}
+
+func TestCacheLoggingSilentAboveDebug(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCache(time.Hour, WithLogger(zerolog.New(&buf).Level(zerolog.InfoLevel)))
+
+	c.Set("search:a", "value")
+	c.Delete("search:a")
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no cache logs at info level, got %s", buf.String())
+	}
+}
+
+func TestCacheAdd(t *testing.T) {
+	c := NewCache(time.Hour)
+
+	if !c.Add("trial:NCT00000001", "first") {
+		t.Fatal("Expected Add to store a missing key")
+	}
+	if c.Add("trial:NCT00000001", "second") {
+		t.Error("Expected Add not to overwrite an existing key")
+	}
+	if value, _ := c.Get("trial:NCT00000001"); value != "first" {
+		t.Errorf("Expected original value to be kept, got %v", value)
+	}
+}
+
+func TestGenerateCacheKeyIsDeterministic(t *testing.T) {
+	params := map[string]interface{}{
+		"query":      "paraplegia",
+		"conditions": []string{"a", "b"},
+		"status":     []string{"RECRUITING"},
+		"country":    "Brazil",
+		"sort":       "relevance",
+	}
+	want := GenerateCacheKey("search", params)
+	for i := 0; i < 20; i++ {
+		if got := GenerateCacheKey("search", params); got != want {
+			t.Fatalf("Expected stable key %q, got %q", want, got)
+		}
+	}
+	if want != "search:conditions=a,b:country=Brazil:query=paraplegia:sort=relevance:status=RECRUITING" {
+		t.Errorf("Expected params in sorted order, got %q", want)
+	}
+
+	// Numbers are written out in full, so nearby coordinates get different keys
+	near := GenerateCacheKey("search", map[string]interface{}{"lat": 34.05, "lon": -118.25, "distance": 50})
+	far := GenerateCacheKey("search", map[string]interface{}{"lat": 34.9, "lon": -118.25, "distance": 50})
+	if near == far {
+		t.Errorf("Expected different keys for different coordinates, both were %q", near)
+	}
+	if near != "search:distance=50:lat=34.05:lon=-118.25" {
+		t.Errorf("Expected numbers formatted in full, got %q", near)
+	}
+}
+
+func TestKeyVersion(t *testing.T) {
+	v1 := NewCache(time.Hour)
+	v2 := NewCache(time.Hour, WithKeyVersion("v2"))
+
+	key := GenerateCacheKey("search", map[string]interface{}{"query": "paraplegia"})
+	if v1.storageKey(key) == v2.storageKey(key) {
+		t.Errorf("Expected different storage keys across versions, got %q", v1.storageKey(key))
+	}
+	if v1.storageKey("trial:NCT00000001") == v2.storageKey("trial:NCT00000001") {
+		t.Error("Expected per-trial keys to be versioned too")
+	}
+
+	// Entries written under another version are not visible
+	v2.shards = v1.shards
+	v1.Set(key, "old shape")
+	if _, found := v2.Get(key); found {
+		t.Error("Expected entry from another key version to be ignored")
+	}
+	if value, found := v1.Get(key); !found || value != "old shape" {
+		t.Errorf("Expected entry under its own version, got %v (found: %v)", value, found)
+	}
+}
+
+func TestTTLValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		want    time.Duration
+		warning string
+	}{
+		{"zero uses default", 0, DefaultTTL, ""},
+		{"normal value kept", 2 * time.Hour, 2 * time.Hour, ""},
+		{"too small is clamped", time.Nanosecond, MinTTL, "Cache TTL too small, clamping"},
+		{"negative is clamped", -time.Hour, MinTTL, "Cache TTL too small, clamping"},
+		{"too large is clamped", 10000 * time.Hour, MaxTTL, "Cache TTL too large, clamping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewCache(tt.ttl, WithLogger(zerolog.New(&buf)))
+			if c.TTL() != tt.want {
+				t.Errorf("Expected TTL %v, got %v", tt.want, c.TTL())
+			}
+
+			entries := decodeLogLines(t, &buf)
+			if tt.warning == "" {
+				if len(entries) != 0 {
+					t.Errorf("Expected no warning, got %v", entries)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0]["message"] != tt.warning || entries[0]["level"] != "warn" {
+				t.Errorf("Expected warning %q, got %v", tt.warning, entries)
+			}
+		})
+	}
+}
+
+func TestStatsConcurrentGets(t *testing.T) {
+	c := NewCache(time.Hour)
+	c.Set("present", "value")
+
+	const workers, lookups = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lookups; i++ {
+				c.Get("present")
+				c.Get("absent")
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Hits != workers*lookups {
+		t.Errorf("Expected %d hits, got %d", workers*lookups, stats.Hits)
+	}
+	if stats.Misses != workers*lookups {
+		t.Errorf("Expected %d misses, got %d", workers*lookups, stats.Misses)
+	}
+	if stats.Items != 1 {
+		t.Errorf("Expected 1 item, got %d", stats.Items)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	const base = time.Hour
+	c := NewCache(base, WithTTLJitter(20))
+	low, high := base*80/100, base*120/100
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		key := "search:" + strconv.Itoa(i)
+		start := time.Now()
+		c.Set(key, "value")
+		storageKey := c.storageKey(key)
+		_, expiration, found := c.shard(storageKey).GetWithExpiration(storageKey)
+		if !found {
+			t.Fatalf("Expected %s to be cached", key)
+		}
+		ttl := expiration.Sub(start).Round(time.Second)
+		if ttl < low || ttl > high {
+			t.Errorf("Expected TTL within [%v, %v], got %v", low, high, ttl)
+		}
+		seen[ttl] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Expected jittered TTLs to vary")
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		c := NewCache(base)
+		for i := 0; i < 5; i++ {
+			if ttl := c.entryTTL(); ttl != base {
+				t.Errorf("Expected TTL %v without jitter, got %v", base, ttl)
+			}
+		}
+	})
+
+	t.Run("clamped", func(t *testing.T) {
+		if got := NewCache(base, WithTTLJitter(90)).jitter; got != float64(MaxTTLJitterPercent)/100 {
+			t.Errorf("Expected jitter clamped to %d%%, got %v", MaxTTLJitterPercent, got)
+		}
+	})
+}
+
+func TestCleanupEvictsExpiredEntries(t *testing.T) {
+	var buf syncBuffer
+	c := NewCache(time.Hour,
+		WithCleanupInterval(20*time.Millisecond),
+		WithLogger(zerolog.New(&buf).Level(zerolog.DebugLevel)))
+	defer c.Close()
+
+	if c.CleanupInterval() != 20*time.Millisecond {
+		t.Fatalf("Expected the configured cleanup interval, got %v", c.CleanupInterval())
+	}
+
+	c.SetWithTTL("search:short-1", "value", 10*time.Millisecond)
+	c.SetWithTTL("search:short-2", "value", 10*time.Millisecond)
+	c.Set("search:long", "value")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Stats().Evictions < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 2 {
+		t.Fatalf("Expected 2 evictions, got %d", stats.Evictions)
+	}
+	if stats.Items != 1 {
+		t.Errorf("Expected the long-lived entry to remain, got %d items", stats.Items)
+	}
+
+	var evicted float64
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) == nil && entry["message"] == "Cache cleanup" {
+			evicted += entry["evicted"].(float64)
+		}
+	}
+	if evicted != 2 {
+		t.Errorf("Expected cleanup logs to report 2 evictions, got %v", evicted)
+	}
+}
+
+func TestDefaultCleanupInterval(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{6 * time.Hour, 3 * time.Hour},
+		{time.Minute, time.Minute}, // Floor of one minute
+	}
+	for _, tt := range tests {
+		c := NewCache(tt.ttl)
+		if got := c.CleanupInterval(); got != tt.want {
+			t.Errorf("TTL %v: expected cleanup interval %v, got %v", tt.ttl, tt.want, got)
+		}
+		c.Close()
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for the janitor goroutine to write while the test reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCache(time.Hour, WithMaxValueBytes(64), WithLogger(zerolog.New(&buf).Level(zerolog.DebugLevel)))
+	small := map[string]string{"description": "short"}
+	large := map[string]string{"description": strings.Repeat("x", 100)}
+
+	c.Set("search:small", small)
+	c.Set("search:large", large)
+	c.SetWithTTL("trial:large", large, time.Minute)
+	if c.Add("trial:added", large) {
+		t.Error("Expected Add to reject an oversized value")
+	}
+
+	if _, found := c.Get("search:small"); !found {
+		t.Error("Expected a value under the cap to be cached")
+	}
+	for _, key := range []string{"search:large", "trial:large", "trial:added"} {
+		if _, found := c.Get(key); found {
+			t.Errorf("Expected oversized value %q not to be cached", key)
+		}
+	}
+
+	var skipped int
+	for _, entry := range decodeLogLines(t, &buf) {
+		if entry["message"] == "Cache value too large, not caching" {
+			skipped++
+			if entry["level"] != "debug" || entry["max_value_bytes"] != float64(64) {
+				t.Errorf("Unexpected skip log entry: %v", entry)
+			}
+		}
+	}
+	if skipped != 3 {
+		t.Errorf("Expected 3 skipped writes to be logged, got %d", skipped)
+	}
+
+	// Without the option there is no cap
+	unbounded := NewCache(time.Hour)
+	unbounded.Set("search:large", large)
+	if _, found := unbounded.Get("search:large"); !found {
+		t.Error("Expected no size cap by default")
+	}
+}
+
+func TestShards(t *testing.T) {
+	c := NewCache(time.Hour, WithShards(8))
+	defer c.Close()
+	if c.Shards() != 8 {
+		t.Fatalf("Expected 8 shards, got %d", c.Shards())
+	}
+
+	for i := 0; i < 100; i++ {
+		c.Set("search:"+strconv.Itoa(i), i)
+	}
+	used := 0
+	for _, shard := range c.shards {
+		if shard.ItemCount() > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("Expected keys spread across shards, got %d shard(s) in use", used)
+	}
+	for i := 0; i < 100; i++ {
+		if value, found := c.Get("search:" + strconv.Itoa(i)); !found || value != i {
+			t.Fatalf("Expected search:%d to be cached, got %v (found: %v)", i, value, found)
+		}
+	}
+	c.Delete("search:0")
+	if stats := c.Stats(); stats.Items != 99 || stats.Hits != 100 {
+		t.Errorf("Expected stats aggregated across shards, got %+v", stats)
+	}
+
+	c.Clear()
+	if stats := c.Stats(); stats.Items != 0 {
+		t.Errorf("Expected Clear to empty every shard, got %d items", stats.Items)
+	}
+
+	for n, want := range map[int]int{0: 1, -3: 1, MaxShards + 1: MaxShards} {
+		if got := NewCache(time.Hour, WithShards(n)).Shards(); got != want {
+			t.Errorf("WithShards(%d): expected %d shards, got %d", n, want, got)
+		}
+	}
+}
+
+// BenchmarkCacheContention compares a single go-cache instance against a sharded cache under
+// a parallel mixed read/write load over many keys
+func BenchmarkCacheContention(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "search:" + strconv.Itoa(i)
+	}
+	for _, shards := range []int{1, 16} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			c := NewCache(time.Hour, WithShards(shards), WithLogger(zerolog.Nop()))
+			defer c.Close()
+			for _, key := range keys {
+				c.Set(key, key)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%8 == 0 {
+						c.Set(key, key) // One write for every seven reads
+					} else {
+						c.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := NewCache(time.Hour, WithShards(4))
+	defer c.Close()
+	if keys := c.Keys(); len(keys) != 0 {
+		t.Fatalf("Expected no keys in an empty cache, got %v", keys)
+	}
+
+	start := time.Now()
+	c.Set("trial:NCT00000001", "trial")
+	c.Set("search:conditions=paraplegia", "search")
+	c.SetWithTTL("suggest:conditions:10:para", "suggestions", gocache.NoExpiration)
+	c.SetWithTTL("search:expired", "stale", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	expected := []string{"search:conditions=paraplegia", "suggest:conditions:10:para", "trial:NCT00000001"}
+	if keys := c.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected keys %v without version prefix or expired entries, got %v", expected, keys)
+	}
+	for _, entry := range c.Entries() {
+		switch {
+		case entry.Key == "suggest:conditions:10:para" && !entry.ExpiresAt.IsZero():
+			t.Errorf("Expected no expiration for %s, got %v", entry.Key, entry.ExpiresAt)
+		case entry.Key != "suggest:conditions:10:para" && entry.ExpiresAt.Sub(start).Round(time.Minute) != time.Hour:
+			t.Errorf("Expected %s to expire in an hour, got %v", entry.Key, entry.ExpiresAt)
+		}
+	}
+
+	// Entries written under another key version are not listed
+	other := NewCache(time.Hour, WithKeyVersion("v2"), WithShards(4))
+	other.shards = c.shards
+	if keys := other.Keys(); len(keys) != 0 {
+		t.Errorf("Expected no keys under another version, got %v", keys)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// Modes for searches whose conditions fall outside the allowlist
+const (
+	// ConditionsModeReject fails such searches with 400
+	ConditionsModeReject = "reject"
+	// ConditionsModeRestrict drops the disallowed conditions, falling back to the whole allowlist
+	ConditionsModeRestrict = "restrict"
+)
+
+// conditionAllowlist limits searches to a curated set of conditions, e.g. for a disease-specific
+// deployment that must keep upstream cost under control
+type conditionAllowlist struct {
+	conditions []string
+	allowed    map[string]bool // Lower-cased conditions
+	mode       string
+}
+
+// WithAllowedConditions restricts searches to the given conditions (matched case-insensitively).
+// In ConditionsModeReject searches naming any other condition fail with 400; in
+// ConditionsModeRestrict other conditions are silently dropped. An empty list allows everything.
+func WithAllowedConditions(conditions []string, mode string) Option {
+	return func(h *TrialsHandler) {
+		h.allowlist = nil
+		list := &conditionAllowlist{allowed: make(map[string]bool), mode: strings.ToLower(mode)}
+		for _, condition := range conditions {
+			condition = strings.TrimSpace(condition)
+			if condition == "" || list.allowed[strings.ToLower(condition)] {
+				continue
+			}
+			list.conditions = append(list.conditions, condition)
+			list.allowed[strings.ToLower(condition)] = true
+		}
+		if len(list.conditions) > 0 {
+			h.allowlist = list
+		}
+	}
+}
+
+// applyConditionAllowlist enforces the allowlist on a search. A free-text query counts as a
+// condition when no conditions are given, since it is sent upstream as the condition query.
+// Searches without either use the built-in default conditions and are left alone.
+func (h *TrialsHandler) applyConditionAllowlist(req *models.SearchRequest) error {
+	if h.allowlist == nil {
+		return nil
+	}
+	// Arbitrary upstream expressions cannot be checked against the allowlist
+	if req.AdvancedQuery != "" {
+		return errors.New("advanced_query is not available when search conditions are restricted")
+	}
+
+	requested := req.Conditions
+	if len(requested) == 0 && req.Query != "" {
+		requested = []string{req.Query}
+	}
+	if len(requested) == 0 {
+		return nil
+	}
+
+	var kept, disallowed []string
+	for _, condition := range requested {
+		if h.allowlist.allowed[strings.ToLower(strings.TrimSpace(condition))] {
+			kept = append(kept, condition)
+		} else {
+			disallowed = append(disallowed, condition)
+		}
+	}
+	if len(disallowed) == 0 {
+		return nil
+	}
+
+	if h.allowlist.mode != ConditionsModeRestrict {
+		return fmt.Errorf("conditions not allowed on this service: %s", strings.Join(disallowed, ", "))
+	}
+	if len(kept) == 0 {
+		kept = append([]string(nil), h.allowlist.conditions...)
+	}
+	if len(req.Conditions) == 0 {
+		req.Query = ""
+	}
+	req.Conditions = kept
+	return nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+const (
+	// DefaultCacheKeysLimit is how many keys GET /api/v1/cache/keys lists without a limit
+	DefaultCacheKeysLimit = 1000
+	// MaxCacheKeysLimit bounds the limit parameter of GET /api/v1/cache/keys
+	MaxCacheKeysLimit = 10000
+)
+
+// ListCacheKeys handles GET and HEAD /api/v1/cache/keys.
+// It lists the cached keys, sorted, with their expirations, up to ?limit= keys, to help
+// diagnose cache behavior. Keys are built from query parameters, so nothing is redacted,
+// but the route is meant to sit behind admin auth.
+func (h *TrialsHandler) ListCacheKeys(w http.ResponseWriter, r *http.Request) {
+	logger := getLogger(r.Context())
+
+	limit := DefaultCacheKeysLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > MaxCacheKeysLimit {
+			logger.Warn().Str("limit", value).Msg("Invalid cache keys limit")
+			h.writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid limit %q: must be between 1 and %d", value, MaxCacheKeysLimit))
+			return
+		}
+		limit = n
+	}
+
+	entries := h.cache.Entries()
+	response := models.CacheKeysResponse{
+		Keys:      make([]models.CacheKey, 0, min(len(entries), limit)),
+		Total:     len(entries),
+		Truncated: len(entries) > limit,
+	}
+	for _, entry := range entries[:min(len(entries), limit)] {
+		key := models.CacheKey{Key: entry.Key}
+		if !entry.ExpiresAt.IsZero() {
+			key.ExpiresAt = entry.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		response.Keys = append(response.Keys, key)
+	}
+	logger.Debug().
+		Int("total", response.Total).
+		Int("listed", len(response.Keys)).
+		Msg("Listed cache keys")
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, r, http.StatusOK, response)
+}
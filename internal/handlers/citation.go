@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/api"
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// Media types of the citation formats reference managers import
+const (
+	risContentType    = "application/x-research-info-systems"
+	bibTeXContentType = "application/x-bibtex"
+)
+
+// registrySources names each registry as the source database of a citation
+var registrySources = map[string]string{
+	api.RegistryClinicalTrialsGov: "ClinicalTrials.gov",
+	api.RegistryICTRP:             "WHO International Clinical Trials Registry Platform",
+}
+
+// citationSource returns the display name of the registry a trial came from
+func citationSource(trial models.Trial) string {
+	if source, ok := registrySources[trial.Registry]; ok {
+		return source
+	}
+	return trial.Registry
+}
+
+// citationYear returns the year of a trial's start date, or "" when it is unknown
+func citationYear(trial models.Trial) string {
+	if len(trial.StartDate) < 4 {
+		return ""
+	}
+	year := trial.StartDate[:4]
+	for _, c := range year {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+	return year
+}
+
+// writeRIS writes search results as RIS records, one "online database" (DBASE) reference per
+// trial, for import into reference managers during systematic reviews
+func (h *TrialsHandler) writeRIS(w http.ResponseWriter, r *http.Request, response *models.SearchResponse) {
+	var b strings.Builder
+	for _, trial := range response.Trials {
+		writeRISRecord(&b, trial)
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="trials.ris"`)
+	writeBody(w, r, http.StatusOK, risContentType, []byte(b.String()))
+}
+
+// writeRISRecord appends one RIS record. Tags are two letters, two spaces, a hyphen and a
+// space; lines end in CRLF and the record closes with an ER tag.
+func writeRISRecord(b *strings.Builder, trial models.Trial) {
+	tag := func(name, value string) {
+		if value = strings.Join(strings.Fields(value), " "); value != "" {
+			fmt.Fprintf(b, "%s  - %s\r\n", name, value)
+		}
+	}
+	b.WriteString("TY  - DBASE\r\n")
+	tag("TI", trial.Title)
+	tag("DB", citationSource(trial))
+	tag("AN", trial.NCTID)
+	tag("UR", trial.URL)
+	tag("PY", citationYear(trial))
+	tag("AU", trial.Sponsor.Name)
+	b.WriteString("ER  - \r\n\r\n")
+}
+
+// bibTeXEscaper escapes the characters with a special meaning in BibTeX field values
+var bibTeXEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+)
+
+// writeBibTeX writes search results as BibTeX @misc entries keyed by trial ID
+func (h *TrialsHandler) writeBibTeX(w http.ResponseWriter, r *http.Request, response *models.SearchResponse) {
+	var b strings.Builder
+	for _, trial := range response.Trials {
+		writeBibTeXEntry(&b, trial)
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="trials.bib"`)
+	writeBody(w, r, http.StatusOK, bibTeXContentType, []byte(b.String()))
+}
+
+// writeBibTeXEntry appends one @misc entry. The title and sponsor are double-braced so their
+// capitalization is kept; the URL is left unescaped for the url package.
+func writeBibTeXEntry(b *strings.Builder, trial models.Trial) {
+	fmt.Fprintf(b, "@misc{%s,\n", trial.NCTID)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(b, "  %s = {%s},\n", name, value)
+		}
+	}
+	if trial.Title != "" {
+		field("title", "{"+bibTeXEscaper.Replace(trial.Title)+"}")
+	}
+	if trial.Sponsor.Name != "" {
+		field("author", "{"+bibTeXEscaper.Replace(trial.Sponsor.Name)+"}") // Corporate author, not split into names
+	}
+	field("howpublished", bibTeXEscaper.Replace(citationSource(trial)))
+	field("note", "Trial registration "+trial.NCTID)
+	field("url", trial.URL)
+	field("year", citationYear(trial))
+	b.WriteString("}\n\n")
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// WithEffectiveConfig sets the configuration reported by GetConfig. Callers must leave out
+// or redact secrets; the map is served as is.
+func WithEffectiveConfig(config map[string]interface{}) Option {
+	return func(h *TrialsHandler) {
+		h.config = config
+	}
+}
+
+// GetConfig handles GET and HEAD /api/v1/config.
+// It reports the service's resolved, non-secret configuration so operators can check a
+// deployment without reading startup logs. The route is meant to sit behind admin auth.
+func (h *TrialsHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	config := h.config
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	h.writeJSON(w, r, http.StatusOK, config)
+}
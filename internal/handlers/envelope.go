@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/middleware"
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// cacheHitKey marks a request whose response is served from cache
+type cacheHitKey struct{}
+
+// WithEnvelope makes the { "data", "meta", "errors" } envelope the default response format.
+// Clients can still choose per request with ?envelope=true or ?envelope=false.
+func WithEnvelope(enabled bool) Option {
+	return func(h *TrialsHandler) {
+		h.envelope = enabled
+	}
+}
+
+// wantsEnvelope reports whether the response to r is wrapped in an envelope
+func (h *TrialsHandler) wantsEnvelope(r *http.Request) bool {
+	if enabled, err := strconv.ParseBool(r.URL.Query().Get("envelope")); err == nil {
+		return enabled
+	}
+	return h.envelope
+}
+
+// withCacheHit marks r as served from cache, for the envelope metadata
+func withCacheHit(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), cacheHitKey{}, true))
+}
+
+// envelopeMeta collects the request ID, elapsed time and cache status of r
+func envelopeMeta(r *http.Request) models.EnvelopeMeta {
+	ctx := r.Context()
+	meta := models.EnvelopeMeta{RequestID: middleware.RequestIDFromContext(ctx)}
+	if start := middleware.RequestStartFromContext(ctx); !start.IsZero() {
+		meta.DurationMs = time.Since(start).Milliseconds()
+	}
+	meta.CacheHit, _ = ctx.Value(cacheHitKey{}).(bool)
+	return meta
+}
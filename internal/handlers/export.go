@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// DefaultExportTTL is how long an export cursor survives without being resumed
+const DefaultExportTTL = time.Hour
+
+// exportCursor is the resumable state of an export: the search it runs, the page token of
+// the next page to serve and the upstream total reported by the first page. An empty
+// PageToken means the first page.
+type exportCursor struct {
+	Request            models.SearchRequest
+	PageToken          string
+	UpstreamTotalCount int
+}
+
+// WithExportTTL sets how long export cursors are kept after the last page served.
+// Values of 0 or less keep DefaultExportTTL.
+func WithExportTTL(ttl time.Duration) Option {
+	return func(h *TrialsHandler) {
+		if ttl > 0 {
+			h.exportTTL = ttl
+		}
+	}
+}
+
+// newExportID returns a random, unguessable export ID
+func newExportID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand unavailable: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// exportCacheKey returns the cache key of an export cursor
+func exportCacheKey(id string) string {
+	return "export:" + id
+}
+
+// resumeExport loads the cursor of export id and returns the search to run for its next page.
+// It writes a 404 and returns false when the export is unknown, finished or expired.
+func (h *TrialsHandler) resumeExport(w http.ResponseWriter, r *http.Request, id string) (models.SearchRequest, bool) {
+	cached, found := h.cache.Get(exportCacheKey(id))
+	cursor, ok := cached.(*exportCursor)
+	if !found || !ok {
+		logger := getLogger(r.Context())
+		logger.Warn().Str("export_id", id).Msg("Unknown or expired export")
+		h.writeError(w, r, http.StatusNotFound, "Unknown or expired export_id; start a new export with export=true")
+		return models.SearchRequest{}, false
+	}
+	req := cursor.Request
+	req.PageToken = cursor.PageToken
+	req.SkipTotal = cursor.PageToken != "" // The first page already counted the matches
+	return req, true
+}
+
+// exportTotal returns the upstream total recorded by export id's first page, or 0
+func (h *TrialsHandler) exportTotal(id string) int {
+	if cached, found := h.cache.Get(exportCacheKey(id)); found {
+		if cursor, ok := cached.(*exportCursor); ok {
+			return cursor.UpstreamTotalCount
+		}
+	}
+	return 0
+}
+
+// advanceExport records the page just served for export id. Once the last page has been
+// served the cursor is dropped, so later resumes report the export as finished.
+func (h *TrialsHandler) advanceExport(id string, req models.SearchRequest, response *models.SearchResponse) {
+	response.ExportID = id
+	if req.SkipTotal {
+		response.UpstreamTotalCount = h.exportTotal(id)
+	}
+	if response.NextPageToken == "" {
+		h.cache.Delete(exportCacheKey(id))
+		return
+	}
+	req.PageToken = ""
+	req.SkipTotal = false
+	cursor := &exportCursor{Request: req, PageToken: response.NextPageToken, UpstreamTotalCount: response.UpstreamTotalCount}
+	h.cache.SetWithTTL(exportCacheKey(id), cursor, h.exportTTL)
+}
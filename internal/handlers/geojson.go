@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// Search response formats selectable with ?format=
+const (
+	formatJSON    = "json"
+	formatGeoJSON = "geojson"
+	formatRIS     = "ris"
+	formatBibTeX  = "bibtex"
+	// formatStructured is JSON without free text, for pipelines that only want structured fields
+	formatStructured = "structured"
+)
+
+// geoJSONContentType is the media type registered for GeoJSON (RFC 7946)
+const geoJSONContentType = "application/geo+json"
+
+// writeGeoJSON writes search results as a GeoJSON FeatureCollection with one point feature
+// per geocoded trial site, for map-based frontends. Sites without coordinates are omitted.
+func (h *TrialsHandler) writeGeoJSON(w http.ResponseWriter, r *http.Request, response *models.SearchResponse) {
+	h.writeEncoded(w, r, http.StatusOK, geoJSONContentType, trialFeatures(response.Trials))
+}
+
+// trialFeatures converts trial sites to GeoJSON point features
+func trialFeatures(trials []models.Trial) models.FeatureCollection {
+	collection := models.FeatureCollection{Type: "FeatureCollection", Features: []models.Feature{}}
+	for _, trial := range trials {
+		for _, location := range trial.Locations {
+			if location.Latitude == 0 && location.Longitude == 0 {
+				continue // Not geocoded
+			}
+			collection.Features = append(collection.Features, models.Feature{
+				Type: "Feature",
+				Geometry: models.Point{
+					Type:        "Point",
+					Coordinates: [2]float64{location.Longitude, location.Latitude}, // GeoJSON order is lon, lat
+				},
+				Properties: models.FeatureProperties{
+					NCTID:  trial.NCTID,
+					Title:  trial.Title,
+					Status: trial.Status,
+					City:   location.City,
+				},
+			})
+		}
+	}
+	return collection
+}
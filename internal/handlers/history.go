@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/api"
+	"github.com/clinical-trials-microservice/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// historyCacheKey returns the cache key of a trial's record history, kept apart from the trial itself
+func historyCacheKey(nctID string) string {
+	return "history:" + nctID
+}
+
+// GetTrialHistory handles GET and HEAD /api/v1/trials/{nct_id}/history.
+// It returns the versions of the trial's ClinicalTrials.gov record with the status each
+// version reported and the sections it changed.
+func (h *TrialsHandler) GetTrialHistory(w http.ResponseWriter, r *http.Request) {
+	nctID := strings.ToUpper(mux.Vars(r)["nct_id"])
+	ctx := r.Context()
+	logger := getLogger(ctx)
+
+	if !nctIDPattern.MatchString(nctID) {
+		logger.Warn().Str("nct_id", nctID).Msg("Invalid NCT ID for history")
+		h.writeError(w, r, http.StatusBadRequest, "Invalid NCT ID "+nctID+": must look like NCT01234567")
+		return
+	}
+	if registry := r.URL.Query().Get("registry"); registry != "" && registry != api.RegistryClinicalTrialsGov {
+		logger.Warn().Str("registry", registry).Msg("History requested from unsupported registry")
+		h.writeError(w, r, http.StatusBadRequest, "history is only available for registry "+api.RegistryClinicalTrialsGov)
+		return
+	}
+
+	logger.Info().Str("nct_id", nctID).Msg("Get trial history request")
+
+	cacheKey := historyCacheKey(nctID)
+	if h.cacheEnabled {
+		if cached, found := h.cacheLookup(ctx, cacheKey); found {
+			if history, ok := cached.(*models.TrialHistory); ok {
+				logger.Info().Str("nct_id", nctID).Str("cache_key", cacheKey).Msg("Cache hit")
+				setCacheStatus(w, true)
+				h.writeJSON(w, withCacheHit(r), http.StatusOK, history)
+				return
+			}
+		}
+	}
+
+	setCacheStatus(w, false)
+	history, err := h.apiClient.GetTrialHistory(ctx, nctID)
+	if err != nil {
+		logger.Error().Err(err).Str("nct_id", nctID).Msg("Error getting trial history")
+		if errors.Is(err, api.ErrTrialNotFound) {
+			h.writeError(w, r, http.StatusNotFound, "Trial not found: "+nctID)
+			return
+		}
+		h.writeError(w, r, upstreamErrorStatus(err, http.StatusBadGateway), "Failed to get trial history: "+err.Error())
+		return
+	}
+
+	if h.cacheEnabled {
+		h.cache.Set(cacheKey, history)
+	}
+
+	logger.Info().
+		Str("nct_id", nctID).
+		Int("versions", len(history.Versions)).
+		Msg("Get trial history completed")
+
+	h.writeJSON(w, r, http.StatusOK, history)
+}
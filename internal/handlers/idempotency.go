@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader carries a client-chosen key that makes retrying a request safe
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed for a repeated Idempotency-Key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// DefaultIdempotencyTTL is how long the response to an Idempotency-Key is replayed
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// maxIdempotencyKeyLength bounds the Idempotency-Key values accepted
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotentResponse is the stored outcome of a request made with an Idempotency-Key.
+// Until the first request completes it only holds the fingerprint, with done unset.
+type idempotentResponse struct {
+	fingerprint string // Hash of the request the key was first used with
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+}
+
+// WithIdempotencyTTL sets how long responses to an Idempotency-Key are replayed.
+// Values of 0 or less keep DefaultIdempotencyTTL.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(h *TrialsHandler) {
+		if ttl > 0 {
+			h.idempotencyTTL = ttl
+		}
+	}
+}
+
+// idempotencyCacheKey returns the cache key of the response stored for an Idempotency-Key
+func idempotencyCacheKey(key string) string {
+	return "idempotency:" + key
+}
+
+// requestFingerprint hashes the method, path, query and body of a request, so a key reused
+// for a different request can be told apart from a retry
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Idempotent makes a state-changing handler safe to retry. When a request carries an
+// Idempotency-Key, the response is stored for the idempotency TTL and replayed, without
+// running next again, to later requests with the same key. A key reused for a different
+// request gets a 422 and one whose first request is still running a 409. Server errors are
+// not stored, so the retry runs again. Responses are kept in the cache even when caching of
+// upstream data is disabled, like export cursors.
+func (h *TrialsHandler) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		logger := getLogger(r.Context())
+		if len(key) > maxIdempotencyKeyLength {
+			logger.Warn().Int("length", len(key)).Msg("Idempotency-Key too long")
+			h.writeError(w, r, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Warn().Err(err).Msg("Failed to read request body")
+			h.writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(r, body)
+
+		cacheKey := idempotencyCacheKey(key)
+		if !h.cache.Add(cacheKey, &idempotentResponse{fingerprint: fingerprint}) {
+			h.replayIdempotent(w, r, key, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		if recorder.status >= http.StatusInternalServerError {
+			h.cache.Delete(cacheKey)
+			return
+		}
+		h.cache.SetWithTTL(cacheKey, &idempotentResponse{
+			fingerprint: fingerprint,
+			done:        true,
+			status:      recorder.status,
+			header:      recorder.header,
+			body:        recorder.body.Bytes(),
+		}, h.idempotencyTTL)
+	}
+}
+
+// replayIdempotent answers a request whose Idempotency-Key was already used
+func (h *TrialsHandler) replayIdempotent(w http.ResponseWriter, r *http.Request, key, fingerprint string) {
+	logger := getLogger(r.Context()).With().Str("idempotency_key", key).Logger()
+	cached, _ := h.cache.Get(idempotencyCacheKey(key))
+	stored, ok := cached.(*idempotentResponse)
+	switch {
+	case !ok:
+		// Expired between the Add and the Get; a retry will run the request
+		h.writeError(w, r, http.StatusConflict, "A request with this Idempotency-Key just completed; retry it")
+	case stored.fingerprint != fingerprint:
+		logger.Warn().Msg("Idempotency-Key reused for a different request")
+		h.writeError(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	case !stored.done:
+		logger.Warn().Msg("Idempotency-Key request still in progress")
+		h.writeError(w, r, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+	default:
+		logger.Info().Int("status", stored.status).Msg("Replaying idempotent response")
+		for name, values := range stored.header {
+			if _, set := w.Header()[name]; !set {
+				w.Header()[name] = values // Headers of this request, such as X-Request-ID, take precedence
+			}
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(stored.status)
+		w.Write(stored.body)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of its status, headers
+// and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.status = status
+		rec.header = rec.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/clinical-trials-microservice/internal/api"
+)
+
+// NearbyTrials handles GET and HEAD /api/v1/trials/nearby: recruiting trials around the given
+// latitude/longitude, closest first, each with only its nearest site. Conditions default to
+// the SCI terms unless conditions or query are given; distance, paging and the other search
+// filters work as on /trials/search. It saves patient apps from rebuilding the same query.
+func (h *TrialsHandler) NearbyTrials(w http.ResponseWriter, r *http.Request) {
+	req := h.parseSearchRequest(r)
+	if !req.HasCoordinates() {
+		logger := getLogger(r.Context())
+		logger.Warn().Msg("Nearby search without coordinates")
+		h.writeError(w, r, http.StatusBadRequest, "latitude and longitude are required")
+		return
+	}
+
+	req.Status = append([]string(nil), api.RecruitingStatuses...)
+	req.Sort = api.SortDistance
+	req.NearestOnly = true
+	h.serveSearch(w, r, req, "")
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// pageTokenMACSize is the number of HMAC-SHA256 bytes kept in a page token signature
+const pageTokenMACSize = 16
+
+var (
+	// errMalformedPageToken is returned for page tokens that were not issued by this service
+	errMalformedPageToken = errors.New("malformed page_token")
+	// errPageTokenMismatch is returned when a page token is replayed against a different query
+	errPageTokenMismatch = errors.New("page_token does not belong to this query")
+)
+
+// pageCursor is the position a page token points at: an upstream page plus an offset
+// into it, used when a response was truncated before the end of the upstream page
+type pageCursor struct {
+	Token  string `json:"t,omitempty"` // Upstream page token; empty for the first upstream page
+	Offset int    `json:"o,omitempty"` // Trials of the upstream page already returned
+}
+
+// pageTokenSigner wraps page cursors in an opaque envelope signed together with the
+// query they belong to, so clients cannot tamper with them or reuse them across queries.
+// The envelope is "<base64url cursor JSON>.<base64url truncated HMAC>".
+type pageTokenSigner struct {
+	key []byte
+}
+
+// newPageTokenSigner creates a signer with the given secret, or a random per-process key when empty
+func newPageTokenSigner(secret string) *pageTokenSigner {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic("crypto/rand unavailable: " + err.Error())
+		}
+	}
+	return &pageTokenSigner{key: key}
+}
+
+// seal wraps a cursor for the query identified by scope
+func (s *pageTokenSigner) seal(cursor pageCursor, scope string) string {
+	payload, _ := json.Marshal(cursor) // A struct of a string and an int always marshals
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload, scope))
+}
+
+// open validates a sealed token against the query identified by scope and returns its cursor
+func (s *pageTokenSigner) open(token, scope string) (pageCursor, error) {
+	var cursor pageCursor
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || encoded == "" {
+		return cursor, errMalformedPageToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, errMalformedPageToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(mac) != pageTokenMACSize {
+		return cursor, errMalformedPageToken
+	}
+	if !hmac.Equal(mac, s.mac(payload, scope)) {
+		return cursor, errPageTokenMismatch
+	}
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.Offset < 0 {
+		return pageCursor{}, errMalformedPageToken
+	}
+	return cursor, nil
+}
+
+// mac computes the truncated signature binding a cursor to its query
+func (s *pageTokenSigner) mac(payload []byte, scope string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(scope))
+	m.Write([]byte{0})
+	m.Write(payload)
+	return m.Sum(nil)[:pageTokenMACSize]
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// NotFound returns the handler for requests no route of router matches. Unknown paths get a
+// JSON 404 naming the path. Known paths requested with another method get the 405 of
+// MethodNotAllowed: mux does not always report those as method mismatches when subrouter
+// routes share a path prefix.
+func (h *TrialsHandler) NotFound(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowed := allowedMethods(router, r); len(allowed) > 0 {
+			h.writeMethodNotAllowed(w, r, allowed)
+			return
+		}
+		if h.wantsEnvelope(r) {
+			h.writeError(w, r, http.StatusNotFound, "not found: "+r.URL.Path)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "not found", "path": r.URL.Path})
+	})
+}
+
+// MethodNotAllowed returns the handler for requests to a known path with a method none of
+// its routes accept. It answers 405 with an Allow header listing the methods the path supports.
+func (h *TrialsHandler) MethodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.writeMethodNotAllowed(w, r, allowedMethods(router, r))
+	})
+}
+
+// writeMethodNotAllowed writes a 405 listing the allowed methods in the Allow header
+func (h *TrialsHandler) writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	h.writeError(w, r, http.StatusMethodNotAllowed, "Method "+r.Method+" not allowed; use "+strings.Join(allowed, ", "))
+}
+
+// allowedMethods lists, sorted, the methods of every route in router whose path matches r
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	seen := make(map[string]bool)
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil || len(methods) == 0 {
+			return nil // Prefix routes and routes accepting any method
+		}
+		probe := r.Clone(r.Context())
+		probe.Method = methods[0]
+		var match mux.RouteMatch
+		if route.Match(probe, &match) && match.MatchErr == nil {
+			for _, method := range methods {
+				seen[method] = true
+			}
+		}
+		return nil
+	})
+
+	allowed := make([]string, 0, len(seen))
+	for method := range seen {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
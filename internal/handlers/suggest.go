@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/api"
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// SuggestConditions handles GET and HEAD /api/v1/conditions/suggest?q=.
+// It returns condition names completing q for search box typeahead. Suggestions come from
+// a curated local list, so keystrokes never reach the upstream; results are cached by prefix.
+func (h *TrialsHandler) SuggestConditions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := getLogger(ctx)
+
+	prefix := strings.ToLower(strings.Join(strings.Fields(r.URL.Query().Get("q")), " "))
+	if prefix == "" {
+		logger.Warn().Msg("Condition suggestion without q")
+		h.writeError(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+	limit := api.DefaultSuggestLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > api.MaxSuggestLimit {
+			logger.Warn().Str("limit", value).Msg("Invalid suggestion limit")
+			h.writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid limit %q: must be between 1 and %d", value, api.MaxSuggestLimit))
+			return
+		}
+		limit = n
+	}
+
+	cacheKey := fmt.Sprintf("suggest:conditions:%d:%s", limit, prefix)
+	if h.cacheEnabled {
+		if cached, found := h.cacheLookup(ctx, cacheKey); found {
+			if suggestions, ok := cached.(*models.ConditionSuggestions); ok {
+				setCacheStatus(w, true)
+				h.writeJSON(w, withCacheHit(r), http.StatusOK, suggestions)
+				return
+			}
+		}
+	}
+
+	setCacheStatus(w, false)
+	suggestions := &models.ConditionSuggestions{
+		Query:       prefix,
+		Suggestions: api.SuggestConditions(prefix, limit),
+	}
+	if h.cacheEnabled {
+		h.cache.Set(cacheKey, suggestions)
+	}
+
+	logger.Debug().
+		Str("q", prefix).
+		Int("suggestions", len(suggestions.Suggestions)).
+		Msg("Condition suggestions")
+
+	h.writeJSON(w, r, http.StatusOK, suggestions)
+}
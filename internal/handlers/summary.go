@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// unknownCountry groups sites whose country the registry did not report
+const unknownCountry = "Unknown"
+
+// SummarizeLocations handles GET and HEAD /api/v1/trials/summary/locations.
+// It runs the search described by the usual search parameters and returns how many
+// trials and sites fall in each country and state. Counts cover the first page of
+// results, so page_size bounds how many trials are summarized.
+func (h *TrialsHandler) SummarizeLocations(w http.ResponseWriter, r *http.Request) {
+	req := h.parseSearchRequest(r)
+	req.PageToken = "" // Summaries always start from the first page
+	ctx := r.Context()
+	logger := getLogger(ctx)
+
+	logger.Info().
+		Strs("conditions", req.Conditions).
+		Strs("status", req.Status).
+		Int("page_size", req.PageSize).
+		Msg("Location summary request")
+
+	if err := h.validateSearchRequest(req); err != nil {
+		logger.Warn().Err(err).Msg("Invalid search request")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.applyConditionAllowlist(&req); err != nil {
+		logger.Warn().Err(err).Msg("Search conditions outside the allowlist")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	registry, ok := h.registryFor(req.Registry)
+	if !ok {
+		logger.Warn().Str("registry", req.Registry).Msg("Unknown registry requested")
+		h.writeError(w, r, http.StatusBadRequest, "Unknown registry: "+req.Registry)
+		return
+	}
+
+	cacheKey := h.generateCacheKey("summary:locations", req)
+	if h.cacheEnabled {
+		if cached, found := h.cacheLookup(ctx, cacheKey); found {
+			if summary, ok := cached.(*models.LocationSummary); ok {
+				logger.Info().Str("cache_key", cacheKey).Msg("Cache hit")
+				setCacheStatus(w, true)
+				h.writeJSON(w, withCacheHit(r), http.StatusOK, summary)
+				return
+			}
+		}
+	}
+
+	setCacheStatus(w, false)
+	response, err := registry.Search(ctx, req)
+	if err != nil {
+		logger.Error().Err(err).Msg("Error searching trials for location summary")
+		h.writeSearchError(w, r, err)
+		return
+	}
+
+	summary := summarizeLocations(response)
+	if h.cacheEnabled && !response.Partial {
+		h.cache.Set(cacheKey, summary) // Counts of a fill_page scan cut short are not pinned
+	}
+
+	logger.Info().
+		Int("trials_summarized", summary.TrialsSummarized).
+		Int("countries", len(summary.Countries)).
+		Msg("Location summary completed")
+
+	h.writeJSON(w, r, http.StatusOK, summary)
+}
+
+// summarizeLocations counts trials and sites per country and per state. A trial counts
+// once for every country or state it has at least one site in.
+func summarizeLocations(response *models.SearchResponse) *models.LocationSummary {
+	summary := &models.LocationSummary{
+		TotalCount:       response.UpstreamTotalCount,
+		TrialsSummarized: len(response.Trials),
+		Countries:        []models.LocationCount{},
+		States:           []models.LocationCount{},
+	}
+
+	countries := make(map[string]*models.LocationCount)
+	states := make(map[[2]string]*models.LocationCount)
+	for _, trial := range response.Trials {
+		if len(trial.Locations) == 0 {
+			summary.TrialsWithoutLocations++
+			continue
+		}
+
+		seenCountries := make(map[string]bool)
+		seenStates := make(map[[2]string]bool)
+		for _, location := range trial.Locations {
+			country := strings.TrimSpace(location.Country)
+			if country == "" {
+				country = unknownCountry
+			}
+			countryCount, ok := countries[country]
+			if !ok {
+				countryCount = &models.LocationCount{Country: country}
+				countries[country] = countryCount
+			}
+			countryCount.Sites++
+			if !seenCountries[country] {
+				seenCountries[country] = true
+				countryCount.Trials++
+			}
+
+			state := strings.TrimSpace(location.State)
+			if state == "" {
+				continue
+			}
+			key := [2]string{country, state}
+			stateCount, ok := states[key]
+			if !ok {
+				stateCount = &models.LocationCount{Country: country, State: state}
+				states[key] = stateCount
+			}
+			stateCount.Sites++
+			if !seenStates[key] {
+				seenStates[key] = true
+				stateCount.Trials++
+			}
+		}
+	}
+
+	for _, count := range countries {
+		summary.Countries = append(summary.Countries, *count)
+	}
+	for _, count := range states {
+		summary.States = append(summary.States, *count)
+	}
+	sortLocationCounts(summary.Countries)
+	sortLocationCounts(summary.States)
+	return summary
+}
+
+// sortLocationCounts orders counts by trials, then sites, descending, then by name
+func sortLocationCounts(counts []models.LocationCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Trials != b.Trials {
+			return a.Trials > b.Trials
+		}
+		if a.Sites != b.Sites {
+			return a.Sites > b.Sites
+		}
+		if a.Country != b.Country {
+			return a.Country < b.Country
+		}
+		return a.State < b.State
+	})
+}
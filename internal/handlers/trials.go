@@ -1,40 +1,198 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/clinical-trials-microservice/internal/api"
 	"github.com/clinical-trials-microservice/internal/cache"
+	"github.com/clinical-trials-microservice/internal/logging"
 	"github.com/clinical-trials-microservice/internal/middleware"
 	"github.com/clinical-trials-microservice/internal/models"
+	"github.com/clinical-trials-microservice/internal/tracing"
+	"github.com/clinical-trials-microservice/internal/version"
+	"github.com/clinical-trials-microservice/internal/watch"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Default caps on list parameters per search; long OR'd lists bloat the upstream query
+const (
+	DefaultMaxConditions = 20
+	DefaultMaxPhases     = 10
+	DefaultMaxStatuses   = 15
+)
+
+// DefaultMaxQueryLength caps the URL-encoded condition query sent upstream, well below the
+// URL length at which ClinicalTrials.gov answers 414
+const DefaultMaxQueryLength = 2000
+
+// MaxNCTIDs caps the nct_ids a search may list
+const MaxNCTIDs = 100
+
+// nctIDPattern matches a ClinicalTrials.gov identifier
+var nctIDPattern = regexp.MustCompile(`^NCT\d{8}$`)
+
+// defaultCacheControl lets clients and CDNs reuse trial responses briefly; trial data changes slowly
+const defaultCacheControl = "public, max-age=300"
+
 // TrialsHandler handles trial-related HTTP requests
 type TrialsHandler struct {
 	apiClient    *api.ClinicalTrialsClient
 	cache        *cache.Cache
 	cacheEnabled bool
+	debug        bool
+	registries   map[string]api.Registry
+	pageTokens   *pageTokenSigner
+	// maxResponseTrials caps the trials returned per response; 0 means no cap
+	maxResponseTrials int
+	maxPageSize       int                 // Largest page_size a search may ask for; larger requests are rejected
+	allowlist         *conditionAllowlist // nil means any condition may be searched
+	maxConditions     int
+	maxQueryLength    int // Longest URL-encoded condition query a search may send upstream
+	maxPhases         int
+	maxStatuses       int
+	exportTTL         time.Duration
+	envelope          bool                   // Wrap responses in models.Envelope unless the request opts out
+	config            map[string]interface{} // Effective configuration served by GetConfig
+	watcher           *watch.Watcher         // nil disables the /watch endpoints
+	idempotencyTTL    time.Duration          // How long responses to an Idempotency-Key are replayed
+}
+
+// Option configures optional TrialsHandler behavior
+type Option func(*TrialsHandler)
+
+// WithDebug enables troubleshooting features such as ?explain=true that expose service internals
+func WithDebug(enabled bool) Option {
+	return func(h *TrialsHandler) {
+		h.debug = enabled
+	}
+}
+
+// WithRegistry makes an additional trial registry selectable via the registry query param
+func WithRegistry(registry api.Registry) Option {
+	return func(h *TrialsHandler) {
+		h.registries[registry.Name()] = registry
+	}
+}
+
+// WithPageTokenSecret sets the key used to sign page tokens handed to clients.
+// Instances behind the same load balancer must share it; by default a random per-process key is used.
+func WithPageTokenSecret(secret string) Option {
+	return func(h *TrialsHandler) {
+		h.pageTokens = newPageTokenSigner(secret)
+	}
+}
+
+// WithMaxResponseTrials caps the number of trials returned per search response, independent
+// of the upstream page size. Truncated responses carry a page token resuming after the last trial.
+func WithMaxResponseTrials(n int) Option {
+	return func(h *TrialsHandler) {
+		h.maxResponseTrials = max(n, 0)
+	}
+}
+
+// WithMaxPageSize sets the largest page_size a search may ask for, so a broad search cannot
+// pull a huge result set in one response; larger requests get a 400 pointing to pagination.
+// Values outside 1..api.MaxPageSize are ignored.
+func WithMaxPageSize(n int) Option {
+	return func(h *TrialsHandler) {
+		if n > 0 && n <= api.MaxPageSize {
+			h.maxPageSize = n
+		}
+	}
+}
+
+// WithSearchLimits caps the number of conditions, phases and statuses a search may list.
+// Values of 0 or less keep the defaults.
+func WithSearchLimits(conditions, phases, statuses int) Option {
+	return func(h *TrialsHandler) {
+		if conditions > 0 {
+			h.maxConditions = conditions
+		}
+		if phases > 0 {
+			h.maxPhases = phases
+		}
+		if statuses > 0 {
+			h.maxStatuses = statuses
+		}
+	}
+}
+
+// WithMaxQueryLength caps the URL-encoded length of the condition query a search sends
+// upstream; longer searches get a 400 instead of an opaque upstream 414.
+// Values of 0 or less keep the default.
+func WithMaxQueryLength(n int) Option {
+	return func(h *TrialsHandler) {
+		if n > 0 {
+			h.maxQueryLength = n
+		}
+	}
 }
 
 // NewTrialsHandler creates a new trials handler
-func NewTrialsHandler(apiClient *api.ClinicalTrialsClient, cache *cache.Cache, cacheEnabled bool) *TrialsHandler {
-	return &TrialsHandler{
-		apiClient:    apiClient,
-		cache:        cache,
-		cacheEnabled: cacheEnabled,
+func NewTrialsHandler(apiClient *api.ClinicalTrialsClient, cache *cache.Cache, cacheEnabled bool, opts ...Option) *TrialsHandler {
+	h := &TrialsHandler{
+		apiClient:      apiClient,
+		cache:          cache,
+		cacheEnabled:   cacheEnabled,
+		registries:     make(map[string]api.Registry),
+		maxConditions:  DefaultMaxConditions,
+		maxQueryLength: DefaultMaxQueryLength,
+		maxPhases:      DefaultMaxPhases,
+		maxStatuses:    DefaultMaxStatuses,
+		exportTTL:      DefaultExportTTL,
+		maxPageSize:    api.MaxPageSize,
+		idempotencyTTL: DefaultIdempotencyTTL,
+	}
+	if apiClient != nil {
+		h.registries[api.RegistryClinicalTrialsGov] = apiClient
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.pageTokens == nil {
+		h.pageTokens = newPageTokenSigner("")
 	}
+	return h
 }
 
-// SearchTrials handles GET /api/v1/trials/search
+// SearchTrials handles GET and HEAD /api/v1/trials/search.
+// export=true starts a resumable export whose export_id serves the following pages;
+// when resuming with export_id the stored search is used and other search params are ignored.
 func (h *TrialsHandler) SearchTrials(w http.ResponseWriter, r *http.Request) {
-	req := h.parseSearchRequest(r)
+	if exportID := r.URL.Query().Get("export_id"); exportID != "" {
+		req, ok := h.resumeExport(w, r, exportID)
+		if !ok {
+			return
+		}
+		h.serveSearch(w, r, req, exportID)
+		return
+	}
+	exportID := ""
+	if export, _ := strconv.ParseBool(r.URL.Query().Get("export")); export {
+		exportID = newExportID()
+	}
+	h.serveSearch(w, r, h.parseSearchRequest(r), exportID)
+}
+
+// serveSearch validates and runs a parsed GET search, serving it from cache when possible.
+// A non-empty exportID advances that export's cursor past the page served.
+func (h *TrialsHandler) serveSearch(w http.ResponseWriter, r *http.Request, req models.SearchRequest, exportID string) {
 	ctx := r.Context()
 	logger := getLogger(ctx)
 
@@ -46,6 +204,52 @@ func (h *TrialsHandler) SearchTrials(w http.ResponseWriter, r *http.Request) {
 		Int("page_size", req.PageSize).
 		Msg("Search trials request")
 
+	if err := h.validateSearchRequest(req); err != nil {
+		logger.Warn().Err(err).Msg("Invalid search request")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.applyConditionAllowlist(&req); err != nil {
+		logger.Warn().Err(err).Msg("Search conditions outside the allowlist")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	switch format {
+	case "", formatJSON, formatGeoJSON, formatRIS, formatBibTeX:
+	case formatStructured:
+		req.OmitText = true
+	default:
+		logger.Warn().Str("format", format).Msg("Unsupported response format")
+		h.writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid format %q: must be %q, %q, %q, %q or %q", format, formatJSON, formatStructured, formatGeoJSON, formatRIS, formatBibTeX))
+		return
+	}
+	offset, ok := h.openPageToken(w, r, &req)
+	if !ok {
+		return
+	}
+
+	// Explain mode echoes the upstream query instead of executing it
+	if explain, _ := strconv.ParseBool(r.URL.Query().Get("explain")); explain {
+		if !h.debug {
+			logger.Warn().Msg("Explain requested but debug mode is disabled")
+			h.writeError(w, r, http.StatusForbidden, "explain is only available when debug mode is enabled")
+			return
+		}
+		h.writeJSON(w, r, http.StatusOK, models.ExplainResponse{
+			UpstreamURL: h.apiClient.BuildSearchURL(req),
+			Request:     req,
+		})
+		return
+	}
+
+	registry, ok := h.registryFor(req.Registry)
+	if !ok {
+		logger.Warn().Str("registry", req.Registry).Msg("Unknown registry requested")
+		h.writeError(w, r, http.StatusBadRequest, "Unknown registry: "+req.Registry)
+		return
+	}
+
 	// Check cache if enabled
 	var response *models.SearchResponse
 	var err error
@@ -53,34 +257,42 @@ func (h *TrialsHandler) SearchTrials(w http.ResponseWriter, r *http.Request) {
 
 	if h.cacheEnabled {
 		cacheKey := h.generateCacheKey("search", req)
-		if cached, found := h.cache.Get(cacheKey); found {
+		if cached, found := h.cacheLookup(ctx, cacheKey); found {
 			if cachedResp, ok := cached.(*models.SearchResponse); ok {
 				cacheHit = true
 				logger.Info().
 					Str("cache_key", cacheKey).
 					Int("total_count", cachedResp.TotalCount).
 					Msg("Cache hit")
-				h.writeJSON(w, http.StatusOK, cachedResp)
+				setCacheStatus(w, cacheHit)
+				h.writeSearchResponse(w, withCacheHit(r), format, h.presentExportPage(exportID, req, offset, cachedResp))
 				return
 			}
 		}
 	}
 
 	// Make API call
-	response, err = h.apiClient.SearchTrials(req)
+	setCacheStatus(w, cacheHit)
+	response, err = registry.Search(ctx, req)
 	if err != nil {
 		logger.Error().
 			Err(err).
 			Bool("cache_hit", cacheHit).
 			Msg("Error searching trials")
-		h.writeError(w, http.StatusInternalServerError, "Failed to search trials: "+err.Error())
+		h.writeSearchError(w, r, err)
 		return
 	}
 
-	// Store in cache if enabled
+	applySort(req, response)
+
+	// Store in cache if enabled. A partial page is not cached, so one transient upstream
+	// error does not pin a truncated page for the whole TTL.
 	if h.cacheEnabled {
-		cacheKey := h.generateCacheKey("search", req)
-		h.cache.Set(cacheKey, response)
+		if !response.Partial {
+			cacheKey := h.generateCacheKey("search", req)
+			h.cache.Set(cacheKey, response)
+		}
+		h.seedTrialCache(req, response)
 	}
 
 	// Log successful response
@@ -90,10 +302,33 @@ func (h *TrialsHandler) SearchTrials(w http.ResponseWriter, r *http.Request) {
 		Int("trials_returned", len(response.Trials)).
 		Msg("Search trials completed")
 
-	h.writeJSON(w, http.StatusOK, response)
+	h.writeSearchResponse(w, r, format, h.presentExportPage(exportID, req, offset, response))
+}
+
+// presentExportPage presents a search response and, for exports, advances the export cursor
+func (h *TrialsHandler) presentExportPage(exportID string, req models.SearchRequest, offset int, response *models.SearchResponse) *models.SearchResponse {
+	presented := h.presentSearchResponse(req, offset, response)
+	if exportID != "" {
+		h.advanceExport(exportID, req, presented)
+	}
+	return presented
+}
+
+// writeSearchResponse writes a presented search response in the requested format
+func (h *TrialsHandler) writeSearchResponse(w http.ResponseWriter, r *http.Request, format string, response *models.SearchResponse) {
+	switch format {
+	case formatGeoJSON:
+		h.writeGeoJSON(w, r, response)
+	case formatRIS:
+		h.writeRIS(w, r, response)
+	case formatBibTeX:
+		h.writeBibTeX(w, r, response)
+	default:
+		h.writeJSON(w, r, http.StatusOK, response)
+	}
 }
 
-// GetTrialByID handles GET /api/v1/trials/{nct_id}
+// GetTrialByID handles GET and HEAD /api/v1/trials/{nct_id}
 func (h *TrialsHandler) GetTrialByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	nctID := vars["nct_id"]
@@ -102,11 +337,27 @@ func (h *TrialsHandler) GetTrialByID(w http.ResponseWriter, r *http.Request) {
 
 	if nctID == "" {
 		logger.Warn().Msg("NCT ID is required")
-		h.writeError(w, http.StatusBadRequest, "NCT ID is required")
+		h.writeError(w, r, http.StatusBadRequest, "NCT ID is required")
+		return
+	}
+
+	registryName := r.URL.Query().Get("registry")
+	registry, ok := h.registryFor(registryName)
+	if !ok {
+		logger.Warn().Str("registry", registryName).Msg("Unknown registry requested")
+		h.writeError(w, r, http.StatusBadRequest, "Unknown registry: "+registryName)
 		return
 	}
 
-	logger.Info().Str("nct_id", nctID).Msg("Get trial by ID request")
+	logger.Info().Str("nct_id", nctID).Str("registry", registry.Name()).Msg("Get trial by ID request")
+
+	// The untransformed upstream study is only kept for ClinicalTrials.gov
+	raw, _ := strconv.ParseBool(r.URL.Query().Get("raw"))
+	if raw && registry.Name() != api.RegistryClinicalTrialsGov {
+		logger.Warn().Str("registry", registry.Name()).Msg("Raw study requested from unsupported registry")
+		h.writeError(w, r, http.StatusBadRequest, "raw is only available for registry "+api.RegistryClinicalTrialsGov)
+		return
+	}
 
 	// Check cache if enabled
 	var trial *models.Trial
@@ -114,35 +365,42 @@ func (h *TrialsHandler) GetTrialByID(w http.ResponseWriter, r *http.Request) {
 	cacheHit := false
 
 	if h.cacheEnabled {
-		cacheKey := "trial:" + nctID
-		if cached, found := h.cache.Get(cacheKey); found {
-			if cachedTrial, ok := cached.(*models.Trial); ok {
+		cacheKey := trialCacheKey(registry.Name(), nctID)
+		if cached, found := h.cacheLookup(ctx, cacheKey); found {
+			// Entries seeded from search results have no raw study; fetch it then
+			if cachedTrial, ok := cached.(*models.Trial); ok && (!raw || cachedTrial.Raw != nil) {
 				cacheHit = true
 				logger.Info().
 					Str("nct_id", nctID).
 					Str("cache_key", cacheKey).
 					Msg("Cache hit")
-				h.writeJSON(w, http.StatusOK, cachedTrial)
+				setCacheStatus(w, cacheHit)
+				h.writeTrial(w, withCacheHit(r), raw, cachedTrial)
 				return
 			}
 		}
 	}
 
 	// Make API call
-	trial, err = h.apiClient.GetTrialDetails(nctID)
+	setCacheStatus(w, cacheHit)
+	trial, err = registry.GetByID(ctx, nctID)
 	if err != nil {
 		logger.Error().
 			Err(err).
 			Str("nct_id", nctID).
 			Bool("cache_hit", cacheHit).
 			Msg("Error getting trial details")
-		h.writeError(w, http.StatusNotFound, "Trial not found: "+err.Error())
+		if status := upstreamErrorStatus(err, http.StatusNotFound); status != http.StatusNotFound {
+			h.writeError(w, r, status, "Failed to get trial: "+err.Error())
+			return
+		}
+		h.writeError(w, r, http.StatusNotFound, "Trial not found: "+err.Error())
 		return
 	}
 
 	// Store in cache if enabled
 	if h.cacheEnabled {
-		cacheKey := "trial:" + nctID
+		cacheKey := trialCacheKey(registry.Name(), nctID)
 		h.cache.Set(cacheKey, trial)
 	}
 
@@ -152,7 +410,24 @@ func (h *TrialsHandler) GetTrialByID(w http.ResponseWriter, r *http.Request) {
 		Str("title", trial.Title).
 		Msg("Get trial completed")
 
-	h.writeJSON(w, http.StatusOK, trial)
+	h.writeTrial(w, r, raw, trial)
+}
+
+// writeTrial writes a trial, or its untransformed upstream study when raw is set
+func (h *TrialsHandler) writeTrial(w http.ResponseWriter, r *http.Request, raw bool, trial *models.Trial) {
+	if !raw {
+		h.writeJSON(w, r, http.StatusOK, trial)
+		return
+	}
+	if trial.Raw == nil {
+		h.writeError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Raw study exceeds the %d byte limit", api.MaxRawStudyBytes))
+		return
+	}
+	h.writeJSON(w, r, http.StatusOK, models.RawTrialResponse{
+		NCTID:    trial.NCTID,
+		Registry: trial.Registry,
+		Raw:      trial.Raw,
+	})
 }
 
 // SearchTrialsPost handles POST /api/v1/trials/search (with JSON body)
@@ -163,9 +438,13 @@ func (h *TrialsHandler) SearchTrialsPost(w http.ResponseWriter, r *http.Request)
 	var req models.SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Warn().Err(err).Msg("Invalid request body")
-		h.writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		h.writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
+	if req.PageSize <= 0 {
+		req.PageSize = h.defaultPageSize()
+	}
+	req.Conditions = api.NormalizeConditions(req.Conditions)
 
 	// Log search parameters
 	logger.Info().
@@ -175,78 +454,301 @@ func (h *TrialsHandler) SearchTrialsPost(w http.ResponseWriter, r *http.Request)
 		Int("page_size", req.PageSize).
 		Msg("POST search trials request")
 
+	if err := h.validateSearchRequest(req); err != nil {
+		logger.Warn().Err(err).Msg("Invalid search request")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.applyConditionAllowlist(&req); err != nil {
+		logger.Warn().Err(err).Msg("Search conditions outside the allowlist")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, ok := h.openPageToken(w, r, &req)
+	if !ok {
+		return
+	}
+
+	// Debug-log the decoded request so POST searches can be reproduced (raw query is empty for POST).
+	// Precise coordinates are left out; only whether a geo search was requested is logged.
+	logger.Debug().
+		Str("search_query", req.Query).
+		Strs("conditions", req.Conditions).
+		Strs("status", req.Status).
+		Strs("phase", req.Phase).
+		Str("country", req.Country).
+		Bool("geo_search", req.HasCoordinates()).
+		Int("distance", req.Distance).
+		Str("minimum_age", req.MinimumAge).
+		Str("maximum_age", req.MaximumAge).
+		Int("page_size", req.PageSize).
+		Bool("has_page_token", req.PageToken != "").
+		Msg("POST search request body")
+
+	registry, ok := h.registryFor(req.Registry)
+	if !ok {
+		logger.Warn().Str("registry", req.Registry).Msg("Unknown registry requested")
+		h.writeError(w, r, http.StatusBadRequest, "Unknown registry: "+req.Registry)
+		return
+	}
+
 	// Use same logic as GET handler (without cache for POST - can add later if needed)
-	response, err := h.apiClient.SearchTrials(req)
+	setCacheStatus(w, false)
+	response, err := registry.Search(ctx, req)
 	if err != nil {
 		logger.Error().Err(err).Msg("Error searching trials")
-		h.writeError(w, http.StatusInternalServerError, "Failed to search trials: "+err.Error())
+		h.writeSearchError(w, r, err)
 		return
 	}
 
+	applySort(req, response)
+
+	if h.cacheEnabled {
+		h.seedTrialCache(req, response)
+	}
+
 	logger.Info().
 		Int("total_count", response.TotalCount).
 		Int("trials_returned", len(response.Trials)).
 		Msg("POST search trials completed")
 
-	h.writeJSON(w, http.StatusOK, response)
+	h.writeJSON(w, r, http.StatusOK, h.presentSearchResponse(req, offset, response))
 }
 
-// Health handles GET /health
+// Health handles GET and HEAD /health
 func (h *TrialsHandler) Health(w http.ResponseWriter, r *http.Request) {
-	h.writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	w.Header().Set("Cache-Control", "no-store")
+	uptime := version.Uptime()
+	health := models.HealthResponse{
+		Status:        "healthy",
+		Version:       version.Version,
+		Commit:        version.Commit,
+		StartedAt:     version.StartTime().UTC().Format(time.RFC3339),
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: uptime.Seconds(),
+	}
+	if h.apiClient != nil {
+		health.UpstreamCircuit = string(h.apiClient.BreakerState())
+	}
+	h.writeJSON(w, r, http.StatusOK, health)
+}
+
+// Ready handles GET and HEAD /ready.
+// Unlike Health, which only reports that the process is up, it answers 503 with status
+// "degraded" while the recent upstream error rate is above the threshold or the upstream
+// circuit is open, so orchestrators can stop routing traffic until the upstream recovers.
+func (h *TrialsHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	readiness := models.ReadinessResponse{Status: "ready", UpstreamCircuit: string(api.BreakerClosed)}
+	statusCode := http.StatusOK
+	if h.apiClient != nil {
+		upstream := h.apiClient.UpstreamHealth()
+		readiness.UpstreamErrorRate = upstream.ErrorRate
+		readiness.UpstreamSamples = upstream.Samples
+		readiness.UpstreamCircuit = string(h.apiClient.BreakerState())
+		if upstream.Degraded || h.apiClient.BreakerState() == api.BreakerOpen {
+			readiness.Status = "degraded"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+	h.writeJSON(w, r, statusCode, readiness)
+}
+
+// writeSearchError reports a failed upstream search, turning rejected page tokens into a client error
+func (h *TrialsHandler) writeSearchError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, api.ErrInvalidPageToken) {
+		h.writeError(w, r, http.StatusBadRequest, "Invalid or expired page_token; restart the search without it")
+		return
+	}
+	h.writeError(w, r, upstreamErrorStatus(err, http.StatusInternalServerError), "Failed to search trials: "+err.Error())
+}
+
+// openPageToken replaces a signed client page token with the upstream token it wraps and
+// returns the offset into that upstream page to resume from. It writes a 400 and returns
+// false when the token is malformed or was issued for another query.
+func (h *TrialsHandler) openPageToken(w http.ResponseWriter, r *http.Request, req *models.SearchRequest) (int, bool) {
+	if req.PageToken == "" {
+		return 0, true
+	}
+	cursor, err := h.pageTokens.open(req.PageToken, h.pageTokenScope(*req))
+	if err != nil {
+		logger := getLogger(r.Context())
+		logger.Warn().Err(err).Msg("Rejected page token")
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	req.PageToken = cursor.Token
+	return cursor.Offset, true
+}
+
+// pageTokenScope identifies the query a page token belongs to: every search parameter
+// except the token itself and the page size, which may change between pages
+func (h *TrialsHandler) pageTokenScope(req models.SearchRequest) string {
+	req.PageToken = ""
+	req.PageSize = 0
+	req.SkipTotal = false // Tokens stay valid whichever page of a scan issued them
+	return h.generateCacheKey("page", req)
+}
+
+// setCacheStatus tells clients whether the response was served from cache via X-Cache: HIT|MISS
+func setCacheStatus(w http.ResponseWriter, hit bool) {
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+		return
+	}
+	w.Header().Set("X-Cache", "MISS")
+}
+
+// cacheLookup reads a cache entry inside a span so hits and misses show up in traces
+func (h *TrialsHandler) cacheLookup(ctx context.Context, key string) (interface{}, bool) {
+	_, span := tracing.Tracer().Start(ctx, "cache.lookup", trace.WithAttributes(attribute.String("cache.key", key)))
+	defer span.End()
+	value, found := h.cache.Get(key)
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	return value, found
+}
+
+// upstreamErrorStatus maps an upstream client error to an HTTP status code
+func upstreamErrorStatus(err error, fallback int) int {
+	if errors.Is(err, api.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	// The caller's deadline (see middleware.DeadlineMiddleware) ran out before upstream answered
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return fallback
+}
+
+// defaultPageSize returns the page size applied when the client omits page_size.
+// It reads the upstream client's setting so the handler and upstream defaults cannot drift,
+// lowered to the page size ceiling so searches without page_size are never rejected.
+func (h *TrialsHandler) defaultPageSize() int {
+	pageSize := api.DefaultPageSize
+	if h.apiClient != nil {
+		pageSize = h.apiClient.DefaultPageSize()
+	}
+	return min(pageSize, h.maxPageSize)
+}
+
+// queryList collects a list parameter sent repeated (?status=a&status=b), comma-separated
+// (?status=a,b) or both, trimming whitespace and dropping empty items
+func queryList(query url.Values, name string) []string {
+	var items []string
+	for _, value := range query[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
 }
 
 // parseSearchRequest parses query parameters into a SearchRequest
 func (h *TrialsHandler) parseSearchRequest(r *http.Request) models.SearchRequest {
 	req := models.SearchRequest{
-		PageSize: 100, // Default page size
+		PageSize: h.defaultPageSize(),
+	}
+
+	// Registry
+	if registry := r.URL.Query().Get("registry"); registry != "" {
+		req.Registry = strings.TrimSpace(registry)
 	}
 
 	// Query/Conditions
 	if query := r.URL.Query().Get("query"); query != "" {
 		req.Query = query
 	}
-	if conditions := r.URL.Query().Get("conditions"); conditions != "" {
-		req.Conditions = strings.Split(conditions, ",")
-		for i := range req.Conditions {
-			req.Conditions[i] = strings.TrimSpace(req.Conditions[i])
-		}
+	req.Conditions = api.NormalizeConditions(queryList(r.URL.Query(), "conditions"))
+	if logic := r.URL.Query().Get("condition_logic"); logic != "" {
+		req.ConditionLogic = strings.TrimSpace(logic)
+	}
+	if match := r.URL.Query().Get("match"); match != "" {
+		req.Match = strings.TrimSpace(match)
+	}
+	if advanced := r.URL.Query().Get("advanced_query"); advanced != "" {
+		req.AdvancedQuery = strings.TrimSpace(advanced)
+	}
+	for _, id := range queryList(r.URL.Query(), "nct_ids") {
+		req.NCTIDs = append(req.NCTIDs, strings.ToUpper(id))
 	}
 
 	// Status
-	if status := r.URL.Query().Get("status"); status != "" {
-		req.Status = strings.Split(status, ",")
-		for i := range req.Status {
-			req.Status[i] = strings.TrimSpace(req.Status[i])
+	req.Status = queryList(r.URL.Query(), "status")
+
+	// Inactive (terminated/withdrawn/suspended) trials are excluded unless requested
+	if includeInactive := r.URL.Query().Get("include_inactive"); includeInactive != "" {
+		if include, err := strconv.ParseBool(includeInactive); err == nil {
+			req.IncludeInactive = include
 		}
 	}
 
-	// Phase
-	if phase := r.URL.Query().Get("phase"); phase != "" {
-		req.Phase = strings.Split(phase, ",")
-		for i := range req.Phase {
-			req.Phase[i] = strings.TrimSpace(req.Phase[i])
+	// Follow upstream pages until page_size trials pass the client-side filters
+	if fillPage := r.URL.Query().Get("fill_page"); fillPage != "" {
+		if fill, err := strconv.ParseBool(fillPage); err == nil {
+			req.FillPage = fill
+		}
+	}
+
+	// Posted results
+	if hasResults := r.URL.Query().Get("has_results"); hasResults != "" {
+		if has, err := strconv.ParseBool(hasResults); err == nil {
+			req.HasResults = has
+		}
+	}
+
+	// Lead sponsor class, e.g. INDUSTRY or NIH
+	req.FunderType = queryList(r.URL.Query(), "funder_type")
+	for i := range req.FunderType {
+		req.FunderType[i] = strings.ToUpper(req.FunderType[i])
+	}
+
+	// Contact availability
+	if hasContact := r.URL.Query().Get("has_contact"); hasContact != "" {
+		if has, err := strconv.ParseBool(hasContact); err == nil {
+			req.HasContact = has
 		}
 	}
+	if contactType := r.URL.Query().Get("contact_type"); contactType != "" {
+		req.ContactType = strings.TrimSpace(contactType)
+	}
+
+	// Phase
+	req.Phase = queryList(r.URL.Query(), "phase")
 
 	// Location (latitude/longitude)
+	var latSet, lonSet bool
 	if latStr := r.URL.Query().Get("latitude"); latStr != "" {
 		if lat, err := strconv.ParseFloat(latStr, 64); err == nil {
-			req.Latitude = lat
+			req.Latitude, latSet = lat, true
 		}
 	}
 	if lonStr := r.URL.Query().Get("longitude"); lonStr != "" {
 		if lon, err := strconv.ParseFloat(lonStr, 64); err == nil {
-			req.Longitude = lon
+			req.Longitude, lonSet = lon, true
 		}
 	}
+	req.CoordinatesSet = latSet && lonSet
 	if distStr := r.URL.Query().Get("distance"); distStr != "" {
 		if dist, err := strconv.Atoi(distStr); err == nil {
 			req.Distance = dist
 		}
 	}
+	req.Units = strings.ToLower(strings.TrimSpace(r.URL.Query().Get("units")))
+
+	if nearest := r.URL.Query().Get("nearest_only"); nearest != "" {
+		if nearestOnly, err := strconv.ParseBool(nearest); err == nil {
+			req.NearestOnly = nearestOnly
+		}
+	}
 
 	// Age filters
+	if ageStr := r.URL.Query().Get("age"); ageStr != "" {
+		if age, err := strconv.Atoi(ageStr); err == nil {
+			req.Age = age
+		}
+	}
 	if minAge := r.URL.Query().Get("minimum_age"); minAge != "" {
 		req.MinimumAge = minAge
 	}
@@ -254,6 +756,60 @@ func (h *TrialsHandler) parseSearchRequest(r *http.Request) models.SearchRequest
 		req.MaximumAge = maxAge
 	}
 
+	// Incremental polling
+	if updatedSince := r.URL.Query().Get("updated_since"); updatedSince != "" {
+		req.UpdatedSince = strings.TrimSpace(updatedSince)
+	}
+
+	// Start and completion date ranges
+	req.StartDateFrom = strings.TrimSpace(r.URL.Query().Get("start_date_from"))
+	req.StartDateTo = strings.TrimSpace(r.URL.Query().Get("start_date_to"))
+	req.CompletionDateFrom = strings.TrimSpace(r.URL.Query().Get("completion_date_from"))
+	req.CompletionDateTo = strings.TrimSpace(r.URL.Query().Get("completion_date_to"))
+
+	// Country filter
+	if country := r.URL.Query().Get("country"); country != "" {
+		req.Country = strings.TrimSpace(country)
+	}
+	if prune := r.URL.Query().Get("prune_locations"); prune != "" {
+		if pruneLocations, err := strconv.ParseBool(prune); err == nil {
+			req.PruneLocations = pruneLocations
+		}
+	}
+
+	// Detailed text (detailed summary and eligibility criteria) is omitted from search results by default
+	if includeDetailed := r.URL.Query().Get("include_detailed"); includeDetailed != "" {
+		if include, err := strconv.ParseBool(includeDetailed); err == nil {
+			req.IncludeDetailed = include
+		}
+	}
+	if includeText := r.URL.Query().Get("include_text"); includeText != "" {
+		if include, err := strconv.ParseBool(includeText); err == nil {
+			req.OmitText = !include
+		}
+	}
+
+	// Highlighting
+	if highlight := r.URL.Query().Get("highlight"); highlight != "" {
+		if enabled, err := strconv.ParseBool(highlight); err == nil {
+			req.Highlight = enabled
+		}
+	}
+	req.HighlightPre = r.URL.Query().Get("highlight_pre")
+	req.HighlightPost = r.URL.Query().Get("highlight_post")
+
+	// Status labels
+	if humanize := r.URL.Query().Get("humanize_status"); humanize != "" {
+		if enabled, err := strconv.ParseBool(humanize); err == nil {
+			req.HumanizeStatus = enabled
+		}
+	}
+
+	// Sorting
+	if sortBy := r.URL.Query().Get("sort"); sortBy != "" {
+		req.Sort = strings.TrimSpace(sortBy)
+	}
+
 	// Pagination
 	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
 		if pageSize, err := strconv.Atoi(pageSizeStr); err == nil && pageSize > 0 {
@@ -267,51 +823,491 @@ func (h *TrialsHandler) parseSearchRequest(r *http.Request) models.SearchRequest
 	return req
 }
 
+// seedTrialCache populates per-trial cache entries from search results so a following
+// get-by-id is a cache hit. Existing entries are never overwritten, since a detail fetch is
+// at least as complete, and results whose locations were reduced by the request are skipped.
+func (h *TrialsHandler) seedTrialCache(req models.SearchRequest, response *models.SearchResponse) {
+	if req.PruneLocations || req.NearestOnly {
+		return
+	}
+	for i := range response.Trials {
+		trial := response.Trials[i]
+		if trial.NCTID == "" {
+			continue
+		}
+		trial.Score = 0 // Relevance is specific to the search, not the trial
+		h.cache.Add(trialCacheKey(trial.Registry, trial.NCTID), &trial)
+	}
+}
+
+// validateSearchRequest rejects search parameters with unsupported values or too many entries
+func (h *TrialsHandler) validateSearchRequest(req models.SearchRequest) error {
+	for _, list := range []struct {
+		name  string
+		count int
+		max   int
+	}{
+		{"conditions", len(req.Conditions), h.maxConditions},
+		{"phase", len(req.Phase), h.maxPhases},
+		{"status", len(req.Status), h.maxStatuses},
+		{"nct_ids", len(req.NCTIDs), MaxNCTIDs},
+	} {
+		if list.count > list.max {
+			return fmt.Errorf("too many %s values: %d given, at most %d allowed", list.name, list.count, list.max)
+		}
+	}
+	for _, status := range req.Status {
+		if !api.IsKnownStatus(status) {
+			return fmt.Errorf("invalid status %q: must be an overall status such as %s or COMPLETED", status, strings.Join(api.RecruitingStatuses, ", "))
+		}
+	}
+	if length := conditionQueryLength(req); length > h.maxQueryLength {
+		return fmt.Errorf("condition query is %d characters once URL-encoded, over the limit of %d; search fewer conditions or send an advanced_query in a POST search", length, h.maxQueryLength)
+	}
+	if req.PageSize > h.maxPageSize {
+		return fmt.Errorf("page_size %d exceeds the maximum of %d trials per response; request smaller pages and follow next_page_token to get more", req.PageSize, h.maxPageSize)
+	}
+	switch strings.ToLower(req.Sort) {
+	case "", api.SortRelevance:
+	case api.SortDistance:
+		if !req.HasCoordinates() {
+			return fmt.Errorf("sort %q requires latitude and longitude", api.SortDistance)
+		}
+	default:
+		return fmt.Errorf("invalid sort %q: must be %q or %q", req.Sort, api.SortRelevance, api.SortDistance)
+	}
+	if req.Age < 0 {
+		return fmt.Errorf("invalid age %d: must not be negative", req.Age)
+	}
+	switch strings.ToLower(req.Units) {
+	case "", api.UnitsMiles, api.UnitsKilometers:
+	default:
+		return fmt.Errorf("invalid units %q: must be %q or %q", req.Units, api.UnitsMiles, api.UnitsKilometers)
+	}
+	if req.UpdatedSince != "" {
+		if _, err := time.Parse(time.DateOnly, req.UpdatedSince); err != nil {
+			return fmt.Errorf("invalid updated_since %q: must be a YYYY-MM-DD date", req.UpdatedSince)
+		}
+	}
+	if err := validateDateRange("start_date", req.StartDateFrom, req.StartDateTo); err != nil {
+		return err
+	}
+	if err := validateDateRange("completion_date", req.CompletionDateFrom, req.CompletionDateTo); err != nil {
+		return err
+	}
+	switch strings.ToLower(req.ConditionLogic) {
+	case "", api.ConditionLogicOr, api.ConditionLogicAnd:
+	default:
+		return fmt.Errorf("invalid condition_logic %q: must be %q or %q", req.ConditionLogic, api.ConditionLogicOr, api.ConditionLogicAnd)
+	}
+	switch strings.ToLower(req.Match) {
+	case "", api.MatchPartial:
+	case api.MatchExact:
+		if req.AdvancedQuery != "" {
+			return fmt.Errorf("match=%s cannot be combined with advanced_query", api.MatchExact)
+		}
+	default:
+		return fmt.Errorf("invalid match %q: must be %q or %q", req.Match, api.MatchPartial, api.MatchExact)
+	}
+	switch strings.ToLower(req.ContactType) {
+	case "", api.ContactTypeAny, api.ContactTypeEmail, api.ContactTypePhone:
+	default:
+		return fmt.Errorf("invalid contact_type %q: must be %q, %q or %q", req.ContactType, api.ContactTypeEmail, api.ContactTypePhone, api.ContactTypeAny)
+	}
+	for _, funderType := range req.FunderType {
+		if !api.IsFunderType(funderType) {
+			return fmt.Errorf("invalid funder_type %q: must be one of %s", funderType, strings.Join(api.FunderTypes, ", "))
+		}
+	}
+	for _, id := range req.NCTIDs {
+		if !nctIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid nct_ids value %q: must look like NCT01234567", id)
+		}
+	}
+	if req.Registry != "" && req.Registry != api.RegistryClinicalTrialsGov {
+		if req.AdvancedQuery != "" {
+			return fmt.Errorf("advanced_query is only available for registry %s", api.RegistryClinicalTrialsGov)
+		}
+		if len(req.NCTIDs) > 0 {
+			return fmt.Errorf("nct_ids is only available for registry %s", api.RegistryClinicalTrialsGov)
+		}
+		if req.HasResults {
+			return fmt.Errorf("has_results is only available for registry %s", api.RegistryClinicalTrialsGov)
+		}
+		if len(req.FunderType) > 0 {
+			return fmt.Errorf("funder_type is only available for registry %s", api.RegistryClinicalTrialsGov)
+		}
+	}
+	return nil
+}
+
+// validateDateRange checks the name_from and name_to bounds of a date range: each must be a
+// YYYY-MM-DD or YYYY-MM date, and from must not come after to
+func validateDateRange(name, from, to string) error {
+	fromDate, err := dateParam(name+"_from", from)
+	if err != nil {
+		return err
+	}
+	toDate, err := dateParam(name+"_to", to)
+	if err != nil {
+		return err
+	}
+	if fromDate != "" && toDate != "" && fromDate > toDate {
+		return fmt.Errorf("%s_from %s is after %s_to %s", name, from, name, to)
+	}
+	return nil
+}
+
+// dateParam normalizes an optional date parameter to YYYY-MM-DD
+func dateParam(param, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	date, ok := api.NormalizeDate(value)
+	if !ok {
+		return "", fmt.Errorf("invalid %s %q: must be a YYYY-MM-DD or YYYY-MM date", param, value)
+	}
+	return date, nil
+}
+
+// applySort orders search results as requested by the client
+func applySort(req models.SearchRequest, response *models.SearchResponse) {
+	if strings.EqualFold(req.Sort, api.SortDistance) {
+		api.SortByDistance(response.Trials, req.Latitude, req.Longitude)
+		return
+	}
+	if strings.EqualFold(req.Sort, api.SortRelevance) {
+		query := req.Query
+		if query == "" {
+			query = strings.Join(req.Conditions, " ")
+		}
+		api.SortByRelevance(response.Trials, query)
+	}
+}
+
+// presentSearchResponse applies per-request presentation options such as highlighting,
+// drops detailed text unless include_detailed is set (and all free text with omit_text),
+// echoes the applied filters and signs the next page token.
+// Responses larger than responseLimit are truncated, starting at offset within the
+// (already filtered and sorted) upstream page, with a next page token resuming after them.
+// It works on a copy so cached responses are never modified.
+func (h *TrialsHandler) presentSearchResponse(req models.SearchRequest, offset int, response *models.SearchResponse) *models.SearchResponse {
+	presented := *response
+
+	trials := response.Trials[min(offset, len(response.Trials)):]
+	next := pageCursor{Token: response.NextPageToken}
+	if limit := h.responseLimit(req); limit > 0 && len(trials) > limit {
+		trials = trials[:limit]
+		next = pageCursor{Token: req.PageToken, Offset: offset + limit}
+	}
+	presented.NextPageToken = ""
+	if next != (pageCursor{}) {
+		presented.NextPageToken = h.pageTokens.seal(next, h.pageTokenScope(req))
+	}
+
+	presented.Trials = make([]models.Trial, len(trials))
+	copy(presented.Trials, trials)
+	presented.PageSize = len(presented.Trials)
+	presented.MostRecentUpdate = mostRecentUpdate(presented.Trials)
+	presented.AppliedFilters = api.AppliedFilters(req)
+
+	// List views rarely need the long-form text; get-by-id always returns it
+	if !req.IncludeDetailed || req.OmitText {
+		for i := range presented.Trials {
+			presented.Trials[i].DetailedSummary = ""
+			presented.Trials[i].Eligibility.Criteria = ""
+			presented.Trials[i].Eligibility.Inclusion = nil
+			presented.Trials[i].Eligibility.Exclusion = nil
+		}
+	}
+	if req.OmitText {
+		for i := range presented.Trials {
+			presented.Trials[i].BriefSummary = ""
+		}
+	}
+	if req.HumanizeStatus {
+		for i := range presented.Trials {
+			presented.Trials[i].StatusLabel = api.StatusLabel(presented.Trials[i].Status)
+		}
+	}
+	if strings.EqualFold(req.Units, api.UnitsKilometers) {
+		for i := range presented.Trials {
+			presented.Trials[i].Locations = kilometerLocations(presented.Trials[i].Locations)
+		}
+	}
+	if !req.Highlight {
+		return &presented
+	}
+
+	query := req.Query
+	if query == "" {
+		query = strings.Join(req.Conditions, " ")
+	}
+	pre, post := req.HighlightPre, req.HighlightPost
+	if pre == "" && post == "" {
+		pre, post = api.DefaultHighlightPre, api.DefaultHighlightPost
+	}
+	for i := range presented.Trials {
+		presented.Trials[i].Title = api.HighlightTerms(presented.Trials[i].Title, query, pre, post)
+		presented.Trials[i].BriefSummary = api.HighlightTerms(presented.Trials[i].BriefSummary, query, pre, post)
+	}
+	return &presented
+}
+
+// kilometerLocations returns a copy of locations with computed distances in kilometers.
+// Cached trials keep theirs in miles, so the slice is copied rather than updated.
+func kilometerLocations(locations []models.Location) []models.Location {
+	converted := make([]models.Location, len(locations))
+	copy(converted, locations)
+	for i := range converted {
+		converted[i].Distance = api.ConvertMiles(converted[i].Distance, api.UnitsKilometers)
+	}
+	return converted
+}
+
+// responseLimit returns the most trials a response to req may hold, or 0 for no limit.
+// A filled page can span several upstream pages, so it is cut at page_size and the
+// remainder is served from the same (cached) filled page via the next page token.
+func (h *TrialsHandler) responseLimit(req models.SearchRequest) int {
+	limit := h.maxResponseTrials
+	if req.FillPage && req.PageSize > 0 && (limit == 0 || req.PageSize < limit) {
+		limit = req.PageSize
+	}
+	return limit
+}
+
+// mostRecentUpdate returns the latest LastUpdateDate among trials, or "" if none is known.
+// Dates are ISO 8601, so they compare correctly as strings.
+func mostRecentUpdate(trials []models.Trial) string {
+	latest := ""
+	for _, trial := range trials {
+		if trial.LastUpdateDate > latest {
+			latest = trial.LastUpdateDate
+		}
+	}
+	return latest
+}
+
+// registryFor returns the registry selected by name, defaulting to ClinicalTrials.gov.
+// "all" fans out to every configured registry, ClinicalTrials.gov first.
+func (h *TrialsHandler) registryFor(name string) (api.Registry, bool) {
+	name = strings.ToLower(name)
+	if name == "" {
+		name = api.RegistryClinicalTrialsGov
+	}
+	if name == api.RegistryAll {
+		names := make([]string, 0, len(h.registries))
+		for registryName := range h.registries {
+			if registryName != api.RegistryClinicalTrialsGov {
+				names = append(names, registryName)
+			}
+		}
+		sort.Strings(names)
+
+		registries := make([]api.Registry, 0, len(h.registries))
+		if ctgov, ok := h.registries[api.RegistryClinicalTrialsGov]; ok {
+			registries = append(registries, ctgov)
+		}
+		for _, registryName := range names {
+			registries = append(registries, h.registries[registryName])
+		}
+		return api.NewMultiRegistry(registries...), len(registries) > 0
+	}
+	registry, ok := h.registries[name]
+	return registry, ok
+}
+
+// trialCacheKey returns the per-trial cache key, keeping the original key format for ClinicalTrials.gov
+func trialCacheKey(registry, id string) string {
+	if registry == api.RegistryClinicalTrialsGov {
+		return "trial:" + id
+	}
+	return "trial:" + registry + ":" + id
+}
+
+// conditionQueryLength returns the URL-encoded length of the condition query a search sends
+// upstream: the joined conditions, or the free-text query when no conditions are given
+func conditionQueryLength(req models.SearchRequest) int {
+	query := req.Query
+	if len(req.Conditions) > 0 {
+		query = api.JoinConditions(req.Conditions, req.ConditionLogic)
+	}
+	return len(url.QueryEscape(query))
+}
+
+// lowerAll returns a lowercased copy of values
+func lowerAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
+}
+
 // generateCacheKey generates a cache key from search request
 func (h *TrialsHandler) generateCacheKey(prefix string, req models.SearchRequest) string {
 	params := map[string]interface{}{
 		"query":      req.Query,
-		"conditions": req.Conditions,
+		"conditions": lowerAll(req.Conditions), // The upstream condition search ignores case
 		"status":     req.Status,
 		"phase":      req.Phase,
 		"page_token": req.PageToken,
 		"page_size":  req.PageSize,
 	}
-	if req.Latitude != 0 {
-		params["lat"] = req.Latitude
+	if req.Registry != "" && req.Registry != api.RegistryClinicalTrialsGov {
+		params["registry"] = req.Registry
 	}
-	if req.Longitude != 0 {
+	if req.HasCoordinates() {
+		params["lat"] = req.Latitude
 		params["lon"] = req.Longitude
 	}
 	if req.Distance != 0 {
 		params["distance"] = req.Distance
 	}
+	if strings.EqualFold(req.Units, api.UnitsKilometers) {
+		params["units"] = api.UnitsKilometers // Changes the radius distance is read in
+	}
+	if req.Age != 0 {
+		params["age"] = strconv.Itoa(req.Age)
+	}
+	if req.MinimumAge != "" {
+		params["minimum_age"] = req.MinimumAge
+	}
+	if req.MaximumAge != "" {
+		params["maximum_age"] = req.MaximumAge
+	}
+	if req.UpdatedSince != "" {
+		params["updated_since"] = req.UpdatedSince
+	}
+	if req.AdvancedQuery != "" {
+		params["advanced_query"] = req.AdvancedQuery
+	}
+	for name, value := range map[string]string{
+		"start_date_from":      req.StartDateFrom,
+		"start_date_to":        req.StartDateTo,
+		"completion_date_from": req.CompletionDateFrom,
+		"completion_date_to":   req.CompletionDateTo,
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	if len(req.NCTIDs) > 0 {
+		params["nct_ids"] = req.NCTIDs
+	}
+	if req.NearestOnly {
+		params["nearest_only"] = "true"
+	}
+	if req.IncludeInactive {
+		params["include_inactive"] = "true"
+	}
+	if req.FillPage {
+		params["fill_page"] = "true"
+	}
+	if req.SkipTotal {
+		params["count_total"] = "false" // Same trials, but the page carries no upstream total
+	}
+	if req.HasResults {
+		params["has_results"] = "true"
+	}
+	if len(req.FunderType) > 0 {
+		params["funder_type"] = req.FunderType
+	}
+	if req.HasContact {
+		params["has_contact"] = "true"
+		if ct := strings.ToLower(req.ContactType); ct != "" && ct != api.ContactTypeAny {
+			params["contact_type"] = ct
+		}
+	}
+	if strings.EqualFold(req.ConditionLogic, api.ConditionLogicAnd) {
+		params["condition_logic"] = api.ConditionLogicAnd
+	}
+	if strings.EqualFold(req.Match, api.MatchExact) {
+		params["match"] = api.MatchExact
+	}
+	if req.Sort != "" {
+		params["sort"] = strings.ToLower(req.Sort)
+	}
+	if req.Country != "" {
+		params["country"] = req.Country
+		params["prune_locations"] = strconv.FormatBool(req.PruneLocations)
+	}
 	return cache.GenerateCacheKey(prefix, params)
 }
 
-// writeJSON writes a JSON response
-func (h *TrialsHandler) writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+// writeJSON writes a JSON response, indented when the request asks for ?pretty=true
+// The body is buffered so an ETag and Content-Length can be sent, and HEAD requests
+// get the same headers as GET without a body.
+func (h *TrialsHandler) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	h.writeEncoded(w, r, statusCode, "application/json", data)
+}
+
+// writeEncoded writes data as JSON with the given content type; see writeJSON
+func (h *TrialsHandler) writeEncoded(w http.ResponseWriter, r *http.Request, statusCode int, contentType string, data interface{}) {
+	// GeoJSON stays a bare FeatureCollection so mapping tools can consume it
+	if contentType == "application/json" && h.wantsEnvelope(r) {
+		data = models.Envelope{Data: data, Meta: envelopeMeta(r)}
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	if wantsPretty(r) {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(data); err != nil {
+		logger := getLogger(r.Context())
+		logger.Error().Err(err).Msg("Error encoding JSON response")
+		h.writeError(w, r, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	writeBody(w, r, statusCode, contentType, body.Bytes())
+}
+
+// writeBody writes an encoded response body with its Content-Length and an ETag, leaving
+// the body out for HEAD requests
+func writeBody(w http.ResponseWriter, r *http.Request, statusCode int, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", defaultCacheControl)
+	}
 	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Error().Err(err).Msg("Error encoding JSON response")
+	if r.Method == http.MethodHead {
+		return
 	}
+	w.Write(body)
+}
+
+// wantsPretty reports whether the client requested indented JSON output
+func wantsPretty(r *http.Request) bool {
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
 }
 
 // getLogger extracts logger from context with request ID
 func getLogger(ctx context.Context) zerolog.Logger {
-	requestID := ctx.Value(middleware.RequestIDKey{})
-	if requestID != nil {
-		if id, ok := requestID.(string); ok {
-			return log.With().Str("request_id", id).Logger()
-		}
+	logger := logging.Logger(logging.ComponentHandlers)
+	if requestID := middleware.RequestIDFromContext(ctx); requestID != "" {
+		return logger.With().Str("request_id", requestID).Logger()
 	}
-	return log.Logger
+	return logger
 }
 
 // writeError writes an error response
-func (h *TrialsHandler) writeError(w http.ResponseWriter, statusCode int, message string) {
+func (h *TrialsHandler) writeError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
+	if h.wantsEnvelope(r) {
+		json.NewEncoder(w).Encode(models.Envelope{
+			Meta:   envelopeMeta(r),
+			Errors: []models.EnvelopeError{{Status: statusCode, Message: message}},
+		})
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
@@ -0,0 +1,2698 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/api"
+	"github.com/clinical-trials-microservice/internal/cache"
+	"github.com/clinical-trials-microservice/internal/middleware"
+	"github.com/clinical-trials-microservice/internal/models"
+	"github.com/clinical-trials-microservice/internal/watch"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestHandler creates a handler without an upstream client for handler-only tests
+func newTestHandler() *TrialsHandler {
+	return NewTrialsHandler(nil, cache.NewCache(time.Hour), true)
+}
+
+func getHealth(t *testing.T, h *TrialsHandler) models.HealthResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Health(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var health models.HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	return health
+}
+
+func TestHealth(t *testing.T) {
+	h := newTestHandler()
+
+	first := getHealth(t, h)
+	if first.Status != "healthy" {
+		t.Errorf("Expected status healthy, got %q", first.Status)
+	}
+	if first.Version == "" || first.Commit == "" || first.StartedAt == "" || first.Uptime == "" {
+		t.Errorf("Expected version, commit, started_at and uptime to be set, got %+v", first)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	second := getHealth(t, h)
+	if second.UptimeSeconds <= first.UptimeSeconds {
+		t.Errorf("Expected uptime to increase, got %f then %f", first.UptimeSeconds, second.UptimeSeconds)
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	apiClient := api.NewClinicalTrialsClient()
+
+	t.Run("echoes upstream URL in debug mode", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true, WithDebug(true))
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?explain=true&conditions=tetraplegia&status=RECRUITING&page_size=10", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		var explain models.ExplainResponse
+		if err := json.NewDecoder(rec.Body).Decode(&explain); err != nil {
+			t.Fatalf("Failed to decode explain response: %v", err)
+		}
+
+		expected := api.ClinicalTrialsGovBaseURL + "?countTotal=true&filter.overallStatus=RECRUITING&format=json&pageSize=10&query.cond=tetraplegia"
+		if explain.UpstreamURL != expected {
+			t.Errorf("Expected upstream URL %s, got %s", expected, explain.UpstreamURL)
+		}
+		if len(explain.Request.Conditions) != 1 || explain.Request.Conditions[0] != "tetraplegia" {
+			t.Errorf("Expected parsed conditions to be echoed, got %v", explain.Request.Conditions)
+		}
+	})
+
+	t.Run("forbidden without debug mode", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?explain=true", nil))
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", rec.Code)
+		}
+	})
+}
+
+// newMockUpstream starts a fake ClinicalTrials.gov API serving the given handler
+func newMockUpstream(t *testing.T, handler http.HandlerFunc) *api.ClinicalTrialsClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return api.NewClinicalTrialsClient(api.WithBaseURL(server.URL), api.WithRateLimitDelay(0))
+}
+
+// emptyStudies is a mock upstream handler returning no studies
+func emptyStudies(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`{"studies":[],"totalCount":0}`))
+}
+
+// captureLogs redirects the global logger to a buffer at the given level for the duration of the test
+func captureLogs(t *testing.T, level zerolog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf).Level(level)
+	t.Cleanup(func() { log.Logger = original })
+	return &buf
+}
+
+// findLogEntry returns the first JSON log entry with the given message
+func findLogEntry(t *testing.T, buf *bytes.Buffer, message string) map[string]interface{} {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		if entry["message"] == message {
+			return entry
+		}
+	}
+	return nil
+}
+
+func TestSearchTrialsPostDebugLogging(t *testing.T) {
+	body := `{"conditions":["tetraplegia"],"status":["RECRUITING"],"country":"Brazil","latitude":-23.55,"longitude":-46.63,"page_size":5,"page_token":"abc"}`
+
+	t.Run("logs decoded request at debug level", func(t *testing.T) {
+		buf := captureLogs(t, zerolog.DebugLevel)
+		h := NewTrialsHandler(newMockUpstream(t, emptyStudies), cache.NewCache(time.Hour), false)
+
+		// Page tokens must be signed for the query they are sent with
+		var decoded models.SearchRequest
+		if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+			t.Fatalf("Failed to decode test body: %v", err)
+		}
+		token := h.pageTokens.seal(pageCursor{Token: decoded.PageToken}, h.pageTokenScope(decoded))
+		signedBody := strings.Replace(body, `"page_token":"abc"`, `"page_token":"`+token+`"`, 1)
+
+		rec := httptest.NewRecorder()
+		h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(signedBody)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		entry := findLogEntry(t, buf, "POST search request body")
+		if entry == nil {
+			t.Fatalf("Expected debug log of decoded request, got %s", buf.String())
+		}
+		if conditions, _ := entry["conditions"].([]interface{}); len(conditions) != 1 || conditions[0] != "tetraplegia" {
+			t.Errorf("Expected conditions field, got %v", entry["conditions"])
+		}
+		if entry["country"] != "Brazil" || entry["geo_search"] != true || entry["has_page_token"] != true || entry["page_size"] != float64(5) {
+			t.Errorf("Expected structured request fields, got %v", entry)
+		}
+		for _, field := range []string{"latitude", "longitude", "page_token"} {
+			if _, ok := entry[field]; ok {
+				t.Errorf("Expected %s to be omitted from debug log", field)
+			}
+		}
+	})
+
+	t.Run("silent above debug level", func(t *testing.T) {
+		buf := captureLogs(t, zerolog.InfoLevel)
+		h := NewTrialsHandler(newMockUpstream(t, emptyStudies), cache.NewCache(time.Hour), false)
+
+		h.SearchTrialsPost(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(body)))
+		if entry := findLogEntry(t, buf, "POST search request body"); entry != nil {
+			t.Errorf("Expected no request body log at info level, got %v", entry)
+		}
+	})
+}
+
+// fakeRegistry is an in-memory api.Registry for handler tests
+type fakeRegistry struct {
+	name   string
+	trials []models.Trial
+}
+
+func (f *fakeRegistry) Name() string { return f.name }
+
+func (f *fakeRegistry) Search(ctx context.Context, req models.SearchRequest) (*models.SearchResponse, error) {
+	return &models.SearchResponse{Trials: f.trials, TotalCount: len(f.trials), PageSize: len(f.trials)}, nil
+}
+
+func (f *fakeRegistry) GetByID(ctx context.Context, id string) (*models.Trial, error) {
+	for i := range f.trials {
+		if f.trials[i].NCTID == id {
+			return &f.trials[i], nil
+		}
+	}
+	return nil, errors.New("trial not found: " + id)
+}
+
+func TestRegistrySelection(t *testing.T) {
+	ictrp := &fakeRegistry{name: api.RegistryICTRP, trials: []models.Trial{{NCTID: "RBR-7abc12", Registry: api.RegistryICTRP}}}
+	h := NewTrialsHandler(newMockUpstream(t, emptyStudies), cache.NewCache(time.Hour), true, WithRegistry(ictrp))
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantTrials int
+	}{
+		{"defaults to clinicaltrials.gov", "/api/v1/trials/search", http.StatusOK, 0},
+		{"selects ictrp", "/api/v1/trials/search?registry=ictrp", http.StatusOK, 1},
+		{"rejects unknown registry", "/api/v1/trials/search?registry=unknown", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp models.SearchResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(resp.Trials) != tt.wantTrials {
+				t.Errorf("Expected %d trials, got %d", tt.wantTrials, len(resp.Trials))
+			}
+		})
+	}
+
+	t.Run("get by id from ictrp", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/v1/trials/RBR-7abc12?registry=ictrp", nil), map[string]string{"nct_id": "RBR-7abc12"})
+		h.GetTrialByID(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		if _, found := h.cache.Get("trial:ictrp:RBR-7abc12"); !found {
+			t.Error("Expected ICTRP trial to be cached under a registry-scoped key")
+		}
+	})
+}
+
+func TestWriteJSONPretty(t *testing.T) {
+	h := newTestHandler()
+	data := map[string]interface{}{"status": "healthy", "nested": map[string]int{"count": 1}}
+
+	compact := httptest.NewRecorder()
+	h.writeJSON(compact, httptest.NewRequest(http.MethodGet, "/health", nil), http.StatusOK, data)
+
+	pretty := httptest.NewRecorder()
+	h.writeJSON(pretty, httptest.NewRequest(http.MethodGet, "/health?pretty=true", nil), http.StatusOK, data)
+
+	expectedCompact := `{"nested":{"count":1},"status":"healthy"}` + "\n"
+	if compact.Body.String() != expectedCompact {
+		t.Errorf("Expected compact output %q, got %q", expectedCompact, compact.Body.String())
+	}
+
+	expectedPretty := "{\n  \"nested\": {\n    \"count\": 1\n  },\n  \"status\": \"healthy\"\n}\n"
+	if pretty.Body.String() != expectedPretty {
+		t.Errorf("Expected pretty output %q, got %q", expectedPretty, pretty.Body.String())
+	}
+
+	// Both forms must decode to the same data
+	var a, b map[string]interface{}
+	json.Unmarshal(compact.Body.Bytes(), &a)
+	json.Unmarshal(pretty.Body.Bytes(), &b)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("Compact and pretty output differ: %v vs %v", a, b)
+	}
+}
+
+func TestSearchSeedsTrialCache(t *testing.T) {
+	var detailCalls int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/NCT00000001") || strings.HasSuffix(r.URL.Path, "/NCT00000002") {
+			atomic.AddInt32(&detailCalls, 1)
+		}
+		w.Write([]byte(`{"studies":[
+			{"protocolSection":{"identificationModule":{"nctId":"NCT00000001","briefTitle":"From search"}}},
+			{"protocolSection":{"identificationModule":{"nctId":"NCT00000002","briefTitle":"From search"}}}
+		],"totalCount":2}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	// A richer detail entry already cached must not be overwritten by search results
+	h.cache.Set("trial:NCT00000002", &models.Trial{NCTID: "NCT00000002", Title: "From detail", DetailedSummary: "Full detail"})
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected search status 200, got %d", rec.Code)
+	}
+
+	for _, tt := range []struct {
+		id    string
+		title string
+	}{
+		{"NCT00000001", "From search"},
+		{"NCT00000002", "From detail"},
+	} {
+		rec := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/v1/trials/"+tt.id, nil), map[string]string{"nct_id": tt.id})
+		h.GetTrialByID(rec, req)
+
+		var trial models.Trial
+		if err := json.NewDecoder(rec.Body).Decode(&trial); err != nil {
+			t.Fatalf("Failed to decode trial: %v", err)
+		}
+		if trial.Title != tt.title {
+			t.Errorf("Expected %s title %q, got %q", tt.id, tt.title, trial.Title)
+		}
+	}
+
+	if got := atomic.LoadInt32(&detailCalls); got != 0 {
+		t.Errorf("Expected get-by-id to be served from cache, got %d upstream detail calls", got)
+	}
+}
+
+func TestSearchSkipsSeedingReducedLocations(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}}}],"totalCount":1}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	h.SearchTrials(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?latitude=1&longitude=1&nearest_only=true", nil))
+	if _, found := h.cache.Get("trial:NCT00000001"); found {
+		t.Error("Expected trials with reduced locations not to seed the per-trial cache")
+	}
+}
+
+func TestSearchRejectsInvalidSort(t *testing.T) {
+	h := NewTrialsHandler(newMockUpstream(t, emptyStudies), cache.NewCache(time.Hour), true)
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?sort=random", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown sort, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?sort=relevance&query=tetraplegia", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for relevance sort, got %d", rec.Code)
+	}
+}
+
+func TestSearchHighlightDoesNotModifyCache(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[{"protocolSection":{
+			"identificationModule":{"nctId":"NCT00000001","briefTitle":"Spinal cord stimulation"},
+			"descriptionModule":{"briefSummary":"Stimulation of the spinal cord."}}}],"totalCount":1}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	search := func(url string) models.SearchResponse {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var resp models.SearchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	highlighted := search("/api/v1/trials/search?query=spinal+cord&highlight=true")
+	if got := highlighted.Trials[0].Title; got != "<em>Spinal</em> <em>cord</em> stimulation" {
+		t.Errorf("Unexpected highlighted title %q", got)
+	}
+	if got := highlighted.Trials[0].BriefSummary; got != "Stimulation of the <em>spinal</em> <em>cord</em>." {
+		t.Errorf("Unexpected highlighted summary %q", got)
+	}
+
+	custom := search("/api/v1/trials/search?query=spinal+cord&highlight=true&highlight_pre=[&highlight_post=]")
+	if got := custom.Trials[0].Title; got != "[Spinal] [cord] stimulation" {
+		t.Errorf("Unexpected custom-delimited title %q", got)
+	}
+
+	plain := search("/api/v1/trials/search?query=spinal+cord")
+	if got := plain.Trials[0].Title; got != "Spinal cord stimulation" {
+		t.Errorf("Expected cached results to stay unhighlighted, got %q", got)
+	}
+}
+
+func TestSearchAppliesConfiguredDefaultPageSize(t *testing.T) {
+	var upstreamPageSize atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPageSize.Store(r.URL.Query().Get("pageSize"))
+		emptyStudies(w, r)
+	}))
+	t.Cleanup(server.Close)
+	apiClient := api.NewClinicalTrialsClient(api.WithBaseURL(server.URL), api.WithRateLimitDelay(0), api.WithDefaultPageSize(25))
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+
+	if got := h.parseSearchRequest(httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil)).PageSize; got != 25 {
+		t.Errorf("Expected handler default page size 25, got %d", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if got := upstreamPageSize.Load(); got != "25" {
+		t.Errorf("Expected upstream pageSize 25, got %v", got)
+	}
+}
+
+func TestPageTokenSigning(t *testing.T) {
+	var upstreamToken atomic.Value
+	upstreamToken.Store("")
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamToken.Store(r.URL.Query().Get("pageToken"))
+		w.Write([]byte(`{"studies":[],"totalCount":0,"nextPageToken":"upstream-token-2"}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+
+	search := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	rec := search("conditions=paraplegia")
+	var first models.SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&first); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if first.NextPageToken == "" || first.NextPageToken == "upstream-token-2" {
+		t.Fatalf("Expected an opaque signed page token, got %q", first.NextPageToken)
+	}
+
+	rec = search("conditions=paraplegia&page_size=10&page_token=" + first.NextPageToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a valid page token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := upstreamToken.Load(); got != "upstream-token-2" {
+		t.Errorf("Expected the unwrapped token upstream, got %q", got)
+	}
+
+	payload, signature, _ := strings.Cut(first.NextPageToken, ".")
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"raw upstream token", "conditions=paraplegia&page_token=upstream-token-2"},
+		{"tampered payload", "conditions=paraplegia&page_token=" + payload + "x." + signature},
+		{"truncated signature", "conditions=paraplegia&page_token=" + payload + "." + signature[:4]},
+		{"different query", "conditions=tetraplegia&page_token=" + first.NextPageToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamToken.Store("")
+			rec := search(tt.query)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", rec.Code)
+			}
+			if got := upstreamToken.Load(); got != "" {
+				t.Errorf("Expected rejected token not to reach upstream, got %q", got)
+			}
+		})
+	}
+
+	// A token issued for one location is not valid for a nearby one
+	rec = search("latitude=34.05&longitude=-118.25")
+	var located models.SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&located); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec = search("latitude=34.05&longitude=-118.25&page_token=" + located.NextPageToken); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for the same location, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec = search("latitude=34.9&longitude=-118.25&page_token=" + located.NextPageToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a token from another location, got %d", rec.Code)
+	}
+}
+
+func TestUpstreamInvalidPageTokenIsBadRequest(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"Invalid pageToken"}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+	token := h.pageTokens.seal(pageCursor{Token: "expired"}, h.pageTokenScope(models.SearchRequest{}))
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?page_token="+token, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an upstream-rejected page token, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "page_token") {
+		t.Errorf("Expected a page_token error message, got %s", rec.Body.String())
+	}
+}
+
+func TestSearchOmitsDetailedTextByDefault(t *testing.T) {
+	study := `{"protocolSection":{
+		"identificationModule":{"nctId":"NCT00000001","briefTitle":"Detailed"},
+		"descriptionModule":{"briefSummary":"Short","detailedDescription":"Very long description"},
+		"eligibilityModule":{"eligibilityCriteria":"Inclusion: adults"}
+	}}`
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/NCT00000001") {
+			w.Write([]byte(study))
+			return
+		}
+		w.Write([]byte(`{"studies":[` + study + `],"totalCount":1}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+
+	search := func(query string) models.Trial {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search"+query, nil))
+		var resp models.SearchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Trials) != 1 {
+			t.Fatalf("Expected one trial, got %s", rec.Body.String())
+		}
+		return resp.Trials[0]
+	}
+
+	if trial := search(""); trial.DetailedSummary != "" || trial.Eligibility.Criteria != "" || trial.BriefSummary != "Short" {
+		t.Errorf("Expected detailed text omitted from search by default, got %+v", trial)
+	}
+	if trial := search("?include_detailed=true"); trial.DetailedSummary != "Very long description" || trial.Eligibility.Criteria != "Inclusion: adults" {
+		t.Errorf("Expected detailed text with include_detailed=true, got %+v", trial)
+	}
+
+	rec := httptest.NewRecorder()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/v1/trials/NCT00000001", nil), map[string]string{"nct_id": "NCT00000001"})
+	h.GetTrialByID(rec, req)
+	var trial models.Trial
+	if err := json.NewDecoder(rec.Body).Decode(&trial); err != nil {
+		t.Fatalf("Failed to decode trial: %v", err)
+	}
+	if trial.DetailedSummary != "Very long description" || trial.Eligibility.Criteria != "Inclusion: adults" {
+		t.Errorf("Expected full detail on get-by-id, got %+v", trial)
+	}
+}
+
+func TestTracingSpanHierarchy(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	originalProvider, originalPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(originalProvider)
+		otel.SetTextMapPropagator(originalPropagator)
+	})
+
+	var traceparent atomic.Value
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get("traceparent"))
+		emptyStudies(w, r)
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	router := mux.NewRouter()
+	router.Use(middleware.TracingMiddleware)
+	router.HandleFunc("/api/v1/trials/search", h.SearchTrials).Methods("GET")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=paraplegia", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	server, ok := spans["GET /api/v1/trials/search"]
+	if !ok {
+		t.Fatalf("Expected an incoming request span, got %v", spans)
+	}
+	if server.SpanKind != trace.SpanKindServer || server.Parent.IsValid() {
+		t.Errorf("Expected a root server span, got kind %v parent %v", server.SpanKind, server.Parent)
+	}
+
+	for _, name := range []string{"cache.lookup", "GET " + api.RegistryClinicalTrialsGov} {
+		child, ok := spans[name]
+		if !ok {
+			t.Fatalf("Expected a %q span, got %v", name, spans)
+		}
+		if child.Parent.SpanID() != server.SpanContext.SpanID() || child.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("Expected %q to be a child of the request span", name)
+		}
+	}
+
+	upstream := spans["GET "+api.RegistryClinicalTrialsGov]
+	if upstream.SpanKind != trace.SpanKindClient {
+		t.Errorf("Expected a client span for the upstream call, got %v", upstream.SpanKind)
+	}
+	if got, _ := traceparent.Load().(string); !strings.Contains(got, upstream.SpanContext.SpanID().String()) {
+		t.Errorf("Expected traceparent carrying the upstream span, got %q", got)
+	}
+}
+
+func TestWarmCachePopulatesSearchKeys(t *testing.T) {
+	var calls int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}}}],"totalCount":1}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	path := filepath.Join(t.TempDir(), "warmup.json")
+	if err := os.WriteFile(path, []byte(`[{}, {"conditions":["paraplegia"],"status":["RECRUITING"]}, {"conditions":["  Spinal  Cord Injury", "", "spinal cord injury "]}]`), 0o600); err != nil {
+		t.Fatalf("Failed to write warm-up file: %v", err)
+	}
+	requests, err := LoadWarmupRequests(path)
+	if err != nil {
+		t.Fatalf("LoadWarmupRequests failed: %v", err)
+	}
+
+	h.WarmCache(context.Background(), requests)
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("Expected 3 upstream calls during warm-up, got %d", got)
+	}
+
+	// The primed entries must be the ones equivalent GET searches look up
+	for _, query := range []string{"", "?conditions=paraplegia&status=RECRUITING", "?conditions=spinal+cord+injury"} {
+		req := h.parseSearchRequest(httptest.NewRequest(http.MethodGet, "/api/v1/trials/search"+query, nil))
+		if _, found := h.cache.Get(h.generateCacheKey("search", req)); !found {
+			t.Errorf("Expected warm-up to cache the search for %q", query)
+		}
+	}
+	if _, found := h.cache.Get("trial:NCT00000001"); !found {
+		t.Error("Expected warm-up to seed the per-trial cache")
+	}
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=paraplegia&status=RECRUITING", nil))
+	if got := atomic.LoadInt32(&calls); rec.Code != http.StatusOK || got != 3 {
+		t.Errorf("Expected the search to be served from the warmed cache, got status %d and %d upstream calls", rec.Code, got)
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/NCT00000001") {
+			w.Write([]byte(`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}}}`))
+			return
+		}
+		emptyStudies(w, r)
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/health", h.Health).Methods("GET", "HEAD")
+	router.HandleFunc("/api/v1/trials/search", h.SearchTrials).Methods("GET", "HEAD")
+	router.HandleFunc("/api/v1/trials/{nct_id}", h.GetTrialByID).Methods("GET", "HEAD")
+
+	for _, path := range []string{"/health", "/api/v1/trials/search", "/api/v1/trials/NCT00000001"} {
+		t.Run(path, func(t *testing.T) {
+			get := httptest.NewRecorder()
+			router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, path, nil))
+			head := httptest.NewRecorder()
+			router.ServeHTTP(head, httptest.NewRequest(http.MethodHead, path, nil))
+
+			if head.Code != http.StatusOK {
+				t.Fatalf("Expected HEAD status 200, got %d", head.Code)
+			}
+			if head.Body.Len() != 0 {
+				t.Errorf("Expected no body on HEAD, got %q", head.Body.String())
+			}
+			for _, header := range []string{"Content-Type", "Cache-Control", "ETag", "Content-Length"} {
+				if head.Header().Get(header) == "" {
+					t.Errorf("Expected %s header on HEAD", header)
+				}
+			}
+			if path != "/health" && head.Header().Get("ETag") != get.Header().Get("ETag") {
+				t.Errorf("Expected HEAD and GET to share an ETag, got %q and %q", head.Header().Get("ETag"), get.Header().Get("ETag"))
+			}
+			if head.Header().Get("Content-Length") != strconv.Itoa(get.Body.Len()) && path != "/health" {
+				t.Errorf("Expected Content-Length %d, got %s", get.Body.Len(), head.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestMaxResponseTrialsTruncation(t *testing.T) {
+	page := func(ids ...string) string {
+		studies := make([]string, len(ids))
+		for i, id := range ids {
+			status := "RECRUITING"
+			if strings.HasSuffix(id, "X") {
+				status = "WITHDRAWN" // Filtered out client-side before truncation
+			}
+			studies[i] = `{"protocolSection":{"identificationModule":{"nctId":"` + id + `"},"statusModule":{"overallStatus":"` + status + `"}}}`
+		}
+		return "[" + strings.Join(studies, ",") + "]"
+	}
+	var calls int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Query().Get("pageToken") == "upstream-2" {
+			w.Write([]byte(`{"studies":` + page("NCT6") + `,"totalCount":6}`))
+			return
+		}
+		w.Write([]byte(`{"studies":` + page("NCT1", "NCT2X", "NCT3", "NCT4", "NCT5") + `,"totalCount":6,"nextPageToken":"upstream-2"}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true, WithMaxResponseTrials(2))
+
+	var got []string
+	var pages int
+	token := ""
+	for {
+		target := "/api/v1/trials/search?conditions=paraplegia"
+		if token != "" {
+			target += "&page_token=" + token
+		}
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Trials) > 2 || resp.PageSize != len(resp.Trials) {
+			t.Errorf("Expected at most 2 trials with a matching page_size, got %d (page_size %d)", len(resp.Trials), resp.PageSize)
+		}
+		for _, trial := range resp.Trials {
+			got = append(got, trial.NCTID)
+		}
+		pages++
+		if resp.NextPageToken == "" || pages > 5 {
+			break
+		}
+		token = resp.NextPageToken
+	}
+
+	want := []string{"NCT1", "NCT3", "NCT4", "NCT5", "NCT6"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected trials %v across pages, got %v", want, got)
+	}
+	if pages != 3 {
+		t.Errorf("Expected 3 pages, got %d", pages)
+	}
+	// Continuing within an upstream page is served from the cached page
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", got)
+	}
+}
+
+func TestSummarizeLocations(t *testing.T) {
+	registry := &fakeRegistry{name: api.RegistryClinicalTrialsGov, trials: []models.Trial{
+		{NCTID: "NCT1", Locations: []models.Location{
+			{City: "Boston", State: "Massachusetts", Country: "United States"},
+			{City: "Cambridge", State: "Massachusetts", Country: "United States"},
+			{City: "Houston", State: "Texas", Country: "United States"},
+		}},
+		{NCTID: "NCT2", Locations: []models.Location{
+			{City: "Dallas", State: "Texas", Country: "United States"},
+			{City: "São Paulo", Country: "Brazil"},
+		}},
+		{NCTID: "NCT3"},
+		{NCTID: "NCT4", Locations: []models.Location{{City: "Somewhere"}}},
+	}}
+	h := NewTrialsHandler(nil, cache.NewCache(time.Hour), true, WithRegistry(registry))
+
+	rec := httptest.NewRecorder()
+	h.SummarizeLocations(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/summary/locations?conditions=paraplegia", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var summary models.LocationSummary
+	if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if summary.TrialsSummarized != 4 || summary.TotalCount != 0 {
+		t.Errorf("Expected 4 trials summarized and no upstream total from the fake registry, got %d of %d", summary.TrialsSummarized, summary.TotalCount)
+	}
+	if summary.TrialsWithoutLocations != 1 {
+		t.Errorf("Expected 1 trial without locations, got %d", summary.TrialsWithoutLocations)
+	}
+	wantCountries := []models.LocationCount{
+		{Country: "United States", Trials: 2, Sites: 4},
+		{Country: "Brazil", Trials: 1, Sites: 1},
+		{Country: "Unknown", Trials: 1, Sites: 1},
+	}
+	if !reflect.DeepEqual(summary.Countries, wantCountries) {
+		t.Errorf("Expected countries %+v, got %+v", wantCountries, summary.Countries)
+	}
+	wantStates := []models.LocationCount{
+		{Country: "United States", State: "Texas", Trials: 2, Sites: 2},
+		{Country: "United States", State: "Massachusetts", Trials: 1, Sites: 2},
+	}
+	if !reflect.DeepEqual(summary.States, wantStates) {
+		t.Errorf("Expected states %+v, got %+v", wantStates, summary.States)
+	}
+
+	key := h.generateCacheKey("summary:locations", h.parseSearchRequest(httptest.NewRequest(http.MethodGet, "/?conditions=paraplegia", nil)))
+	if _, found := h.cache.Get(key); !found {
+		t.Error("Expected the summary to be cached per query")
+	}
+}
+
+func TestSummarizeLocationsUpstreamTotal(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[` +
+			`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"contactsLocationsModule":{"locations":[{"city":"Boston","country":"United States"}]}}},` +
+			`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"},"contactsLocationsModule":{"locations":[{"city":"Lima","country":"Peru"}]}}}` +
+			`],"totalCount":250,"nextPageToken":"p2"}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+
+	rec := httptest.NewRecorder()
+	h.SummarizeLocations(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/summary/locations?page_size=2", nil))
+	var summary models.LocationSummary
+	if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if summary.TotalCount != 250 || summary.TrialsSummarized != 2 {
+		t.Errorf("Expected 2 trials summarized of 250 upstream matches, got %d of %d", summary.TrialsSummarized, summary.TotalCount)
+	}
+}
+
+func TestNearbyTrials(t *testing.T) {
+	study := func(id, city string, lat, lon float64) string {
+		return fmt.Sprintf(`{"protocolSection":{"identificationModule":{"nctId":%q},"statusModule":{"overallStatus":"RECRUITING"},`+
+			`"contactsLocationsModule":{"locations":[{"city":%q,"geoPoint":{"lat":%f,"lon":%f}},{"city":"Far","geoPoint":{"lat":-33.8688,"lon":151.2093}}]}}}`, id, city, lat, lon)
+	}
+	var upstream url.Values
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.URL.Query()
+		w.Write([]byte(`{"studies":[` +
+			study("NCT-NYC", "New York", 40.7128, -74.0060) + "," +
+			study("NCT-SD", "San Diego", 32.7157, -117.1611) + "," +
+			study("NCT-CHI", "Chicago", 41.8781, -87.6298) +
+			`],"totalCount":3}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	t.Run("sorts recruiting trials by nearest site", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.NearbyTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/nearby?latitude=34.0522&longitude=-118.2437&distance=3000&status=COMPLETED", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if got := upstream.Get("filter.overallStatus"); got != "RECRUITING,NOT_YET_RECRUITING" {
+			t.Errorf("Expected status hard-wired to recruiting states, got %q", got)
+		}
+		if got := upstream.Get("query.cond"); got != api.DefaultConditionQuery {
+			t.Errorf("Expected default conditions, got %q", got)
+		}
+		if got := upstream.Get("filter.geo"); !strings.HasSuffix(got, ",3000mi)") {
+			t.Errorf("Expected the requested distance in the geo filter, got %q", got)
+		}
+
+		want := []string{"NCT-SD", "NCT-CHI", "NCT-NYC"}
+		if len(resp.Trials) != len(want) {
+			t.Fatalf("Expected %d trials, got %d", len(want), len(resp.Trials))
+		}
+		for i, id := range want {
+			if resp.Trials[i].NCTID != id {
+				t.Errorf("Position %d: expected %s, got %s", i, id, resp.Trials[i].NCTID)
+			}
+			if len(resp.Trials[i].Locations) != 1 || resp.Trials[i].Locations[0].City == "Far" {
+				t.Errorf("Expected only the nearest site for %s, got %+v", id, resp.Trials[i].Locations)
+			}
+		}
+	})
+
+	t.Run("conditions override the default", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.NearbyTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/nearby?latitude=34.0522&longitude=-118.2437&conditions=stroke", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := upstream.Get("query.cond"); got != "stroke" {
+			t.Errorf("Expected overridden conditions, got %q", got)
+		}
+	})
+
+	t.Run("close coordinates are cached separately", func(t *testing.T) {
+		for _, query := range []string{"latitude=34.05&longitude=-118.25", "latitude=34.9&longitude=-118.9"} {
+			rec := httptest.NewRecorder()
+			h.NearbyTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/nearby?"+query, nil))
+			if got := rec.Header().Get("X-Cache"); got != "MISS" {
+				t.Errorf("%s: expected another location's results not to be served, got X-Cache %q", query, got)
+			}
+		}
+		if got := upstream.Get("filter.geo"); !strings.HasPrefix(got, "distance(34.900000,-118.900000,") {
+			t.Errorf("Expected the second location upstream, got %q", got)
+		}
+	})
+
+	t.Run("accepts the equator and the prime meridian", func(t *testing.T) {
+		for _, query := range []string{"latitude=0&longitude=9.19", "latitude=51.48&longitude=0"} {
+			rec := httptest.NewRecorder()
+			h.NearbyTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/nearby?"+query, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+			}
+		}
+		if got := upstream.Get("filter.geo"); !strings.HasPrefix(got, "distance(51.480000,0.000000,") {
+			t.Errorf("Expected a geo filter on the prime meridian, got %q", got)
+		}
+	})
+
+	t.Run("requires coordinates", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.NearbyTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/nearby?latitude=34.0522", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestSearchGeoJSON(t *testing.T) {
+	registry := &fakeRegistry{name: api.RegistryClinicalTrialsGov, trials: []models.Trial{
+		{NCTID: "NCT1", Title: "Walking again", Status: "RECRUITING", Locations: []models.Location{
+			{City: "São Paulo", Latitude: -23.5505, Longitude: -46.6333},
+			{City: "Unknown"},
+		}},
+		{NCTID: "NCT2", Title: "No sites", Status: "RECRUITING"},
+		{NCTID: "NCT3", Title: "Ungeocoded", Status: "NOT_YET_RECRUITING", Locations: []models.Location{{City: "Somewhere"}}},
+	}}
+	h := NewTrialsHandler(nil, cache.NewCache(time.Hour), true, WithRegistry(registry))
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?format=geojson", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Expected GeoJSON content type, got %q", ct)
+	}
+
+	var collection map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&collection); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if collection["type"] != "FeatureCollection" {
+		t.Errorf("Expected a FeatureCollection, got %v", collection["type"])
+	}
+	features, _ := collection["features"].([]interface{})
+	if len(features) != 1 {
+		t.Fatalf("Expected 1 feature for the single geocoded site, got %d", len(features))
+	}
+
+	feature := features[0].(map[string]interface{})
+	if feature["type"] != "Feature" {
+		t.Errorf("Expected a Feature, got %v", feature["type"])
+	}
+	geometry := feature["geometry"].(map[string]interface{})
+	if geometry["type"] != "Point" {
+		t.Errorf("Expected a Point geometry, got %v", geometry["type"])
+	}
+	coordinates := geometry["coordinates"].([]interface{})
+	if len(coordinates) != 2 || coordinates[0] != -46.6333 || coordinates[1] != -23.5505 {
+		t.Errorf("Expected [lon, lat] coordinates [-46.6333, -23.5505], got %v", coordinates)
+	}
+	properties := feature["properties"].(map[string]interface{})
+	want := map[string]interface{}{"nct_id": "NCT1", "title": "Walking again", "status": "RECRUITING", "city": "São Paulo"}
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("Expected properties %v, got %v", want, properties)
+	}
+
+	t.Run("rejects unknown format", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?format=kml", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAllowedConditions(t *testing.T) {
+	var upstreamCond string
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamCond = r.URL.Query().Get("query.cond")
+		emptyStudies(w, r)
+	})
+	allowed := []string{"Spinal Cord Injury", "Tetraplegia"}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		url        string
+		wantStatus int
+		wantCond   string
+	}{
+		{"allowed conditions pass", []Option{WithAllowedConditions(allowed, ConditionsModeReject)}, "/api/v1/trials/search?conditions=spinal+cord+injury,Tetraplegia", http.StatusOK, "spinal cord injury OR Tetraplegia"},
+		{"default conditions pass", []Option{WithAllowedConditions(allowed, ConditionsModeReject)}, "/api/v1/trials/search", http.StatusOK, api.DefaultConditionQuery},
+		{"reject disallowed condition", []Option{WithAllowedConditions(allowed, ConditionsModeReject)}, "/api/v1/trials/search?conditions=tetraplegia,diabetes", http.StatusBadRequest, ""},
+		{"reject disallowed query", []Option{WithAllowedConditions(allowed, ConditionsModeReject)}, "/api/v1/trials/search?query=diabetes", http.StatusBadRequest, ""},
+		{"restrict drops disallowed condition", []Option{WithAllowedConditions(allowed, ConditionsModeRestrict)}, "/api/v1/trials/search?conditions=tetraplegia,diabetes", http.StatusOK, "tetraplegia"},
+		{"restrict falls back to allowlist", []Option{WithAllowedConditions(allowed, ConditionsModeRestrict)}, "/api/v1/trials/search?query=diabetes", http.StatusOK, "Spinal Cord Injury OR Tetraplegia"},
+		{"unrestricted by default", nil, "/api/v1/trials/search?conditions=diabetes", http.StatusOK, "diabetes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamCond = ""
+			h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, tt.opts...)
+			rec := httptest.NewRecorder()
+			h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if upstreamCond != tt.wantCond {
+				t.Errorf("Expected upstream condition %q, got %q", tt.wantCond, upstreamCond)
+			}
+		})
+	}
+
+	t.Run("POST is rejected too", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithAllowedConditions(allowed, ConditionsModeReject))
+		rec := httptest.NewRecorder()
+		h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(`{"conditions":["diabetes"]}`)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestGetTrialRaw(t *testing.T) {
+	payload := `{"protocolSection":{"identificationModule":{"nctId":"NCT00000001","briefTitle":"Gait training"},` +
+		`"outcomesModule":{"primaryOutcomes":[{"measure":"10-meter walk test"}]}},"hasResults":false}`
+	var calls int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(payload))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+	// A search-seeded entry has no raw study
+	h.cache.Set("trial:NCT00000001", &models.Trial{NCTID: "NCT00000001", Registry: api.RegistryClinicalTrialsGov})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, target, nil), map[string]string{"nct_id": "NCT00000001"})
+		h.GetTrialByID(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := get("/api/v1/trials/NCT00000001?raw=true")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			NCTID string          `json:"nct_id"`
+			Raw   json.RawMessage `json:"raw"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var got, want interface{}
+		json.Unmarshal(resp.Raw, &got)
+		json.Unmarshal([]byte(payload), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected raw output to match the upstream payload, got %s", resp.Raw)
+		}
+		if resp.NCTID != "NCT00000001" {
+			t.Errorf("Expected nct_id NCT00000001, got %q", resp.NCTID)
+		}
+	}
+	// The seeded entry forces one fetch; the second raw request is served from cache
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", got)
+	}
+
+	rec := get("/api/v1/trials/NCT00000001")
+	if strings.Contains(rec.Body.String(), "outcomesModule") {
+		t.Error("Expected the raw study to be omitted without raw=true")
+	}
+
+	t.Run("unsupported registry", func(t *testing.T) {
+		ictrp := &fakeRegistry{name: api.RegistryICTRP}
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true, WithRegistry(ictrp))
+		rec := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/v1/trials/RBR-1?registry=ictrp&raw=true", nil), map[string]string{"nct_id": "RBR-1"})
+		h.GetTrialByID(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestUpdatedSincePolling(t *testing.T) {
+	study := func(id, updated string) string {
+		return `{"protocolSection":{"identificationModule":{"nctId":"` + id + `"},"statusModule":{"overallStatus":"RECRUITING","lastUpdatePostDateStruct":{"date":"` + updated + `"}}}}`
+	}
+	var upstreamFilter string
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamFilter = r.URL.Query().Get("filter.advanced")
+		// The mock ignores the filter, so the stale trial exercises the client-side guard
+		w.Write([]byte(`{"studies":[` + study("NCT1", "2024-03-02") + "," + study("NCT2", "2024-05-17") + "," +
+			study("NCT3", "2024-01-10") + "," + study("NCT4", "2024-04-30") + `],"totalCount":4}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	search := func(target string) (*httptest.ResponseRecorder, models.SearchResponse) {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp models.SearchResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec, resp
+	}
+
+	rec, resp := search("/api/v1/trials/search")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if resp.MostRecentUpdate != "2024-05-17" {
+		t.Errorf("Expected most_recent_update 2024-05-17, got %q", resp.MostRecentUpdate)
+	}
+	if upstreamFilter != "" {
+		t.Errorf("Expected no upstream date filter without updated_since, got %q", upstreamFilter)
+	}
+
+	rec, resp = search("/api/v1/trials/search?updated_since=2024-03-02")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if upstreamFilter != "AREA[LastUpdatePostDate]RANGE[2024-03-02,MAX]" {
+		t.Errorf("Unexpected upstream date filter %q", upstreamFilter)
+	}
+	var ids []string
+	for _, trial := range resp.Trials {
+		ids = append(ids, trial.NCTID)
+	}
+	if want := []string{"NCT1", "NCT2", "NCT4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected trials updated on or after the date %v, got %v", want, ids)
+	}
+	if resp.MostRecentUpdate != "2024-05-17" {
+		t.Errorf("Expected most_recent_update 2024-05-17, got %q", resp.MostRecentUpdate)
+	}
+
+	if rec, _ := search("/api/v1/trials/search?updated_since=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid date, got %d", rec.Code)
+	}
+}
+
+func TestMostRecentUpdate(t *testing.T) {
+	trials := []models.Trial{{LastUpdateDate: "2024-02-01"}, {}, {LastUpdateDate: "2024-11-30"}, {LastUpdateDate: "2023-12-31"}}
+	if got := mostRecentUpdate(trials); got != "2024-11-30" {
+		t.Errorf("Expected 2024-11-30, got %q", got)
+	}
+	if got := mostRecentUpdate([]models.Trial{{}}); got != "" {
+		t.Errorf("Expected no date when none is known, got %q", got)
+	}
+}
+
+func TestSearchListLimits(t *testing.T) {
+	h := NewTrialsHandler(newMockUpstream(t, emptyStudies), cache.NewCache(time.Hour), false, WithSearchLimits(3, 2, 0))
+	list := func(prefix string, n int) string {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = prefix + strconv.Itoa(i)
+		}
+		return strings.Join(values, ",")
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{"conditions at limit", "conditions=" + list("c", 3), http.StatusOK},
+		{"conditions above limit", "conditions=" + list("c", 4), http.StatusBadRequest},
+		{"phases at limit", "phase=" + list("PHASE", 2), http.StatusOK},
+		{"phases above limit", "phase=" + list("PHASE", 3), http.StatusBadRequest},
+		{"statuses at default limit", "status=" + strings.Repeat("RECRUITING,", DefaultMaxStatuses), http.StatusOK},
+		{"statuses above default limit", "status=" + strings.Repeat("RECRUITING,", DefaultMaxStatuses+1), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("unknown status", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?status=recruiting,OPEN", nil))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `invalid status \"OPEN\"`) {
+			t.Errorf("Expected status 400 naming the unknown status, got %d: %s", rec.Code, rec.Body.String())
+		}
+		rec = httptest.NewRecorder()
+		h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(`{"status":["Completed","bogus"]}`)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for an unknown POST status, got %d", rec.Code)
+		}
+	})
+
+	t.Run("POST above limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(`{"conditions":["a","b","c","d"]}`)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAppliedFilters(t *testing.T) {
+	h := NewTrialsHandler(newMockUpstream(t, emptyStudies), cache.NewCache(time.Hour), false)
+	search := func(t *testing.T, query string) *models.AppliedFilters {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.AppliedFilters == nil {
+			t.Fatal("Expected applied_filters in response")
+		}
+		return resp.AppliedFilters
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		want := &models.AppliedFilters{
+			Conditions:          []string{api.DefaultConditionQuery},
+			ConditionsDefaulted: true,
+			Status:              api.RecruitingStatuses,
+			StatusDefaulted:     true,
+		}
+		if got := search(t, ""); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("echoes request", func(t *testing.T) {
+		want := &models.AppliedFilters{
+			Conditions:      []string{"paraplegia", "tetraplegia"},
+			ConditionLogic:  api.ConditionLogicAnd,
+			Status:          []string{"COMPLETED"},
+			IncludeInactive: true,
+			Phase:           []string{"PHASE2"},
+			MinimumAge:      "40",
+			MaximumAge:      "40",
+			Country:         "Brazil",
+			UpdatedSince:    "2024-01-01",
+		}
+		got := search(t, "conditions=paraplegia,tetraplegia&condition_logic=and&status=COMPLETED&include_inactive=true&phase=PHASE2&age=40&country=Brazil&updated_since=2024-01-01")
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("query as condition", func(t *testing.T) {
+		got := search(t, "query=spasticity")
+		if !reflect.DeepEqual(got.Conditions, []string{"spasticity"}) || got.ConditionsDefaulted {
+			t.Errorf("Expected query echoed as condition, got %+v", got)
+		}
+	})
+}
+
+func TestExportCursor(t *testing.T) {
+	study := func(id string) string {
+		return `{"protocolSection":{"identificationModule":{"nctId":"` + id + `"},"statusModule":{"overallStatus":"RECRUITING"}}}`
+	}
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") == "upstream-2" {
+			w.Write([]byte(`{"studies":[` + study("NCT2") + `],"totalCount":2}`))
+			return
+		}
+		w.Write([]byte(`{"studies":[` + study("NCT1") + `],"totalCount":2,"nextPageToken":"upstream-2"}`))
+	})
+	search := func(t *testing.T, h *TrialsHandler, query string) (int, models.SearchResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		var resp models.SearchResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	t.Run("create and resume", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+		code, first := search(t, h, "conditions=paraplegia&export=true")
+		if code != http.StatusOK || first.ExportID == "" {
+			t.Fatalf("Expected an export_id, got status %d and %+v", code, first)
+		}
+		if len(first.Trials) != 1 || first.Trials[0].NCTID != "NCT1" {
+			t.Fatalf("Expected NCT1 on the first page, got %+v", first.Trials)
+		}
+
+		// Resuming ignores the other params and continues the stored search
+		code, second := search(t, h, "export_id="+first.ExportID+"&conditions=tetraplegia")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200 resuming, got %d", code)
+		}
+		if second.ExportID != first.ExportID || len(second.Trials) != 1 || second.Trials[0].NCTID != "NCT2" {
+			t.Errorf("Expected NCT2 under the same export_id, got %+v", second)
+		}
+		if second.NextPageToken != "" {
+			t.Errorf("Expected the last page to have no next page token, got %q", second.NextPageToken)
+		}
+
+		// A finished export is forgotten
+		if code, _ := search(t, h, "export_id="+first.ExportID); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for a finished export, got %d", code)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+		if code, _ := search(t, h, "export_id=nope"); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown export, got %d", code)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithExportTTL(10*time.Millisecond))
+		_, first := search(t, h, "conditions=paraplegia&export=true")
+		time.Sleep(30 * time.Millisecond)
+		if code, _ := search(t, h, "export_id="+first.ExportID); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an expired export, got %d", code)
+		}
+	})
+
+	t.Run("plain search has no export_id", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+		if _, resp := search(t, h, "conditions=paraplegia"); resp.ExportID != "" {
+			t.Errorf("Expected no export_id, got %q", resp.ExportID)
+		}
+	})
+}
+
+func TestAdvancedQuery(t *testing.T) {
+	var upstreamQuery atomic.Value
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamQuery.Store(r.URL.Query())
+		emptyStudies(w, r)
+	})
+	expr := "AREA[Phase]PHASE2 AND spasticity"
+	search := func(h *TrialsHandler, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+	rec := search(h, "advanced_query="+url.QueryEscape(expr)+"&status=RECRUITING&query=ignored")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	params := upstreamQuery.Load().(url.Values)
+	if got := params.Get("query.term"); got != expr {
+		t.Errorf("Expected query.term %q upstream, got %q", expr, got)
+	}
+	if params.Has("query.cond") {
+		t.Errorf("Expected no query.cond upstream, got %q", params.Get("query.cond"))
+	}
+	if got := params.Get("filter.overallStatus"); got != "RECRUITING" {
+		t.Errorf("Expected status filter RECRUITING upstream, got %q", got)
+	}
+	var resp models.SearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.AppliedFilters == nil || resp.AppliedFilters.AdvancedQuery != expr || len(resp.AppliedFilters.Conditions) != 0 {
+		t.Errorf("Expected the advanced query echoed without conditions, got %+v", resp.AppliedFilters)
+	}
+
+	if rec := search(h, "advanced_query=x&registry=ictrp"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for another registry, got %d", rec.Code)
+	}
+
+	restricted := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithAllowedConditions([]string{"paraplegia"}, ConditionsModeRestrict))
+	if rec := search(restricted, "advanced_query=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 with a condition allowlist, got %d", rec.Code)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	study := `{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT1"},"statusModule":{"overallStatus":"RECRUITING"}}}],"totalCount":1}`
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(study))
+	})
+	serve := func(h *TrialsHandler, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey{}, "req-42"))
+		h.SearchTrials(rec, req)
+		return rec
+	}
+	decode := func(t *testing.T, rec *httptest.ResponseRecorder) map[string]json.RawMessage {
+		t.Helper()
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return body
+	}
+
+	t.Run("flat by default", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+		if body := decode(t, serve(h, "/api/v1/trials/search")); body["trials"] == nil || body["data"] != nil {
+			t.Errorf("Expected a flat search response, got %v", body)
+		}
+		if body := decode(t, serve(h, "/api/v1/trials/search?sort=bogus")); body["error"] == nil || body["errors"] != nil {
+			t.Errorf("Expected a flat error, got %v", body)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+		for _, wantHit := range []bool{false, true} {
+			rec := serve(h, "/api/v1/trials/search?envelope=true")
+			var env struct {
+				Data   models.SearchResponse `json:"data"`
+				Meta   models.EnvelopeMeta   `json:"meta"`
+				Errors []models.EnvelopeError
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatalf("Failed to decode envelope: %v", err)
+			}
+			if len(env.Data.Trials) != 1 || env.Errors != nil {
+				t.Errorf("Expected the search response as data, got %s", rec.Body.String())
+			}
+			if env.Meta.RequestID != "req-42" || env.Meta.CacheHit != wantHit {
+				t.Errorf("Expected meta with request ID and cache_hit %v, got %+v", wantHit, env.Meta)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithEnvelope(true))
+		rec := serve(h, "/api/v1/trials/search?sort=bogus")
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", rec.Code)
+		}
+		body := decode(t, rec)
+		if string(body["data"]) != "null" || body["meta"] == nil {
+			t.Errorf("Expected null data and meta, got %s", rec.Body.String())
+		}
+		var errs []models.EnvelopeError
+		json.Unmarshal(body["errors"], &errs)
+		if len(errs) != 1 || errs[0].Status != http.StatusBadRequest || errs[0].Message == "" {
+			t.Errorf("Expected one 400 error, got %+v", errs)
+		}
+
+		// The per-request param overrides the configured default
+		if body := decode(t, serve(h, "/api/v1/trials/search?envelope=false")); body["trials"] == nil {
+			t.Errorf("Expected a flat response with envelope=false, got %v", body)
+		}
+	})
+}
+
+func TestCacheStatusHeader(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/NCT1") {
+			w.Write([]byte(`{"protocolSection":{"identificationModule":{"nctId":"NCT1"}}}`))
+			return
+		}
+		emptyStudies(w, r)
+	})
+
+	tests := []struct {
+		name  string
+		serve func(h *TrialsHandler, w http.ResponseWriter)
+	}{
+		{"search", func(h *TrialsHandler, w http.ResponseWriter) {
+			h.SearchTrials(w, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=paraplegia", nil))
+		}},
+		{"get by id", func(h *TrialsHandler, w http.ResponseWriter) {
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/v1/trials/NCT1", nil), map[string]string{"nct_id": "NCT1"})
+			h.GetTrialByID(w, req)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, cacheEnabled := range []bool{true, false} {
+				h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), cacheEnabled)
+				want := []string{"MISS", "HIT"}
+				if !cacheEnabled {
+					want = []string{"MISS", "MISS"}
+				}
+				for i, w := range want {
+					rec := httptest.NewRecorder()
+					tt.serve(h, rec)
+					if rec.Code != http.StatusOK {
+						t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+					}
+					if got := rec.Header().Get("X-Cache"); got != w {
+						t.Errorf("cache=%v request %d: expected X-Cache %s, got %q", cacheEnabled, i+1, w, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHasContactFilter(t *testing.T) {
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT1"},"contactsLocationsModule":{"contacts":{"centralContacts":[{"name":"A","email":"a@example.org"}]}}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT2"},"contactsLocationsModule":{"contacts":{"centralContacts":[{"name":"B","phone":"555-0100"}]}}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT3"}}}` +
+		`],"totalCount":3}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), false)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"", http.StatusOK, []string{"NCT1", "NCT2", "NCT3"}},
+		{"has_contact=true", http.StatusOK, []string{"NCT1", "NCT2"}},
+		{"has_contact=true&contact_type=email", http.StatusOK, []string{"NCT1"}},
+		{"has_contact=true&contact_type=phone", http.StatusOK, []string{"NCT2"}},
+		{"has_contact=true&contact_type=fax", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp models.SearchResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			got := make([]string, 0, len(resp.Trials))
+			for _, trial := range resp.Trials {
+				got = append(got, trial.NCTID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected trials %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNCTIDsSearch(t *testing.T) {
+	var upstreamQuery atomic.Value
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"designModule":{"phases":["PHASE2"]}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"},"designModule":{"phases":["PHASE3"]}}}` +
+		`],"totalCount":2}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamQuery.Store(r.URL.Query())
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), false)
+	search := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	rec := search("nct_ids=nct00000001,%20NCT00000002&phase=PHASE2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	params := upstreamQuery.Load().(url.Values)
+	if got := params.Get("filter.ids"); got != "NCT00000001,NCT00000002" {
+		t.Errorf("Expected normalized filter.ids upstream, got %q", got)
+	}
+	var resp models.SearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Trials) != 1 || resp.Trials[0].NCTID != "NCT00000001" {
+		t.Errorf("Expected only the PHASE2 trial after client-side filtering, got %+v", resp.Trials)
+	}
+
+	for _, query := range []string{
+		"nct_ids=NCT123",
+		"nct_ids=NCT00000001&registry=ictrp",
+		"nct_ids=" + strings.Repeat("NCT00000001,", MaxNCTIDs+1),
+	} {
+		if rec := search(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query[:min(len(query), 40)], rec.Code)
+		}
+	}
+}
+
+func TestFillPage(t *testing.T) {
+	// Three upstream pages; trials ending in X are withdrawn and filtered out client-side
+	pages := map[string][]string{
+		"":   {"NCT1", "NCT2X", "NCT3X"},
+		"u2": {"NCT4", "NCT5", "NCT6X"},
+		"u3": {"NCT7X", "NCT8"},
+	}
+	next := map[string]string{"": "u2", "u2": "u3"}
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("pageToken")
+		studies := make([]string, 0, len(pages[token]))
+		for _, id := range pages[token] {
+			status := "RECRUITING"
+			if strings.HasSuffix(id, "X") {
+				status = "WITHDRAWN"
+			}
+			studies = append(studies, `{"protocolSection":{"identificationModule":{"nctId":"`+id+`"},"statusModule":{"overallStatus":"`+status+`"}}}`)
+		}
+		nextToken := ""
+		if next[token] != "" {
+			nextToken = `,"nextPageToken":"` + next[token] + `"`
+		}
+		w.Write([]byte(`{"studies":[` + strings.Join(studies, ",") + `],"totalCount":8` + nextToken + `}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	var got []int
+	var ids []string
+	token := ""
+	for i := 0; i < 5; i++ {
+		target := "/api/v1/trials/search?fill_page=true&page_size=2"
+		if token != "" {
+			target += "&page_token=" + token
+		}
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		got = append(got, len(resp.Trials))
+		for _, trial := range resp.Trials {
+			ids = append(ids, trial.NCTID)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		token = resp.NextPageToken
+	}
+
+	if want := []string{"NCT1", "NCT4", "NCT5", "NCT8"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected trials %v across filled pages, got %v", want, ids)
+	}
+	if want := []int{2, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected page sizes %v, got %v", want, got)
+	}
+}
+
+func TestFillPagePartialNotCached(t *testing.T) {
+	var failPage2 atomic.Bool
+	failPage2.Store(true)
+	var calls atomic.Int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Query().Get("pageToken") == "u2" {
+			if failPage2.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT2"},"statusModule":{"overallStatus":"RECRUITING"}}}],"totalCount":2}`))
+			return
+		}
+		w.Write([]byte(`{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT1"},"statusModule":{"overallStatus":"RECRUITING"}}}],"totalCount":2,"nextPageToken":"u2"}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	search := func() (*httptest.ResponseRecorder, models.SearchResponse) {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?fill_page=true&page_size=2", nil))
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec, resp
+	}
+
+	if _, resp := search(); len(resp.Trials) != 1 || !resp.Partial {
+		t.Fatalf("Expected a partial page with 1 trial, got %d trials, partial %v", len(resp.Trials), resp.Partial)
+	}
+
+	failPage2.Store(false)
+	rec, resp := search()
+	if rec.Header().Get("X-Cache") != "MISS" || len(resp.Trials) != 2 || resp.Partial {
+		t.Errorf("Expected the retry to go upstream for a full page, got X-Cache %q, %d trials, partial %v", rec.Header().Get("X-Cache"), len(resp.Trials), resp.Partial)
+	}
+	if rec, _ := search(); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected the full page to be cached, got X-Cache %q", rec.Header().Get("X-Cache"))
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("Expected 4 upstream calls, got %d", n)
+	}
+
+	// Location summaries of a partial scan are not cached either
+	failPage2.Store(true)
+	summarize := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SummarizeLocations(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/summary/locations?fill_page=true&page_size=2", nil))
+		return rec
+	}
+	if rec := summarize(); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"trials_summarized":1`) {
+		t.Fatalf("Expected a summary of the partial page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	failPage2.Store(false)
+	if rec := summarize(); rec.Header().Get("X-Cache") != "MISS" || !strings.Contains(rec.Body.String(), `"trials_summarized":2`) {
+		t.Errorf("Expected the partial summary not to be cached, got X-Cache %q: %s", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+}
+
+func TestHasResultsFilter(t *testing.T) {
+	var upstreamQuery atomic.Value
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}},"hasResults":true},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"}}}` +
+		`],"totalCount":2}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamQuery.Store(r.URL.Query())
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), false)
+	search := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	rec := search("has_results=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := upstreamQuery.Load().(url.Values).Get("aggFilters"); got != "results:with" {
+		t.Errorf("Expected aggFilters results:with upstream, got %q", got)
+	}
+	var resp models.SearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Trials) != 1 || resp.Trials[0].NCTID != "NCT00000001" || !resp.Trials[0].HasResults {
+		t.Errorf("Expected only the trial with posted results, got %+v", resp.Trials)
+	}
+
+	if rec := search("has_results=true&registry=ictrp"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for has_results on ictrp, got %d", rec.Code)
+	}
+}
+
+func TestMatchParam(t *testing.T) {
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"conditionsModule":{"conditions":["Paraplegia"]}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"},"conditionsModule":{"conditions":["Paraplegia, Spastic"]}}}` +
+		`],"totalCount":2}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), false)
+	search := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	for _, tt := range []struct {
+		query     string
+		want      int
+		wantMatch string
+	}{
+		{"conditions=paraplegia", 2, ""},
+		{"conditions=paraplegia&match=partial", 2, ""},
+		{"conditions=paraplegia&match=exact", 1, api.MatchExact},
+	} {
+		rec := search(tt.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.query, rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Trials) != tt.want {
+			t.Errorf("%s: expected %d trials, got %d", tt.query, tt.want, len(resp.Trials))
+		}
+		if resp.AppliedFilters == nil || resp.AppliedFilters.Match != tt.wantMatch {
+			t.Errorf("%s: expected applied match %q, got %+v", tt.query, tt.wantMatch, resp.AppliedFilters)
+		}
+	}
+
+	for _, query := range []string{"match=fuzzy", "match=exact&advanced_query=x"} {
+		if rec := search(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestHumanizeStatus(t *testing.T) {
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"statusModule":{"overallStatus":"NOT_YET_RECRUITING"}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"},"statusModule":{"overallStatus":"RECRUITING"}}}` +
+		`],"totalCount":2}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), true)
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"", ""}},
+		{"humanize_status=true", []string{"Not yet recruiting", "Recruiting"}},
+	} {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+tt.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d: %s", tt.query, rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Trials) != 2 {
+			t.Fatalf("%q: expected 2 trials, got %d", tt.query, len(resp.Trials))
+		}
+		for i, trial := range resp.Trials {
+			if trial.StatusLabel != tt.want[i] {
+				t.Errorf("%q: expected status_label %q for %s, got %q", tt.query, tt.want[i], trial.Status, trial.StatusLabel)
+			}
+			if trial.Status == "" {
+				t.Errorf("%q: expected the raw status kept", tt.query)
+			}
+		}
+	}
+}
+
+func TestGetTrialHistory(t *testing.T) {
+	var calls atomic.Int32
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/NCT00000001/history":
+			w.Write([]byte(`{"changes":[` +
+				`{"version":0,"date":"2021-03-10","status":"NOT_YET_RECRUITING","moduleLabels":["Study Status","Eligibility"]},` +
+				`{"version":1,"date":"2021-06-02","status":"RECRUITING","moduleLabels":["Study Status"]}]}`))
+		case "/NCT00000002/history":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}), cache.NewCache(time.Hour), true)
+	get := func(id, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/trials/"+id+"/history"+query, nil)
+		h.GetTrialHistory(rec, mux.SetURLVars(req, map[string]string{"nct_id": id}))
+		return rec
+	}
+
+	for _, wantCache := range []string{"MISS", "HIT"} {
+		rec := get("nct00000001", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("X-Cache"); got != wantCache {
+			t.Errorf("Expected X-Cache %s, got %s", wantCache, got)
+		}
+		var history models.TrialHistory
+		if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+			t.Fatalf("Failed to decode history: %v", err)
+		}
+		if history.NCTID != "NCT00000001" || len(history.Versions) != 2 || history.Versions[1].Status != "RECRUITING" {
+			t.Errorf("Unexpected history %+v", history)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the cached history to be reused, got %d upstream calls", calls.Load())
+	}
+
+	for _, tt := range []struct {
+		id, query string
+		want      int
+	}{
+		{"NCT00000009", "", http.StatusNotFound},
+		{"NCT00000002", "", http.StatusBadGateway},
+		{"RBR-7abc12", "", http.StatusBadRequest},
+		{"NCT00000001", "?registry=ictrp", http.StatusBadRequest},
+	} {
+		if rec := get(tt.id, tt.query); rec.Code != tt.want {
+			t.Errorf("%s%s: expected status %d, got %d", tt.id, tt.query, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestSuggestConditions(t *testing.T) {
+	h := NewTrialsHandler(api.NewClinicalTrialsClient(), cache.NewCache(time.Hour), true)
+	suggest := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SuggestConditions(rec, httptest.NewRequest(http.MethodGet, "/api/v1/conditions/suggest?"+query, nil))
+		return rec
+	}
+
+	for _, tt := range []struct {
+		query     string
+		wantCache string
+	}{
+		{"q=Para", "MISS"},
+		{"q=para", "HIT"}, // Cached by normalized prefix
+		{"q=para&limit=1", "MISS"},
+	} {
+		rec := suggest(tt.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.query, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("X-Cache"); got != tt.wantCache {
+			t.Errorf("%s: expected X-Cache %s, got %s", tt.query, tt.wantCache, got)
+		}
+		var resp models.ConditionSuggestions
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode suggestions: %v", err)
+		}
+		if resp.Query != "para" || len(resp.Suggestions) != 1 || resp.Suggestions[0] != "Paraplegia" {
+			t.Errorf("%s: unexpected suggestions %+v", tt.query, resp)
+		}
+	}
+
+	rec := suggest("q=zzz")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"suggestions":[]`) {
+		t.Errorf("Expected an empty suggestion list, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, query := range []string{"", "q=%20", "q=para&limit=0", "q=para&limit=100"} {
+		if rec := suggest(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestRepeatedListParams(t *testing.T) {
+	h := NewTrialsHandler(api.NewClinicalTrialsClient(), cache.NewCache(time.Hour), false)
+	tests := []struct {
+		name   string
+		query  string
+		field  func(models.SearchRequest) []string
+		expect []string
+	}{
+		{"conditions repeated", "conditions=paraplegia&conditions=tetraplegia", func(r models.SearchRequest) []string { return r.Conditions }, []string{"paraplegia", "tetraplegia"}},
+		{"nct_ids repeated", "nct_ids=nct00000001&nct_ids=NCT00000002,%20NCT00000003", func(r models.SearchRequest) []string { return r.NCTIDs }, []string{"NCT00000001", "NCT00000002", "NCT00000003"}},
+		{"conditions comma", "conditions=paraplegia,%20tetraplegia", func(r models.SearchRequest) []string { return r.Conditions }, []string{"paraplegia", "tetraplegia"}},
+		{"conditions mixed", "conditions=paraplegia,tetraplegia&conditions=spinal%20cord%20injury", func(r models.SearchRequest) []string { return r.Conditions }, []string{"paraplegia", "tetraplegia", "spinal cord injury"}},
+		{"status repeated", "status=RECRUITING&status=COMPLETED", func(r models.SearchRequest) []string { return r.Status }, []string{"RECRUITING", "COMPLETED"}},
+		{"status mixed", "status=RECRUITING,&status=COMPLETED,ACTIVE_NOT_RECRUITING", func(r models.SearchRequest) []string { return r.Status }, []string{"RECRUITING", "COMPLETED", "ACTIVE_NOT_RECRUITING"}},
+		{"phase repeated", "phase=PHASE1&phase=PHASE2", func(r models.SearchRequest) []string { return r.Phase }, []string{"PHASE1", "PHASE2"}},
+		{"phase comma", "phase=PHASE1,PHASE2", func(r models.SearchRequest) []string { return r.Phase }, []string{"PHASE1", "PHASE2"}},
+		{"empty values", "phase=&phase=,", func(r models.SearchRequest) []string { return r.Phase }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := h.parseSearchRequest(httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+tt.query, nil))
+			if got := tt.field(req); strings.Join(got, "|") != strings.Join(tt.expect, "|") || len(got) != len(tt.expect) {
+				t.Errorf("Expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+
+	// Both styles select the same cached search
+	repeated := h.parseSearchRequest(httptest.NewRequest(http.MethodGet, "/?status=RECRUITING&status=COMPLETED", nil))
+	comma := h.parseSearchRequest(httptest.NewRequest(http.MethodGet, "/?status=RECRUITING,COMPLETED", nil))
+	if h.generateCacheKey("search", repeated) != h.generateCacheKey("search", comma) {
+		t.Error("Expected repeated and comma-separated params to share a cache key")
+	}
+}
+
+func TestWatchTrial(t *testing.T) {
+	var status atomic.Value
+	status.Store("RECRUITING")
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/NCT00000001") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"statusModule":{"overallStatus":%q}}}`, status.Load())
+	})
+
+	notified := make(chan models.StatusChangeNotification, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification models.StatusChangeNotification
+		json.NewDecoder(r.Body).Decode(&notification)
+		notified <- notification
+	}))
+	defer webhook.Close()
+
+	watcher := watch.NewWatcher(apiClient, watch.WithAllowPrivateWebhooks(true))
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithWatcher(watcher))
+	request := func(handler http.HandlerFunc, method, id, query, body string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(method, "/api/v1/watch/"+id+query, strings.NewReader(body)), map[string]string{"nct_id": id})
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		id, body string
+		status   int
+	}{
+		{"nct00000001", `{"url":"ftp://example.com/hook"}`, http.StatusBadRequest},
+		{"nct00000001", `{"url":"/relative"}`, http.StatusBadRequest},
+		{"NOT-AN-ID", `{"url":"` + webhook.URL + `"}`, http.StatusBadRequest},
+		{"NCT00000002", `{"url":"` + webhook.URL + `"}`, http.StatusNotFound},
+	} {
+		if rec := request(h.WatchTrial, http.MethodPost, tt.id, "", tt.body); rec.Code != tt.status {
+			t.Errorf("POST %s %s: expected status %d, got %d", tt.id, tt.body, tt.status, rec.Code)
+		}
+	}
+
+	rec := request(h.WatchTrial, http.MethodPost, "nct00000001", "", `{"url":"`+webhook.URL+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var subscription models.WatchSubscription
+	json.Unmarshal(rec.Body.Bytes(), &subscription)
+	if subscription.NCTID != "NCT00000001" || subscription.URL != webhook.URL || subscription.Status != "RECRUITING" {
+		t.Errorf("Unexpected subscription %+v", subscription)
+	}
+
+	// A status change on the next poll reaches the webhook
+	status.Store("ACTIVE_NOT_RECRUITING")
+	watcher.Poll(context.Background())
+	select {
+	case notification := <-notified:
+		if notification.NCTID != "NCT00000001" || notification.PreviousStatus != "RECRUITING" || notification.Status != "ACTIVE_NOT_RECRUITING" {
+			t.Errorf("Unexpected notification %+v", notification)
+		}
+	default:
+		t.Fatal("Expected the webhook to be notified of the status change")
+	}
+
+	if rec := request(h.UnwatchTrial, http.MethodDelete, "NCT00000001", "?url="+url.QueryEscape(webhook.URL), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 on unwatch, got %d", rec.Code)
+	}
+	if rec := request(h.UnwatchTrial, http.MethodDelete, "NCT00000001", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 once unwatched, got %d", rec.Code)
+	}
+
+	// Watching is off without a watcher
+	disabled := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+	if rec := request(disabled.WatchTrial, http.MethodPost, "NCT00000001", "", `{"url":"`+webhook.URL+`"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without a watcher, got %d", rec.Code)
+	}
+}
+
+func TestFunderTypeParam(t *testing.T) {
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"sponsorCollaboratorsModule":{"leadSponsor":{"name":"Acme Pharma","class":"INDUSTRY"}}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"},"sponsorCollaboratorsModule":{"leadSponsor":{"name":"NINDS","class":"NIH"}}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000003"},"sponsorCollaboratorsModule":{"leadSponsor":{"name":"State University","class":"OTHER"}}}}` +
+		`],"totalCount":3}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), false)
+	search := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	rec := search("funder_type=nih&funder_type=other")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.SearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Trials) != 2 || resp.Trials[0].NCTID != "NCT00000002" || resp.Trials[1].NCTID != "NCT00000003" {
+		t.Errorf("Expected the NIH and OTHER trials, got %+v", resp.Trials)
+	}
+	if resp.AppliedFilters == nil || strings.Join(resp.AppliedFilters.FunderType, ",") != "NIH,OTHER" {
+		t.Errorf("Expected applied funder_type NIH,OTHER, got %+v", resp.AppliedFilters)
+	}
+
+	for _, query := range []string{"funder_type=pharma", "funder_type=INDUSTRY&registry=ictrp"} {
+		if rec := search(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestCitationFormats(t *testing.T) {
+	studies := `{"studies":[` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001","briefTitle":"Stem Cells for  Spinal Cord Injury"},"statusModule":{"startDateStruct":{"date":"2019-03"}},"sponsorCollaboratorsModule":{"leadSponsor":{"name":"Acme & Co","class":"INDUSTRY"}}}},` +
+		`{"protocolSection":{"identificationModule":{"nctId":"NCT00000002","briefTitle":"Exoskeleton {Gait} Training"}}}` +
+		`],"totalCount":2}`
+	h := NewTrialsHandler(newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(studies))
+	}), cache.NewCache(time.Hour), false)
+	search := func(format string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?format="+format, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("format=%s: expected status 200, got %d: %s", format, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	t.Run("ris", func(t *testing.T) {
+		rec := search("ris")
+		if ct := rec.Header().Get("Content-Type"); ct != "application/x-research-info-systems" {
+			t.Errorf("Expected RIS content type, got %q", ct)
+		}
+		records := strings.Split(strings.TrimSuffix(rec.Body.String(), "\r\n\r\n"), "\r\n\r\n")
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 RIS records, got %d: %q", len(records), rec.Body.String())
+		}
+		want := [][]string{
+			{
+				"TY  - DBASE",
+				"TI  - Stem Cells for Spinal Cord Injury",
+				"DB  - ClinicalTrials.gov",
+				"AN  - NCT00000001",
+				"UR  - https://clinicaltrials.gov/study/NCT00000001",
+				"PY  - 2019",
+				"AU  - Acme & Co",
+				"ER  - ",
+			},
+			{
+				"TY  - DBASE",
+				"TI  - Exoskeleton {Gait} Training",
+				"DB  - ClinicalTrials.gov",
+				"AN  - NCT00000002",
+				"UR  - https://clinicaltrials.gov/study/NCT00000002",
+				"ER  - ",
+			},
+		}
+		for i, record := range records {
+			if got := strings.Split(record, "\r\n"); !reflect.DeepEqual(got, want[i]) {
+				t.Errorf("Record %d: expected %q, got %q", i+1, want[i], got)
+			}
+		}
+	})
+
+	t.Run("bibtex", func(t *testing.T) {
+		rec := search("bibtex")
+		if ct := rec.Header().Get("Content-Type"); ct != "application/x-bibtex" {
+			t.Errorf("Expected BibTeX content type, got %q", ct)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{
+			"@misc{NCT00000001,\n",
+			"  title = {{Stem Cells for  Spinal Cord Injury}},\n",
+			"  author = {{Acme \\& Co}},\n",
+			"  howpublished = {ClinicalTrials.gov},\n",
+			"  url = {https://clinicaltrials.gov/study/NCT00000001},\n",
+			"  year = {2019},\n",
+			"@misc{NCT00000002,\n",
+			"  title = {{Exoskeleton \\{Gait\\} Training}},\n",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected BibTeX output to contain %q, got:\n%s", want, body)
+			}
+		}
+		if strings.Count(body, "@misc{") != 2 {
+			t.Errorf("Expected 2 BibTeX entries, got:\n%s", body)
+		}
+	})
+}
+
+func TestReady(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		emptyStudies(w, r)
+	}))
+	defer server.Close()
+	apiClient := api.NewClinicalTrialsClient(
+		api.WithBaseURL(server.URL),
+		api.WithRateLimitDelay(0),
+		api.WithCircuitBreaker(1000, time.Minute),
+		api.WithErrorTracking(10, 0.5),
+	)
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false)
+	ready := func() (int, models.ReadinessResponse) {
+		rec := httptest.NewRecorder()
+		h.Ready(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		var readiness models.ReadinessResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil {
+			t.Fatalf("Failed to decode readiness: %v", err)
+		}
+		return rec.Code, readiness
+	}
+	calls := func(n int) {
+		for i := 0; i < n; i++ {
+			apiClient.SearchTrials(context.Background(), models.SearchRequest{})
+		}
+	}
+
+	if code, readiness := ready(); code != http.StatusOK || readiness.Status != "ready" {
+		t.Fatalf("Expected ready before any upstream call, got %d %+v", code, readiness)
+	}
+
+	healthy.Store(false)
+	calls(10)
+	code, readiness := ready()
+	if code != http.StatusServiceUnavailable || readiness.Status != "degraded" || readiness.UpstreamErrorRate != 1 || readiness.UpstreamSamples != 10 {
+		t.Fatalf("Expected degraded after injected failures, got %d %+v", code, readiness)
+	}
+	if readiness.UpstreamCircuit != string(api.BreakerClosed) {
+		t.Errorf("Expected the circuit to stay closed, got %s", readiness.UpstreamCircuit)
+	}
+
+	healthy.Store(true)
+	calls(10)
+	if code, readiness := ready(); code != http.StatusOK || readiness.Status != "ready" || readiness.UpstreamErrorRate != 0 {
+		t.Errorf("Expected ready after recovery, got %d %+v", code, readiness)
+	}
+}
+
+func TestExportCountsTotalOnce(t *testing.T) {
+	var countTotals []string
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		countTotals = append(countTotals, r.URL.Query().Get("countTotal"))
+		total := ""
+		if r.URL.Query().Get("countTotal") == "true" {
+			total = `,"totalCount":2`
+		}
+		if r.URL.Query().Get("pageToken") == "upstream-2" {
+			fmt.Fprintf(w, `{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"}}}]%s}`, total)
+			return
+		}
+		fmt.Fprintf(w, `{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"}}}]%s,"nextPageToken":"upstream-2"}`, total)
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+	search := func(query string) models.SearchResponse {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	first := search("conditions=paraplegia&export=true")
+	second := search("export_id=" + first.ExportID)
+	if !reflect.DeepEqual(countTotals, []string{"true", "false"}) {
+		t.Errorf("Expected only the first export page to request the total, got countTotal=%v", countTotals)
+	}
+	if first.UpstreamTotalCount != 2 || second.UpstreamTotalCount != 2 {
+		t.Errorf("Expected the total of 2 on both pages, got %d and %d", first.UpstreamTotalCount, second.UpstreamTotalCount)
+	}
+	if len(second.Trials) != 1 || second.Trials[0].NCTID != "NCT00000002" {
+		t.Errorf("Expected NCT00000002 on the second page, got %+v", second.Trials)
+	}
+}
+
+func TestSearchOmitsAllText(t *testing.T) {
+	study := `{"protocolSection":{
+		"identificationModule":{"nctId":"NCT00000001","briefTitle":"Structured"},
+		"statusModule":{"overallStatus":"RECRUITING"},
+		"descriptionModule":{"briefSummary":"Short","detailedDescription":"Very long description"},
+		"eligibilityModule":{"eligibilityCriteria":"Inclusion Criteria:\n* Adults\nExclusion Criteria:\n* Pregnancy"}
+	}}`
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[` + study + `],"totalCount":1}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	for _, query := range []string{"format=structured", "include_text=false", "include_text=false&include_detailed=true"} {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s: expected JSON, got %q", query, ct)
+		}
+		for _, field := range []string{"brief_summary", "detailed_summary", "criteria", "inclusion", "exclusion"} {
+			if strings.Contains(rec.Body.String(), `"`+field+`"`) {
+				t.Errorf("%s: expected %s omitted, got %s", query, field, rec.Body.String())
+			}
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Trials) != 1 {
+			t.Fatalf("%s: expected one trial, got %s", query, rec.Body.String())
+		}
+		if trial := resp.Trials[0]; trial.Title != "Structured" || trial.Status != "RECRUITING" {
+			t.Errorf("%s: expected structured fields kept, got %+v", query, trial)
+		}
+	}
+
+	// Omitting text is presentation only: the cached response still has it
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?include_detailed=true", nil))
+	if !strings.Contains(rec.Body.String(), "Very long description") || !strings.Contains(rec.Body.String(), `"brief_summary":"Short"`) {
+		t.Errorf("Expected free text with include_detailed=true, got %s", rec.Body.String())
+	}
+}
+
+func TestListCacheKeys(t *testing.T) {
+	trialCache := cache.NewCache(time.Hour)
+	h := NewTrialsHandler(api.NewClinicalTrialsClient(), trialCache, true)
+	list := func(query string) (*httptest.ResponseRecorder, models.CacheKeysResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ListCacheKeys(rec, httptest.NewRequest(http.MethodGet, "/api/v1/cache/keys"+query, nil))
+		var resp models.CacheKeysResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec, resp
+	}
+
+	if _, resp := list(""); len(resp.Keys) != 0 || resp.Total != 0 || resp.Truncated {
+		t.Errorf("Expected no keys before any Set, got %+v", resp)
+	}
+
+	trialCache.Set("trial:NCT00000002", "trial")
+	trialCache.Set("trial:NCT00000001", "trial")
+	trialCache.Set("search:conditions=paraplegia", "search")
+	rec, resp := list("")
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected Cache-Control no-store, got %q", rec.Header().Get("Cache-Control"))
+	}
+	var keys []string
+	for _, key := range resp.Keys {
+		keys = append(keys, key.Key)
+		if _, err := time.Parse(time.RFC3339, key.ExpiresAt); err != nil {
+			t.Errorf("Expected an RFC 3339 expiration for %s, got %q", key.Key, key.ExpiresAt)
+		}
+	}
+	expected := []string{"search:conditions=paraplegia", "trial:NCT00000001", "trial:NCT00000002"}
+	if !reflect.DeepEqual(keys, expected) || resp.Total != 3 || resp.Truncated {
+		t.Errorf("Expected keys %v, got %+v", expected, resp)
+	}
+
+	if _, resp := list("?limit=2"); len(resp.Keys) != 2 || resp.Total != 3 || !resp.Truncated {
+		t.Errorf("Expected 2 of 3 keys with limit=2, got %+v", resp)
+	}
+	for _, limit := range []string{"0", "abc", "10001"} {
+		if rec, _ := list("?limit=" + limit); rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: expected status 400, got %d", limit, rec.Code)
+		}
+	}
+}
+
+func TestDateRangeParams(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"studies":[
+			{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"statusModule":{"startDateStruct":{"date":"2023-06"},"completionDateStruct":{"date":"2025-12-31"}}}},
+			{"protocolSection":{"identificationModule":{"nctId":"NCT00000002"},"statusModule":{"startDateStruct":{"date":"2024-01-15"},"completionDateStruct":{"date":"2026-06"}}}},
+			{"protocolSection":{"identificationModule":{"nctId":"NCT00000003"},"statusModule":{"completionDateStruct":{"date":"2025-01"}}}}
+		]}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+	search := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?"+query, nil))
+		return rec
+	}
+
+	for query, expected := range map[string][]string{
+		"start_date_from=2023-06-01":                                    {"NCT00000001", "NCT00000002"},
+		"start_date_to=2023-06":                                         {"NCT00000001"},
+		"start_date_from=2023-06-02":                                    {"NCT00000002"},
+		"completion_date_to=2025-12-31":                                 {"NCT00000001", "NCT00000003"},
+		"completion_date_from=2025-01&completion_date_to=2025-12":       {"NCT00000003"},
+		"start_date_from=2023-01&completion_date_from=2026-01-01":       {"NCT00000002"},
+		"completion_date_from=2020-01-01&completion_date_to=2030-01-01": {"NCT00000001", "NCT00000002", "NCT00000003"},
+	} {
+		rec := search(query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var ids []string
+		for _, trial := range resp.Trials {
+			ids = append(ids, trial.NCTID)
+		}
+		if !reflect.DeepEqual(ids, expected) {
+			t.Errorf("%s: expected %v, got %v", query, expected, ids)
+		}
+	}
+
+	for _, query := range []string{
+		"start_date_from=2024",
+		"completion_date_to=31/12/2025",
+		"start_date_from=2024-06&start_date_to=2024-05-31",
+	} {
+		if rec := search(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestMaxPageSize(t *testing.T) {
+	var pageSizes []string
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		pageSizes = append(pageSizes, r.URL.Query().Get("pageSize"))
+		emptyStudies(w, r)
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithMaxPageSize(50))
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search"+query, nil))
+		return rec
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := get("?page_size=50"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 at the ceiling, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(`{"page_size":50}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 at the ceiling via POST, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for name, rec := range map[string]*httptest.ResponseRecorder{"GET": get("?page_size=51"), "POST": post(`{"page_size":1000}`)} {
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400 above the ceiling, got %d", name, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "next_page_token") {
+			t.Errorf("%s: expected the error to point to pagination, got %s", name, rec.Body.String())
+		}
+	}
+
+	// The default page size is lowered to the ceiling rather than rejected
+	if rec := get(""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 without page_size, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if expected := []string{"50", "50", "50"}; !reflect.DeepEqual(pageSizes, expected) {
+		t.Errorf("Expected upstream page sizes %v, got %v", expected, pageSizes)
+	}
+}
+
+func TestDistanceUnits(t *testing.T) {
+	var geoFilters []string
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		geoFilters = append(geoFilters, r.URL.Query().Get("filter.geo"))
+		w.Write([]byte(`{"studies":[{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},` +
+			`"contactsLocationsModule":{"locations":[{"city":"San Diego","geoPoint":{"lat":32.7157,"lon":-117.1611}}]}}}]}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+	nearestDistance := func(query string) float64 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?latitude=34.0522&longitude=-118.2437&nearest_only=true&"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp models.SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Trials) != 1 || len(resp.Trials[0].Locations) != 1 {
+			t.Fatalf("%s: expected one trial with its nearest site, got %s", query, rec.Body.String())
+		}
+		return resp.Trials[0].Locations[0].Distance
+	}
+
+	// Los Angeles to San Diego is about 112 miles, or 180 km
+	miles := nearestDistance("distance=100")
+	kilometers := nearestDistance("distance=100&units=km")
+	if math.Abs(miles-112) > 2 || math.Abs(kilometers-miles*1.609344) > 1e-6 {
+		t.Errorf("Expected ~112 mi and its km equivalent, got %f mi and %f km", miles, kilometers)
+	}
+	if again := nearestDistance("distance=100&units=mi"); again != miles {
+		t.Errorf("Expected units=mi to match the default, got %f (cached miles %f)", again, miles)
+	}
+	expected := []string{"distance(34.052200,-118.243700,100mi)", "distance(34.052200,-118.243700,63mi)"}
+	if !reflect.DeepEqual(geoFilters, expected) {
+		t.Errorf("Expected upstream geo filters %v, got %v", expected, geoFilters)
+	}
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?units=furlongs", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown units, got %d", rec.Code)
+	}
+}
+
+func TestIdempotentWatch(t *testing.T) {
+	var fetches atomic.Int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte(`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"statusModule":{"overallStatus":"RECRUITING"}}}`))
+	})
+	watcher := watch.NewWatcher(apiClient, watch.WithAllowPrivateWebhooks(true))
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithWatcher(watcher))
+	request := func(handler http.HandlerFunc, method, query, body, key string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(method, "/api/v1/watch/NCT00000001"+query, strings.NewReader(body)), map[string]string{"nct_id": "NCT00000001"})
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.Idempotent(handler)(rec, req)
+		return rec
+	}
+	body := `{"url":"https://example.com/hook"}`
+
+	first := request(h.WatchTrial, http.MethodPost, "", body, "subscribe-1")
+	replay := request(h.WatchTrial, http.MethodPost, "", body, "subscribe-1")
+	if first.Code != http.StatusCreated || replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected the replay to repeat the 201 response, got %d %s then %d %s", first.Code, first.Body.String(), replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get(IdempotentReplayedHeader) != "true" || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("Expected only the replay to be marked, got %q and %q", first.Header().Get(IdempotentReplayedHeader), replay.Header().Get(IdempotentReplayedHeader))
+	}
+	if replay.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("Expected replayed headers, got %v", replay.Header())
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("Expected the replay not to run the request again, got %d upstream fetches", n)
+	}
+
+	// The same key for a different request is rejected
+	if rec := request(h.WatchTrial, http.MethodPost, "", `{"url":"https://example.com/other"}`, "subscribe-1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a reused key, got %d", rec.Code)
+	}
+
+	// A retried unsubscribe replays its 204 instead of a 404
+	for i := 0; i < 2; i++ {
+		if rec := request(h.UnwatchTrial, http.MethodDelete, "?url=https://example.com/hook", "", "unsubscribe-1"); rec.Code != http.StatusNoContent {
+			t.Errorf("DELETE attempt %d: expected status 204, got %d", i+1, rec.Code)
+		}
+	}
+	if rec := request(h.UnwatchTrial, http.MethodDelete, "?url=https://example.com/hook", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a request without a key to run again, got %d", rec.Code)
+	}
+
+	// Server errors are not stored, and a request still in progress gets a 409
+	calls := 0
+	var inner *httptest.ResponseRecorder
+	flaky := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		inner = request(func(w http.ResponseWriter, r *http.Request) { t.Error("Expected a concurrent duplicate not to run") }, http.MethodPost, "", "", "flaky-1")
+		w.WriteHeader(http.StatusAccepted)
+	}
+	if rec := request(flaky, http.MethodPost, "", "", "flaky-1"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500 on the first attempt, got %d", rec.Code)
+	}
+	if rec := request(flaky, http.MethodPost, "", "", "flaky-1"); rec.Code != http.StatusAccepted || calls != 2 {
+		t.Errorf("Expected the retry after a 500 to run again, got %d after %d calls", rec.Code, calls)
+	}
+	if inner == nil || inner.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate while in progress, got %v", inner)
+	}
+}
+
+func TestNormalizedConditions(t *testing.T) {
+	var queries []string
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query.cond"))
+		emptyStudies(w, r)
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), true)
+
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=Diabetes,+diabetes+,,heart%20%20failure", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=+diabetes&conditions=HEART+failure,diabetes", nil))
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected equivalent conditions to share a cache entry, got X-Cache %q", rec.Header().Get("X-Cache"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(`{"conditions":["  asthma","ASTHMA",""," copd "]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if expected := []string{"Diabetes OR heart failure", "asthma OR copd"}; !reflect.DeepEqual(queries, expected) {
+		t.Errorf("Expected normalized upstream queries %q, got %q", expected, queries)
+	}
+}
+
+func TestMaxQueryLength(t *testing.T) {
+	calls := 0
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		emptyStudies(w, r)
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithMaxQueryLength(40))
+	if NewTrialsHandler(nil, nil, false).maxQueryLength != DefaultMaxQueryLength {
+		t.Errorf("Expected the default limit of %d", DefaultMaxQueryLength)
+	}
+
+	// "spinal cord injury OR tetraplegia" encodes to 33 characters
+	rec := httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=spinal+cord+injury,tetraplegia", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a query under the limit to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.SearchTrials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?conditions=spinal+cord+injury,tetraplegia,paraplegia", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "fewer conditions") {
+		t.Errorf("Expected status 400 advising fewer conditions, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.SearchTrialsPost(rec, httptest.NewRequest(http.MethodPost, "/api/v1/trials/search", strings.NewReader(`{"query":"spinal cord injury with chronic neuropathic pain"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a long free-text query to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("Expected rejected searches not to reach the upstream, got %d calls", calls)
+	}
+}
+
+func TestWatchLimits(t *testing.T) {
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"statusModule":{"overallStatus":"RECRUITING"}}}`))
+	})
+	watcher := watch.NewWatcher(apiClient, watch.WithAllowPrivateWebhooks(true), watch.WithLimits(1, 1))
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithWatcher(watcher))
+	subscribe := func(id, hook string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/v1/watch/"+id, strings.NewReader(`{"url":"`+hook+`"}`)), map[string]string{"nct_id": id})
+		rec := httptest.NewRecorder()
+		h.WatchTrial(rec, req)
+		return rec
+	}
+
+	if rec := subscribe("NCT00000001", "https://a.example/hook"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, tt := range []struct{ id, hook string }{
+		{"NCT00000001", "https://b.example/hook"},
+		{"NCT00000002", "https://a.example/hook"},
+	} {
+		if rec := subscribe(tt.id, tt.hook); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%s %s: expected status 429, got %d", tt.id, tt.hook, rec.Code)
+		}
+	}
+}
+
+func TestWatchRejectsPrivateWebhooks(t *testing.T) {
+	var fetches atomic.Int32
+	apiClient := newMockUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte(`{"protocolSection":{"identificationModule":{"nctId":"NCT00000001"},"statusModule":{"overallStatus":"RECRUITING"}}}`))
+	})
+	h := NewTrialsHandler(apiClient, cache.NewCache(time.Hour), false, WithWatcher(watch.NewWatcher(apiClient)))
+
+	for _, hook := range []string{"http://169.254.169.254/latest/meta-data", "http://127.0.0.1:6379/", "https://10.1.2.3/hook"} {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/v1/watch/NCT00000001", strings.NewReader(`{"url":"`+hook+`"}`)), map[string]string{"nct_id": "NCT00000001"})
+		rec := httptest.NewRecorder()
+		h.WatchTrial(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", hook, rec.Code)
+		}
+	}
+	if n := fetches.Load(); n != 0 {
+		t.Errorf("Expected rejected webhooks not to fetch the trial, got %d fetches", n)
+	}
+}
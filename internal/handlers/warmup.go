@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/clinical-trials-microservice/internal/api"
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// DefaultWarmupRequests is primed when warm-up is enabled without a query file:
+// the first page of the default SCI recruiting search
+var DefaultWarmupRequests = []models.SearchRequest{{}}
+
+// LoadWarmupRequests reads the searches to prime from a JSON file holding an array of
+// search requests, in the same format as the POST /api/v1/trials/search body
+func LoadWarmupRequests(path string) ([]models.SearchRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read warm-up file: %w", err)
+	}
+	var requests []models.SearchRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return nil, fmt.Errorf("failed to parse warm-up file: %w", err)
+	}
+	return requests, nil
+}
+
+// WarmCache runs each search against its registry and stores the results under the same
+// cache key a matching GET request would use. Searches run one at a time through the
+// regular client, so the upstream rate limiter and concurrency cap still apply.
+// It is meant to run in a background goroutine at startup and stops early when ctx is done.
+func (h *TrialsHandler) WarmCache(ctx context.Context, requests []models.SearchRequest) {
+	if !h.cacheEnabled {
+		return
+	}
+
+	logger := getLogger(ctx)
+	logger.Info().Int("queries", len(requests)).Msg("Cache warm-up started")
+
+	warmed := 0
+	for _, req := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+		if req.PageSize <= 0 {
+			req.PageSize = h.defaultPageSize()
+		}
+		req.Conditions = api.NormalizeConditions(req.Conditions)
+		if err := h.validateSearchRequest(req); err != nil {
+			logger.Warn().Err(err).Msg("Skipping invalid warm-up query")
+			continue
+		}
+		registry, ok := h.registryFor(req.Registry)
+		if !ok {
+			logger.Warn().Str("registry", req.Registry).Msg("Skipping warm-up query for unknown registry")
+			continue
+		}
+
+		response, err := registry.Search(ctx, req)
+		if err != nil {
+			logger.Warn().Err(err).Strs("conditions", req.Conditions).Msg("Cache warm-up query failed")
+			continue
+		}
+		applySort(req, response)
+		if response.Partial {
+			logger.Warn().Strs("conditions", req.Conditions).Msg("Cache warm-up query returned a partial page, not caching it")
+			continue
+		}
+
+		cacheKey := h.generateCacheKey("search", req)
+		h.cache.Set(cacheKey, response)
+		h.seedTrialCache(req, response)
+		warmed++
+		logger.Debug().Str("cache_key", cacheKey).Int("total_count", response.TotalCount).Msg("Cache warm-up query stored")
+	}
+
+	logger.Info().
+		Int("queries", len(requests)).
+		Int("warmed", warmed).
+		Msg("Cache warm-up finished")
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/watch"
+	"github.com/gorilla/mux"
+)
+
+// WithWatcher enables the /api/v1/watch endpoints, registering webhooks with watcher
+func WithWatcher(watcher *watch.Watcher) Option {
+	return func(h *TrialsHandler) {
+		h.watcher = watcher
+	}
+}
+
+// watchRequest is the body of POST /api/v1/watch/{nct_id}
+type watchRequest struct {
+	URL string `json:"url"`
+}
+
+// watchTarget returns the upper-cased NCT ID of a watch request, writing an error and
+// returning false when watching is disabled or the ID is malformed
+func (h *TrialsHandler) watchTarget(w http.ResponseWriter, r *http.Request) (string, bool) {
+	nctID := strings.ToUpper(mux.Vars(r)["nct_id"])
+	if h.watcher == nil {
+		h.writeError(w, r, http.StatusServiceUnavailable, "Trial watching is disabled")
+		return "", false
+	}
+	if !nctIDPattern.MatchString(nctID) {
+		logger := getLogger(r.Context())
+		logger.Warn().Str("nct_id", nctID).Msg("Invalid NCT ID for watch")
+		h.writeError(w, r, http.StatusBadRequest, "Invalid NCT ID "+nctID+": must look like NCT01234567")
+		return "", false
+	}
+	return nctID, true
+}
+
+// WatchTrial handles POST /api/v1/watch/{nct_id}.
+// It registers the webhook URL in the body ({"url": "https://..."}) to receive a POST with a
+// models.StatusChangeNotification whenever the trial's status changes. The trial is fetched
+// once to check it exists and record the status later polls compare against.
+func (h *TrialsHandler) WatchTrial(w http.ResponseWriter, r *http.Request) {
+	nctID, ok := h.watchTarget(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	logger := getLogger(ctx)
+
+	var req watchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn().Err(err).Msg("Invalid watch request body")
+		h.writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	webhook, err := url.Parse(req.URL)
+	if err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+		logger.Warn().Str("url", req.URL).Msg("Invalid webhook URL")
+		h.writeError(w, r, http.StatusBadRequest, "url must be an absolute http or https URL")
+		return
+	}
+	if err := h.watcher.CheckURL(ctx, webhook); err != nil {
+		logger.Warn().Err(err).Str("url", req.URL).Msg("Rejected webhook URL")
+		h.writeError(w, r, http.StatusBadRequest, "url rejected: "+err.Error())
+		return
+	}
+
+	trial, err := h.apiClient.GetTrialDetails(ctx, nctID)
+	if err != nil {
+		logger.Error().Err(err).Str("nct_id", nctID).Msg("Error getting watched trial")
+		if status := upstreamErrorStatus(err, http.StatusNotFound); status != http.StatusNotFound {
+			h.writeError(w, r, status, "Failed to get trial: "+err.Error())
+			return
+		}
+		h.writeError(w, r, http.StatusNotFound, "Trial not found: "+err.Error())
+		return
+	}
+
+	subscription, err := h.watcher.Subscribe(nctID, webhook.String(), trial.Status)
+	if err != nil {
+		logger.Warn().Err(err).Str("nct_id", nctID).Msg("Watch limit reached")
+		h.writeError(w, r, http.StatusTooManyRequests, "Cannot watch "+nctID+": "+err.Error())
+		return
+	}
+	logger.Info().
+		Str("nct_id", nctID).
+		Str("webhook_url", subscription.URL).
+		Str("status", subscription.Status).
+		Msg("Trial watch registered")
+	h.writeJSON(w, r, http.StatusCreated, subscription)
+}
+
+// UnwatchTrial handles DELETE /api/v1/watch/{nct_id}?url=.
+// It removes the webhook given by url, or every webhook of the trial when url is omitted,
+// answering 204, or 404 when nothing was registered.
+func (h *TrialsHandler) UnwatchTrial(w http.ResponseWriter, r *http.Request) {
+	nctID, ok := h.watchTarget(w, r)
+	if !ok {
+		return
+	}
+	logger := getLogger(r.Context())
+
+	webhook := r.URL.Query().Get("url")
+	removed := h.watcher.Unsubscribe(nctID, webhook)
+	if removed == 0 {
+		h.writeError(w, r, http.StatusNotFound, "No watch registered for "+nctID)
+		return
+	}
+	logger.Info().
+		Str("nct_id", nctID).
+		Str("webhook_url", webhook).
+		Int("removed", removed).
+		Msg("Trial watch removed")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+// Package logging layers per-component log level overrides on the global zerolog logger.
+package logging
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Components whose level can be overridden with LOG_LEVEL_<COMPONENT>
+const (
+	ComponentAPI        = "api"
+	ComponentCache      = "cache"
+	ComponentHandlers   = "handlers"
+	ComponentMiddleware = "middleware"
+	ComponentWatch      = "watch"
+)
+
+// components lists every overridable component, for validation and error messages
+var components = []string{ComponentAPI, ComponentCache, ComponentHandlers, ComponentMiddleware, ComponentWatch}
+
+// EnvPrefix starts the environment variables holding component level overrides, e.g. LOG_LEVEL_API=debug
+const EnvPrefix = "LOG_LEVEL_"
+
+// levels holds the component level overrides; nil means none
+var levels atomic.Pointer[map[string]zerolog.Level]
+
+// SetLevels replaces the component level overrides. The global zerolog level must be at or
+// below every override for the more verbose components to log.
+func SetLevels(overrides map[string]zerolog.Level) {
+	levels.Store(&overrides)
+}
+
+// Logger returns the logger of a component: the global logger tagged with the component
+// name, at the component's override level when one is set. It reads the global logger on
+// every call, so loggers obtained after startup reflect the final output configuration.
+func Logger(component string) zerolog.Logger {
+	logger := log.Logger
+	if overrides := levels.Load(); overrides != nil {
+		if level, ok := (*overrides)[component]; ok {
+			logger = logger.Level(level)
+		}
+	}
+	return logger.With().Str("component", component).Logger()
+}
+
+// LevelsFromEnv parses the LOG_LEVEL_<COMPONENT> entries of environ (as returned by
+// os.Environ) into component overrides. Entries with an unknown component or level are
+// reported in the error and skipped.
+func LevelsFromEnv(environ []string) (map[string]zerolog.Level, error) {
+	overrides := make(map[string]zerolog.Level)
+	var invalid []string
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		name, ok := strings.CutPrefix(key, EnvPrefix)
+		if !ok {
+			continue
+		}
+		component := strings.ToLower(name)
+		level, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(value)))
+		if !knownComponent(component) || err != nil || value == "" {
+			invalid = append(invalid, entry)
+			continue
+		}
+		overrides[component] = level
+	}
+	if len(invalid) > 0 {
+		last := len(components) - 1
+		return overrides, fmt.Errorf("ignoring invalid component log levels %v: components are %s and %s",
+			invalid, strings.Join(components[:last], ", "), components[last])
+	}
+	return overrides, nil
+}
+
+// knownComponent reports whether component is one of the overridable components
+func knownComponent(component string) bool {
+	return slices.Contains(components, component)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestComponentLevelOverride(t *testing.T) {
+	var buf bytes.Buffer
+	originalLogger, originalLevel := log.Logger, zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		log.Logger = originalLogger
+		zerolog.SetGlobalLevel(originalLevel)
+		SetLevels(nil)
+	})
+
+	// Global level low enough for the override; default logger at info
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	log.Logger = zerolog.New(&buf).Level(zerolog.InfoLevel)
+	SetLevels(map[string]zerolog.Level{ComponentAPI: zerolog.DebugLevel, ComponentCache: zerolog.WarnLevel})
+
+	apiLogger := Logger(ComponentAPI)
+	apiLogger.Debug().Msg("api debug")
+	handlersLogger := Logger(ComponentHandlers)
+	handlersLogger.Debug().Msg("handlers debug")
+	handlersLogger.Info().Msg("handlers info")
+	cacheLogger := Logger(ComponentCache)
+	cacheLogger.Info().Msg("cache info")
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		messages = append(messages, entry["component"].(string)+": "+entry["message"].(string))
+	}
+	want := []string{"api: api debug", "handlers: handlers info"}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %v, got %v", want, messages)
+	}
+}
+
+func TestLevelsFromEnv(t *testing.T) {
+	levels, err := LevelsFromEnv([]string{
+		"LOG_LEVEL=info",
+		"LOG_LEVEL_API=DEBUG",
+		"LOG_LEVEL_MIDDLEWARE=warn",
+		"LOG_LEVEL_CACHE=loud",
+		"LOG_LEVEL_UNKNOWN=debug",
+		"PATH=/usr/bin",
+	})
+	if len(levels) != 2 || levels[ComponentAPI] != zerolog.DebugLevel || levels[ComponentMiddleware] != zerolog.WarnLevel {
+		t.Errorf("Unexpected levels %v", levels)
+	}
+	if err == nil || !strings.Contains(err.Error(), "LOG_LEVEL_CACHE=loud") || !strings.Contains(err.Error(), "LOG_LEVEL_UNKNOWN=debug") {
+		t.Errorf("Expected the invalid entries reported, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "components are api, cache, handlers, middleware and watch") {
+		t.Errorf("Expected every component listed, got %v", err)
+	}
+
+	if _, err := LevelsFromEnv([]string{"LOG_LEVEL=debug"}); err != nil {
+		t.Errorf("Expected no error without overrides, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/clinical-trials-microservice/internal/logging"
+)
+
+// AdminAuthMiddleware only lets requests through that send token as an
+// "Authorization: Bearer <token>" header; others get a 401. An empty token rejects every request.
+func AdminAuthMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				logger := logging.Logger(logging.ComponentMiddleware)
+				logger.Warn().
+					Str("request_id", RequestIDFromContext(r.Context())).
+					Str("client_ip", getClientIP(r)).
+					Str("path", r.URL.Path).
+					Msg("Admin request rejected")
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "admin token required"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// trustedProxies holds the prefixes of proxies whose forwarded headers are honored
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// SetTrustedProxies configures the proxies (CIDRs or single IPs) allowed to report the client
+// address via X-Forwarded-For or X-Real-IP. Requests from anywhere else are identified by
+// their connection address, so clients cannot spoof their IP. No proxy is trusted by default.
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	trustedProxies.Store(&prefixes)
+	return nil
+}
+
+// isTrustedProxy reports whether addr belongs to a configured trusted proxy
+func isTrustedProxy(addr netip.Addr) bool {
+	prefixes := trustedProxies.Load()
+	if prefixes == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range *prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientIP extracts the client IP address from the request. Forwarded headers are only
+// honored when the connection comes from a trusted proxy; X-Forwarded-For is then walked
+// right to left, skipping trusted hops, and the first untrusted address is the client.
+func getClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	remoteAddr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(remoteAddr) {
+		return remote
+	}
+
+	// Multiple X-Forwarded-For headers form a single list in order
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // Garbage can only come from beyond the last valid hop; stop there
+		}
+		client = hop.Unmap().String()
+		if !isTrustedProxy(hop) {
+			return client
+		}
+	}
+	if len(hops) > 0 {
+		return client // Every hop is trusted; the leftmost is the best guess
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return remote
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+	t.Cleanup(func() { trustedProxies.Store(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:51234", nil, "", "203.0.113.7"},
+		{"direct client spoofing X-Forwarded-For", "203.0.113.7:51234", []string{"1.2.3.4"}, "", "203.0.113.7"},
+		{"direct client spoofing X-Real-IP", "203.0.113.7:51234", nil, "1.2.3.4", "203.0.113.7"},
+		{"behind trusted proxy", "10.1.2.3:443", []string{"198.51.100.20"}, "", "198.51.100.20"},
+		{"spoofed hop before trusted proxy", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.20"}, "", "198.51.100.20"},
+		{"chain of trusted proxies", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.20, 192.0.2.1, 10.9.9.9"}, "", "198.51.100.20"},
+		{"multiple headers", "10.1.2.3:443", []string{"1.2.3.4", "198.51.100.20, 10.9.9.9"}, "", "198.51.100.20"},
+		{"all hops trusted", "10.1.2.3:443", []string{"10.5.5.5, 192.0.2.1"}, "", "10.5.5.5"},
+		{"garbage hop", "10.1.2.3:443", []string{"not-an-ip"}, "", "10.1.2.3"},
+		{"X-Real-IP from trusted proxy", "192.0.2.1:443", nil, "198.51.100.20", "198.51.100.20"},
+		{"IPv6 behind trusted proxy", "[2001:db8::1]:443", []string{"2001:db8:ffff::1, 2606:4700::1111"}, "", "2606:4700::1111"},
+		{"IPv4-mapped proxy address", "[::ffff:10.1.2.3]:443", []string{"198.51.100.20"}, "", "198.51.100.20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := getClientIP(req); got != tt.want {
+				t.Errorf("Expected client IP %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetClientIPWithoutTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.20")
+	if got := getClientIP(req); got != "10.1.2.3" {
+		t.Errorf("Expected forwarded headers to be ignored by default, got %q", got)
+	}
+}
+
+func TestSetTrustedProxiesRejectsInvalid(t *testing.T) {
+	t.Cleanup(func() { trustedProxies.Store(nil) })
+	for _, proxy := range []string{"10.0.0.0/33", "not-a-proxy"} {
+		if err := SetTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("Expected %q to be rejected", proxy)
+		}
+	}
+}
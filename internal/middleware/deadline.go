@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/logging"
+)
+
+const (
+	// DeadlineHeader carries the caller's deadline as an RFC 3339 timestamp
+	DeadlineHeader = "X-Request-Deadline"
+	// GRPCTimeoutHeader carries the caller's remaining budget in the gRPC format, e.g. 500m or 2S
+	GRPCTimeoutHeader = "Grpc-Timeout"
+)
+
+// grpcTimeoutUnits maps grpc-timeout unit suffixes to durations
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// DeadlineMiddleware bounds the request context by the deadline a caller sends in
+// X-Request-Deadline or grpc-timeout, so upstream calls made for the request stop when the
+// caller stops waiting. When both are sent the earlier deadline applies. Requests whose
+// deadline already passed get a 504 without being handled; malformed headers are ignored.
+func DeadlineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		deadline, ok, err := requestDeadline(r, now)
+		if err != nil {
+			logger := logging.Logger(logging.ComponentMiddleware)
+			logger.Warn().
+				Err(err).
+				Str("request_id", RequestIDFromContext(r.Context())).
+				Msg("Ignoring malformed request deadline")
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !deadline.After(now) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Request deadline already passed"})
+			return
+		}
+
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestDeadline returns the earliest valid deadline sent with r, and whether there is one.
+// The error reports a header that could not be parsed.
+func requestDeadline(r *http.Request, now time.Time) (time.Time, bool, error) {
+	var deadline time.Time
+	var errs []error
+	if value := r.Header.Get(DeadlineHeader); value != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %q: must be an RFC 3339 timestamp", DeadlineHeader, value))
+		} else {
+			deadline = parsed
+		}
+	}
+	if value := r.Header.Get(GRPCTimeoutHeader); value != "" {
+		timeout, err := parseGRPCTimeout(value)
+		if err != nil {
+			errs = append(errs, err)
+		} else if candidate := now.Add(timeout); deadline.IsZero() || candidate.Before(deadline) {
+			deadline = candidate
+		}
+	}
+
+	var err error
+	if len(errs) > 0 {
+		err = errs[0]
+	}
+	return deadline, !deadline.IsZero(), err
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: up to 8 digits followed by a unit
+// (H, M, S, m, u or n)
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("%s %q: must be up to 8 digits and a unit", GRPCTimeoutHeader, value)
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	n, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("%s %q: must be up to 8 digits and a unit (H, M, S, m, u, n)", GRPCTimeoutHeader, value)
+	}
+	return time.Duration(n) * unit, nil
+}
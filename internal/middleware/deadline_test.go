@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeadlineMiddleware(t *testing.T) {
+	var called bool
+	var deadline time.Time
+	var hasDeadline bool
+	handler := DeadlineMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		deadline, hasDeadline = r.Context().Deadline()
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(headers map[string]string) *httptest.ResponseRecorder {
+		called, hasDeadline = false, false
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("near-future deadline", func(t *testing.T) {
+		want := time.Now().Add(2 * time.Second).UTC()
+		rec := request(map[string]string{DeadlineHeader: want.Format(time.RFC3339Nano)})
+		if rec.Code != http.StatusOK || !called {
+			t.Fatalf("Expected the request to be handled, got status %d", rec.Code)
+		}
+		if !hasDeadline || !deadline.Equal(want) {
+			t.Errorf("Expected context deadline %v, got %v (set: %v)", want, deadline, hasDeadline)
+		}
+	})
+
+	t.Run("expired deadline", func(t *testing.T) {
+		rec := request(map[string]string{DeadlineHeader: time.Now().Add(-time.Second).UTC().Format(time.RFC3339)})
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("Expected status 504, got %d", rec.Code)
+		}
+		if called {
+			t.Error("Expected the handler not to run once the deadline passed")
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected JSON error body, got Content-Type %q", ct)
+		}
+	})
+
+	t.Run("grpc-timeout", func(t *testing.T) {
+		before := time.Now()
+		rec := request(map[string]string{"grpc-timeout": "500m"})
+		if rec.Code != http.StatusOK || !hasDeadline {
+			t.Fatalf("Expected a deadline from grpc-timeout, got status %d (set: %v)", rec.Code, hasDeadline)
+		}
+		if remaining := deadline.Sub(before); remaining <= 0 || remaining > 500*time.Millisecond+time.Second {
+			t.Errorf("Expected a deadline about 500ms out, got %v", remaining)
+		}
+	})
+
+	t.Run("earliest header wins", func(t *testing.T) {
+		rec := request(map[string]string{
+			DeadlineHeader:    time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			GRPCTimeoutHeader: "1S",
+		})
+		if rec.Code != http.StatusOK || !hasDeadline || time.Until(deadline) > time.Minute {
+			t.Errorf("Expected the grpc-timeout deadline to win, got %v", deadline)
+		}
+	})
+
+	t.Run("no or malformed header", func(t *testing.T) {
+		for _, headers := range []map[string]string{
+			nil,
+			{DeadlineHeader: "tomorrow"},
+			{GRPCTimeoutHeader: "5x"},
+			{GRPCTimeoutHeader: "123456789S"},
+		} {
+			rec := request(headers)
+			if rec.Code != http.StatusOK || !called {
+				t.Errorf("%v: expected the request to be handled, got status %d", headers, rec.Code)
+			}
+			if hasDeadline {
+				t.Errorf("%v: expected no context deadline", headers)
+			}
+		}
+	})
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1H":        time.Hour,
+		"2M":        2 * time.Minute,
+		"30S":       30 * time.Second,
+		"250m":      250 * time.Millisecond,
+		"100u":      100 * time.Microsecond,
+		"99999999n": 99999999 * time.Nanosecond,
+	}
+	for value, want := range tests {
+		got, err := parseGRPCTimeout(value)
+		if err != nil || got != want {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "S", "10", "-1S", "1.5S", "123456789m"} {
+		if _, err := parseGRPCTimeout(value); err == nil {
+			t.Errorf("parseGRPCTimeout(%q): expected an error", value)
+		}
+	}
+}
@@ -3,36 +3,92 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/clinical-trials-microservice/internal/logging"
 )
 
-// responseWriter wraps http.ResponseWriter to capture status code and body size
+// DefaultErrorBodyLogBytes is how much of a 4xx/5xx response body is logged by default
+const DefaultErrorBodyLogBytes = 1024
+
+// ServerTimingHeader reports how long the service took to produce a response
+const ServerTimingHeader = "Server-Timing"
+
+// errorBodyLogBytes bounds the error response body included in request logs
+var errorBodyLogBytes atomic.Int64
+
+// serverTimingDisabled turns off the Server-Timing header, which is sent by default
+var serverTimingDisabled atomic.Bool
+
+func init() {
+	errorBodyLogBytes.Store(DefaultErrorBodyLogBytes)
+}
+
+// SetServerTiming sets whether responses carry a Server-Timing header with the processing time
+func SetServerTiming(enabled bool) {
+	serverTimingDisabled.Store(!enabled)
+}
+
+// SetErrorBodyLogBytes sets how many bytes of a 4xx/5xx response body are included in the
+// request log. 0 or less stops logging error bodies.
+func SetErrorBodyLogBytes(n int) {
+	errorBodyLogBytes.Store(int64(max(n, 0)))
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code and body size.
+// For error statuses the start of the body is kept in body, up to bodyLimit bytes;
+// successful responses are never buffered, so the buffer is only allocated for errors.
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	bodySize   int
-	body       *bytes.Buffer
+	body       bytes.Buffer
+	bodyLimit  int
+	// start is when the request was received; when set, a Server-Timing header measures from it
+	start       time.Time
+	wroteHeader bool
 }
 
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
 	return &responseWriter{
 		ResponseWriter: w,
 		statusCode:     http.StatusOK,
-		body:           &bytes.Buffer{},
+		bodyLimit:      int(errorBodyLogBytes.Load()),
 	}
 }
 
+// setServerTiming adds the time spent so far as a Server-Timing header. Headers cannot change
+// once written, so it runs just before that; handlers write their body in one go, so by then
+// the work is done and only the transfer of the body is left out.
+func (rw *responseWriter) setServerTiming() {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	if serverTimingDisabled.Load() || rw.start.IsZero() {
+		return
+	}
+	elapsed := float64(time.Since(rw.start).Microseconds()) / 1000
+	rw.Header().Set(ServerTimingHeader, "app;dur="+strconv.FormatFloat(elapsed, 'f', 3, 64))
+}
+
 func (rw *responseWriter) WriteHeader(code int) {
+	rw.setServerTiming()
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.setServerTiming()
 	written, err := rw.ResponseWriter.Write(b)
+	if rw.statusCode >= 400 && rw.body.Len() < rw.bodyLimit {
+		rw.body.Write(b[:min(written, rw.bodyLimit-rw.body.Len())])
+	}
 	rw.bodySize += written
 	return written, err
 }
@@ -40,71 +96,118 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 // RequestIDKey is the key used to store request ID in context
 type RequestIDKey struct{}
 
-// generateRequestID generates a unique request ID
-func generateRequestID() string {
-	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), time.Now().Unix())
+// RequestIDFromContext returns the request ID stored in the context, or "" when there is none
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(RequestIDKey{}).(string)
+	return requestID
 }
 
-// LoggingMiddleware logs HTTP requests and responses
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// Skip logging for health check endpoint
-		if r.URL.Path == "/health" {
-			next.ServeHTTP(w, r)
-			return
-		}
+// requestStartKey is the key used to store the time a request was received in context
+type requestStartKey struct{}
 
-		// Generate request ID
-		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" {
-			requestID = generateRequestID()
-		}
+// RequestStartFromContext returns when the logging middleware received the request,
+// or the zero time when the request did not pass through it
+func RequestStartFromContext(ctx context.Context) time.Time {
+	start, _ := ctx.Value(requestStartKey{}).(time.Time)
+	return start
+}
 
-		// Add request ID to response headers
-		w.Header().Set("X-Request-ID", requestID)
+// generateRequestID generates a unique request ID as a random (version 4) UUID
+func generateRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand should never fail; fall back to a timestamp so requests still get an ID
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
 
-		// Add request ID to context for downstream handlers
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, RequestIDKey{}, requestID)
-		r = r.WithContext(ctx)
+// LoggingMiddleware logs HTTP requests and responses
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return SampledLoggingMiddleware(1)(next)
+}
 
-		// Create logger with request context
-		logger := log.With().
-			Str("request_id", requestID).
-			Str("method", r.Method).
-			Str("path", r.URL.Path).
-			Str("query", r.URL.RawQuery).
-			Str("ip", getClientIP(r)).
-			Str("user_agent", r.UserAgent()).
-			Logger()
-
-		// Wrap response writer to capture status and size
-		rw := newResponseWriter(w)
-
-		// Process request
-		next.ServeHTTP(rw, r)
-
-		// Calculate duration
-		duration := time.Since(start)
-
-		// Log request
-		event := logger.Info().
-			Int("status", rw.statusCode).
-			Int64("duration_ms", duration.Milliseconds()).
-			Int("body_size", rw.bodySize)
-
-		// Add error context for 4xx and 5xx responses
-		if rw.statusCode >= 400 {
-			event = logger.Error().
+// SampledLoggingMiddleware logs HTTP requests like LoggingMiddleware, but only logs
+// 1 in every sampleRate successful (< 400) responses. Error responses are always logged.
+// A sampleRate of 1 or less logs every request.
+func SampledLoggingMiddleware(sampleRate uint64) func(http.Handler) http.Handler {
+	var successCount uint64
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			// Skip logging for health check endpoint
+			if r.URL.Path == "/health" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Generate request ID
+			requestID := r.Header.Get("X-Request-ID")
+			if requestID == "" {
+				requestID = generateRequestID()
+			}
+
+			// Add request ID to response headers
+			w.Header().Set("X-Request-ID", requestID)
+
+			// Add request ID to context for downstream handlers
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, RequestIDKey{}, requestID)
+			ctx = context.WithValue(ctx, requestStartKey{}, start)
+			r = r.WithContext(ctx)
+
+			// Create logger with request context
+			logger := logging.Logger(logging.ComponentMiddleware).With().
+				Str("request_id", requestID).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("query", r.URL.RawQuery).
+				Str("ip", getClientIP(r)).
+				Str("user_agent", r.UserAgent()).
+				Logger()
+
+			// Wrap response writer to capture status and size
+			rw := newResponseWriter(w)
+			rw.start = start
+
+			// Process request
+			next.ServeHTTP(rw, r)
+			rw.setServerTiming() // For handlers that wrote nothing, before the server sends the headers
+
+			// Calculate duration
+			duration := time.Since(start)
+
+			// Thin out successful requests; errors are never sampled out
+			if sampleRate > 1 && rw.statusCode < 400 {
+				if (atomic.AddUint64(&successCount, 1)-1)%sampleRate != 0 {
+					return
+				}
+			}
+
+			// Log request
+			event := logger.Info().
 				Int("status", rw.statusCode).
 				Int64("duration_ms", duration.Milliseconds()).
 				Int("body_size", rw.bodySize)
-		}
 
-		event.Msg("Request completed")
-	})
+			// Add error context for 4xx and 5xx responses, including the error message sent
+			if rw.statusCode >= 400 {
+				event = logger.Error().
+					Int("status", rw.statusCode).
+					Int64("duration_ms", duration.Milliseconds()).
+					Int("body_size", rw.bodySize)
+				if rw.body.Len() > 0 {
+					event = event.Str("response_body", rw.body.String()).
+						Bool("response_body_truncated", rw.body.Len() < rw.bodySize)
+				}
+			}
+
+			event.Msg("Request completed")
+		})
+	}
 }
 
 // RequestIDMiddleware adds request ID to context and response headers
@@ -126,21 +229,3 @@ func RequestIDMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for proxies/load balancers)
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		return xff
-	}
-
-	// Check X-Real-IP header
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
-	}
-
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
-}
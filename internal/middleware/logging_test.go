@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestGenerateRequestIDUnique(t *testing.T) {
+	const workers = 50
+	const perWorker = 200
+
+	var mu sync.Mutex
+	seen := make(map[string]struct{}, workers*perWorker)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]string, 0, perWorker)
+			for j := 0; j < perWorker; j++ {
+				ids = append(ids, generateRequestID())
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				if !uuidPattern.MatchString(id) {
+					t.Errorf("Request ID %q is not a v4 UUID", id)
+				}
+				if _, dup := seen[id]; dup {
+					t.Errorf("Duplicate request ID generated: %s", id)
+				}
+				seen[id] = struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != workers*perWorker {
+		t.Errorf("Expected %d unique IDs, got %d", workers*perWorker, len(seen))
+	}
+}
+
+func TestLoggingMiddlewareRequestID(t *testing.T) {
+	var ctxID string
+	var start time.Time
+	handler := LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID, _ = r.Context().Value(RequestIDKey{}).(string)
+		start = RequestStartFromContext(r.Context())
+	}))
+
+	t.Run("preserves provided ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil)
+		req.Header.Set("X-Request-ID", "client-supplied-id")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Request-ID"); got != "client-supplied-id" {
+			t.Errorf("Expected provided request ID in response header, got %q", got)
+		}
+		if ctxID != "client-supplied-id" {
+			t.Errorf("Expected provided request ID in context, got %q", ctxID)
+		}
+		if start.IsZero() || time.Since(start) > time.Minute {
+			t.Errorf("Expected the request start time in context, got %v", start)
+		}
+	})
+
+	t.Run("generates ID when missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Request-ID")
+		if !uuidPattern.MatchString(got) {
+			t.Errorf("Expected generated UUID request ID, got %q", got)
+		}
+		if ctxID != got {
+			t.Errorf("Expected context ID %q to match header, got %q", got, ctxID)
+		}
+	})
+}
+
+func TestSampledLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = original }()
+
+	handler := SampledLoggingMiddleware(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") == "true" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	for i := 0; i < 20; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil))
+	}
+	for i := 0; i < 7; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/trials/search?fail=true", nil))
+	}
+
+	successLogs := 0
+	errorLogs := 0
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		if entry["status"] == float64(http.StatusInternalServerError) {
+			errorLogs++
+		} else {
+			successLogs++
+		}
+	}
+
+	if successLogs != 4 {
+		t.Errorf("Expected 4 of 20 successful requests to be logged at 1-in-5 sampling, got %d", successLogs)
+	}
+	if errorLogs != 7 {
+		t.Errorf("Expected all 7 error responses to be logged, got %d", errorLogs)
+	}
+}
+
+func TestLoggingMiddlewareErrorBody(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = original }()
+	t.Cleanup(func() { SetErrorBodyLogBytes(DefaultErrorBodyLogBytes) })
+
+	handler := LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") == "true" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"upstream unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"trials":[]}`))
+	}))
+	lastEntry := func(query string) map[string]interface{} {
+		buf.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/trials/search"+query, nil))
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", buf.String(), err)
+		}
+		return entry
+	}
+
+	entry := lastEntry("?fail=true")
+	if entry["response_body"] != `{"error":"upstream unavailable"}` || entry["response_body_truncated"] != false {
+		t.Errorf("Expected the error body in the log, got %v", entry)
+	}
+	if entry := lastEntry(""); entry["response_body"] != nil {
+		t.Errorf("Expected no body logged for a success, got %v", entry["response_body"])
+	}
+
+	SetErrorBodyLogBytes(8)
+	entry = lastEntry("?fail=true")
+	if entry["response_body"] != `{"error"` || entry["response_body_truncated"] != true {
+		t.Errorf("Expected the error body bounded to 8 bytes, got %v", entry)
+	}
+
+	SetErrorBodyLogBytes(0)
+	if entry := lastEntry("?fail=true"); entry["response_body"] != nil {
+		t.Errorf("Expected no body logged when disabled, got %v", entry["response_body"])
+	}
+}
+
+func TestResponseWriterBuffering(t *testing.T) {
+	const limit = 16
+
+	rw := newResponseWriter(httptest.NewRecorder())
+	rw.bodyLimit = limit
+	rw.Write(bytes.Repeat([]byte("a"), 4096))
+	if rw.body.Cap() != 0 {
+		t.Errorf("Expected no buffer allocated for a successful response, got capacity %d", rw.body.Cap())
+	}
+
+	rec := httptest.NewRecorder()
+	rw = newResponseWriter(rec)
+	rw.bodyLimit = limit
+	rw.WriteHeader(http.StatusBadGateway)
+	for i := 0; i < 100; i++ {
+		rw.Write(bytes.Repeat([]byte("b"), 1024))
+	}
+	if rw.body.Len() != limit {
+		t.Errorf("Expected buffered error body bounded to %d bytes, got %d", limit, rw.body.Len())
+	}
+	if rw.bodySize != 100*1024 || rec.Body.Len() != 100*1024 {
+		t.Errorf("Expected the full body to be written and counted, got %d/%d", rw.bodySize, rec.Body.Len())
+	}
+}
+
+func TestLoggingMiddlewareServerTiming(t *testing.T) {
+	serverTiming := regexp.MustCompile(`^app;dur=([0-9]+\.[0-9]{3})$`)
+	timing := func(handler http.HandlerFunc) (string, float64) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		LoggingMiddleware(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil))
+		header := rec.Header().Get(ServerTimingHeader)
+		match := serverTiming.FindStringSubmatch(header)
+		if match == nil {
+			return header, -1
+		}
+		ms, _ := strconv.ParseFloat(match[1], 64)
+		return header, ms
+	}
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"trials":[]}`))
+	}
+	if header, ms := timing(slow); ms < 20 {
+		t.Errorf("Expected a numeric Server-Timing of at least 20ms, got %q", header)
+	}
+	if header, ms := timing(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) }); ms < 0 {
+		t.Errorf("Expected a numeric Server-Timing with WriteHeader, got %q", header)
+	}
+	if header, ms := timing(func(w http.ResponseWriter, r *http.Request) {}); ms < 0 {
+		t.Errorf("Expected a numeric Server-Timing when the handler writes nothing, got %q", header)
+	}
+
+	SetServerTiming(false)
+	defer SetServerTiming(true)
+	if header, _ := timing(slow); header != "" {
+		t.Errorf("Expected no Server-Timing when disabled, got %q", header)
+	}
+}
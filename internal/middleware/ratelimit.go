@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/logging"
+)
+
+// rateLimitSweepInterval is how often idle client buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket holds one client's request allowance
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ipRateLimiter is a token-bucket rate limiter keyed by client IP
+type ipRateLimiter struct {
+	rate      float64 // Tokens added per second
+	burst     float64 // Bucket capacity
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time // Overridable in tests
+}
+
+func newIPRateLimiter(rate float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the client's bucket. If none is left it returns false and how
+// long the client should wait before the next token is available.
+func (l *ipRateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, since they hold no state worth keeping.
+// It runs at most once per rateLimitSweepInterval so the map cannot grow without bound.
+func (l *ipRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// RateLimitMiddleware limits each client IP to rate requests per second, allowing bursts of up
+// to burst requests, so a single client cannot monopolize the shared upstream budget. Requests
+// over the limit get 429 with a Retry-After header. Paths listed in exempt are never limited.
+func RateLimitMiddleware(rate float64, burst int, exempt ...string) func(http.Handler) http.Handler {
+	limiter := newIPRateLimiter(rate, burst)
+	exempted := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exempted[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempted[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := getClientIP(r)
+			allowed, retryAfter := limiter.allow(client)
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				logger := logging.Logger(logging.ComponentMiddleware)
+				logger.Warn().
+					Str("request_id", RequestIDFromContext(r.Context())).
+					Str("client_ip", client).
+					Str("path", r.URL.Path).
+					Int("retry_after_seconds", seconds).
+					Msg("Client rate limit exceeded")
+
+				w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Rate limit exceeded; retry later"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := RateLimitMiddleware(0.5, 3, "/health")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A burst from one client: the first 3 pass, even from different source ports
+	for i := 0; i < 3; i++ {
+		if rec := request("/api/v1/trials/search", "203.0.113.7:"+strconv.Itoa(40000+i)); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, rec.Code)
+		}
+	}
+	rec := request("/api/v1/trials/search", "203.0.113.7:40003")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 once the burst is spent, got %d", rec.Code)
+	}
+	if retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 2 {
+		t.Errorf("Expected Retry-After of 1-2 seconds at 0.5 req/s, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Another client is unaffected
+	if rec := request("/api/v1/trials/search", "198.51.100.20:50000"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another IP to proceed, got %d", rec.Code)
+	}
+	// Health checks are exempt
+	if rec := request("/health", "203.0.113.7:40004"); rec.Code != http.StatusOK {
+		t.Errorf("Expected /health to be exempt, got %d", rec.Code)
+	}
+}
+
+func TestIPRateLimiterRefillAndSweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newIPRateLimiter(2, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("a"); !ok {
+			t.Fatalf("Request %d: expected to be allowed", i+1)
+		}
+	}
+	ok, wait := limiter.allow("a")
+	if ok {
+		t.Fatal("Expected the empty bucket to reject")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for the next token at 2 req/s, got %v", wait)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Error("Expected a token to be refilled after 500ms")
+	}
+
+	// Idle buckets are dropped once they have refilled
+	now = now.Add(2 * rateLimitSweepInterval)
+	limiter.allow("b")
+	if _, found := limiter.buckets["a"]; found {
+		t.Error("Expected the idle bucket to be swept")
+	}
+}
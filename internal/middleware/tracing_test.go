@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracingMiddlewareRecordsStatusOnly(t *testing.T) {
+	var recorder *statusRecorder
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if recorder, ok = w.(*statusRecorder); !ok {
+			t.Errorf("Expected the status-only recorder, got %T", w)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"upstream unavailable"}`))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/trials/search", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != `{"error":"upstream unavailable"}` {
+		t.Errorf("Expected the response passed through, got %d %q", rec.Code, rec.Body.String())
+	}
+	if recorder == nil || recorder.statusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the status recorded for the span, got %+v", recorder)
+	}
+}
@@ -1,23 +1,92 @@
 package models
 
+import "encoding/json"
+
 // Trial represents a clinical trial from ClinicalTrials.gov
 type Trial struct {
-	NCTID           string                 `json:"nct_id"`
-	Title           string                 `json:"title"`
-	Status          string                 `json:"status"`
-	Phase           []string               `json:"phase,omitempty"`
-	Conditions      []string               `json:"conditions,omitempty"`
-	Locations       []Location             `json:"locations,omitempty"`
-	Eligibility     Eligibility            `json:"eligibility,omitempty"`
-	Sponsor         Sponsor                `json:"sponsor,omitempty"`
-	Contacts        []Contact              `json:"contacts,omitempty"`
-	StartDate       string                 `json:"start_date,omitempty"`
-	CompletionDate  string                 `json:"completion_date,omitempty"`
-	BriefSummary    string                 `json:"brief_summary,omitempty"`
-	DetailedSummary string                 `json:"detailed_summary,omitempty"`
-	URL             string                 `json:"url"`
-	Registry        string                 `json:"registry"`
-	AdditionalData  map[string]interface{} `json:"additional_data,omitempty"`
+	NCTID            string                 `json:"nct_id"`
+	Title            string                 `json:"title"`
+	SecondaryIDs     []SecondaryID          `json:"secondary_ids,omitempty"`
+	Status           string                 `json:"status"`
+	StatusLabel      string                 `json:"status_label,omitempty"` // Display label of Status, with humanize_status=true
+	WhyStopped       string                 `json:"why_stopped,omitempty"`  // Reason given for a terminated, withdrawn or suspended trial
+	HasResults       bool                   `json:"has_results,omitempty"`  // Results have been posted to the registry
+	Phase            []string               `json:"phase,omitempty"`
+	Design           *Design                `json:"design,omitempty"`
+	Arms             []Arm                  `json:"arms,omitempty"` // Groups of participants the study compares
+	Conditions       []string               `json:"conditions,omitempty"`
+	Locations        []Location             `json:"locations,omitempty"`
+	Eligibility      Eligibility            `json:"eligibility,omitempty"`
+	Sponsor          Sponsor                `json:"sponsor,omitempty"`
+	Contacts         []Contact              `json:"contacts,omitempty"`
+	OverallOfficials []Official             `json:"overall_officials,omitempty"` // Investigators responsible for the study as a whole
+	StartDate        string                 `json:"start_date,omitempty"`
+	CompletionDate   string                 `json:"completion_date,omitempty"`
+	LastUpdateDate   string                 `json:"last_update_date,omitempty"` // Date the latest registry update was posted
+	BriefSummary     string                 `json:"brief_summary,omitempty"`
+	DetailedSummary  string                 `json:"detailed_summary,omitempty"`
+	URL              string                 `json:"url"`
+	Registry         string                 `json:"registry"`
+	Registries       []string               `json:"registries,omitempty"` // All registries the trial appeared in (registry=all)
+	Score            float64                `json:"score,omitempty"`      // Relevance score when sort=relevance
+	AdditionalData   map[string]interface{} `json:"additional_data,omitempty"`
+	// Raw is the untransformed upstream study, kept by ClinicalTrials.gov get-by-id fetches
+	// when small enough; it is only served on request (?raw=true)
+	Raw json.RawMessage `json:"-"`
+}
+
+// MarshalJSON omits the eligibility and sponsor objects when they are empty, instead of
+// serializing them as {}; clients treat a missing object as no data
+func (t Trial) MarshalJSON() ([]byte, error) {
+	type trial Trial // Drops the method set so encoding does not recurse
+	out := struct {
+		trial
+		Eligibility *Eligibility `json:"eligibility,omitempty"`
+		Sponsor     *Sponsor     `json:"sponsor,omitempty"`
+	}{trial: trial(t)}
+	if !t.Eligibility.isEmpty() {
+		out.Eligibility = &t.Eligibility
+	}
+	if t.Sponsor != (Sponsor{}) {
+		out.Sponsor = &t.Sponsor
+	}
+	return json.Marshal(out)
+}
+
+// TrialHistory lists the versions of a trial's registry record, oldest first
+type TrialHistory struct {
+	NCTID    string         `json:"nct_id"`
+	Versions []TrialVersion `json:"versions"`
+}
+
+// TrialVersion is one version of a trial's registry record
+type TrialVersion struct {
+	Version        int      `json:"version"`                   // 0 for the first submission
+	Date           string   `json:"date,omitempty"`            // Date the version was posted
+	Status         string   `json:"status,omitempty"`          // Overall status as of this version
+	ChangedModules []string `json:"changed_modules,omitempty"` // Record sections changed in this version
+}
+
+// SecondaryID represents an additional identifier for a trial (e.g. EudraCT number, sponsor protocol ID)
+type SecondaryID struct {
+	Type   string `json:"type,omitempty"`
+	ID     string `json:"id"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// Design represents how an interventional study is set up
+type Design struct {
+	Allocation        string `json:"allocation,omitempty"`
+	InterventionModel string `json:"intervention_model,omitempty"`
+	Masking           string `json:"masking,omitempty"`
+	PrimaryPurpose    string `json:"primary_purpose,omitempty"`
+}
+
+// Arm represents one arm (group of participants receiving the same intervention) of a trial
+type Arm struct {
+	Label       string `json:"label"`
+	Type        string `json:"type,omitempty"` // e.g. EXPERIMENTAL, ACTIVE_COMPARATOR, PLACEBO_COMPARATOR
+	Description string `json:"description,omitempty"`
 }
 
 // Location represents a trial location
@@ -28,44 +97,107 @@ type Location struct {
 	Latitude  float64 `json:"latitude,omitempty"`
 	Longitude float64 `json:"longitude,omitempty"`
 	ZipCode   string  `json:"zip_code,omitempty"`
+	Distance  float64 `json:"distance,omitempty"` // From the search coordinates, when computed; in miles unless units=km
 }
 
 // Eligibility represents trial eligibility criteria
 type Eligibility struct {
 	MinimumAge string `json:"minimum_age,omitempty"`
 	MaximumAge string `json:"maximum_age,omitempty"`
-	Gender     string `json:"gender,omitempty"`
-	Criteria   string `json:"criteria,omitempty"`
+	// MinimumAgeYears and MaximumAgeYears are the age strings converted to (fractional) years,
+	// e.g. 0.5 for "6 Months"; omitted when there is no limit or the string is not understood
+	MinimumAgeYears float64 `json:"minimum_age_years,omitempty"`
+	MaximumAgeYears float64 `json:"maximum_age_years,omitempty"`
+	Gender          string  `json:"gender,omitempty"`
+	Criteria        string  `json:"criteria,omitempty"`
+	// Inclusion and Exclusion are the items parsed from Criteria, which stays available as-is
+	Inclusion []string `json:"inclusion,omitempty"`
+	Exclusion []string `json:"exclusion,omitempty"`
+}
+
+// isEmpty reports whether no eligibility information is set
+func (e Eligibility) isEmpty() bool {
+	return e.MinimumAge == "" && e.MaximumAge == "" && e.Gender == "" && e.Criteria == "" &&
+		len(e.Inclusion) == 0 && len(e.Exclusion) == 0
 }
 
 // Sponsor represents trial sponsor information
 type Sponsor struct {
 	Name     string `json:"name,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Category string `json:"category,omitempty"`
+	Type     string `json:"type,omitempty"`     // Lead sponsor class, e.g. INDUSTRY, NIH, OTHER; matched by funder_type
+	Category string `json:"category,omitempty"` // Display label of Type, e.g. "Industry"
 }
 
 // Contact represents contact information
 type Contact struct {
 	Name  string `json:"name,omitempty"`
+	Role  string `json:"role,omitempty"` // e.g. CONTACT, PRINCIPAL_INVESTIGATOR
 	Phone string `json:"phone,omitempty"`
 	Email string `json:"email,omitempty"`
 }
 
+// Official represents an overall official of a trial
+type Official struct {
+	Name        string `json:"name,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+	Role        string `json:"role,omitempty"` // e.g. PRINCIPAL_INVESTIGATOR, STUDY_DIRECTOR, STUDY_CHAIR
+}
+
 // SearchRequest represents a search request for trials
 type SearchRequest struct {
-	Query      string   `json:"query,omitempty"`
-	Status     []string `json:"status,omitempty"`
-	Phase      []string `json:"phase,omitempty"`
-	Conditions []string `json:"conditions,omitempty"`
-	Location   string   `json:"location,omitempty"` // "city, state" or "country"
-	Latitude   float64  `json:"latitude,omitempty"`
-	Longitude  float64  `json:"longitude,omitempty"`
-	Distance   int      `json:"distance,omitempty"` // in miles
-	MinimumAge string   `json:"minimum_age,omitempty"`
-	MaximumAge string   `json:"maximum_age,omitempty"`
-	PageSize   int      `json:"page_size,omitempty"`
-	PageToken  string   `json:"page_token,omitempty"`
+	Registry        string   `json:"registry,omitempty"` // Source registry, defaults to clinicaltrials.gov
+	Query           string   `json:"query,omitempty"`
+	Status          []string `json:"status,omitempty"`
+	Phase           []string `json:"phase,omitempty"`
+	Conditions      []string `json:"conditions,omitempty"`
+	ConditionLogic  string   `json:"condition_logic,omitempty"` // "or" (default) or "and" to require every condition
+	Match           string   `json:"match,omitempty"`           // "partial" (default) or "exact" to require a listed condition verbatim
+	AdvancedQuery   string   `json:"advanced_query,omitempty"`  // Upstream query.term expression; replaces Query and Conditions
+	NCTIDs          []string `json:"nct_ids,omitempty"`         // Restrict the search to these trials; drops the default condition and status filters
+	Location        string   `json:"location,omitempty"`        // "city, state" or "country"
+	Country         string   `json:"country,omitempty"`         // Client-side filter on location country
+	Latitude        float64  `json:"latitude,omitempty"`
+	Longitude       float64  `json:"longitude,omitempty"`
+	Distance        int      `json:"distance,omitempty"` // In Units, miles by default
+	Units           string   `json:"units,omitempty"`    // "mi" (default) or "km", for Distance and computed distances
+	Age             int      `json:"age,omitempty"`      // Exact age in years; matches trials accepting a person of this age
+	MinimumAge      string   `json:"minimum_age,omitempty"`
+	MaximumAge      string   `json:"maximum_age,omitempty"`
+	UpdatedSince    string   `json:"updated_since,omitempty"`    // YYYY-MM-DD; only trials updated on or after this date
+	PruneLocations  bool     `json:"prune_locations,omitempty"`  // Drop locations outside Country
+	NearestOnly     bool     `json:"nearest_only,omitempty"`     // Keep only the site nearest to Latitude/Longitude
+	IncludeInactive bool     `json:"include_inactive,omitempty"` // Keep TERMINATED/WITHDRAWN/SUSPENDED trials
+	HasContact      bool     `json:"has_contact,omitempty"`      // Keep only trials with a contact reachable via ContactType
+	HasResults      bool     `json:"has_results,omitempty"`      // Keep only trials with posted results
+	FunderType      []string `json:"funder_type,omitempty"`      // Keep only trials whose lead sponsor class is listed
+	ContactType     string   `json:"contact_type,omitempty"`     // "email", "phone" or "any" (default)
+	IncludeDetailed bool     `json:"include_detailed,omitempty"` // Keep detailed summary and eligibility criteria in search results
+	OmitText        bool     `json:"omit_text,omitempty"`        // Drop all free text (summaries and criteria), overriding IncludeDetailed
+	Sort            string   `json:"sort,omitempty"`             // "relevance" to order by free-text query relevance
+	Highlight       bool     `json:"highlight,omitempty"`        // Wrap query terms in title and brief summary
+	HighlightPre    string   `json:"highlight_pre,omitempty"`    // Defaults to <em>
+	HighlightPost   string   `json:"highlight_post,omitempty"`   // Defaults to </em>
+	HumanizeStatus  bool     `json:"humanize_status,omitempty"`  // Add a display label next to each trial's status
+	PageSize        int      `json:"page_size,omitempty"`
+	PageToken       string   `json:"page_token,omitempty"`
+	FillPage        bool     `json:"fill_page,omitempty"` // Follow upstream pages until PageSize trials pass the client-side filters
+	// SkipTotal is set by scans (fill_page, exports) on the pages after the first, whose
+	// total is already known, so the upstream does not recount matches
+	SkipTotal bool `json:"-"`
+	// CoordinatesSet records that latitude and longitude were both given, so a point on the
+	// equator or the prime meridian, where one of them is 0, still counts as a location
+	CoordinatesSet bool `json:"-"`
+	// Start and completion date ranges, YYYY-MM-DD or YYYY-MM (the first of the month), inclusive
+	StartDateFrom      string `json:"start_date_from,omitempty"`
+	StartDateTo        string `json:"start_date_to,omitempty"`
+	CompletionDateFrom string `json:"completion_date_from,omitempty"`
+	CompletionDateTo   string `json:"completion_date_to,omitempty"`
+}
+
+// HasCoordinates reports whether the search is centered on a point. Requests that did not
+// record CoordinatesSet, such as decoded POST bodies, need both coordinates to be non-zero.
+func (r SearchRequest) HasCoordinates() bool {
+	return r.CoordinatesSet || (r.Latitude != 0 && r.Longitude != 0)
 }
 
 // SearchResponse represents the search results
@@ -74,4 +206,179 @@ type SearchResponse struct {
 	TotalCount    int     `json:"total_count"`
 	NextPageToken string  `json:"next_page_token,omitempty"`
 	PageSize      int     `json:"page_size"`
+	// UpstreamTotalCount is the number of matches the upstream reports for the whole search,
+	// before client-side filters. Scans carry it over from their first page.
+	UpstreamTotalCount int `json:"upstream_total_count,omitempty"`
+	// MostRecentUpdate is the latest LastUpdateDate among the returned trials; pass it as
+	// updated_since on the next poll to only fetch trials changed since
+	MostRecentUpdate string `json:"most_recent_update,omitempty"`
+	// AppliedFilters echoes the filters the search actually ran with, after defaults
+	AppliedFilters *AppliedFilters `json:"applied_filters,omitempty"`
+	// ExportID identifies a resumable export; pass it as export_id to get the next page
+	ExportID string `json:"export_id,omitempty"`
+	// FilteringNotice is set when client-side filters removed trials from the fetched page
+	FilteringNotice string `json:"filtering_notice,omitempty"`
+	// Partial is set when a fill_page search stopped early after an upstream error; the
+	// page holds the trials collected so far and is not cached, so a retry may return more
+	Partial bool `json:"partial,omitempty"`
+}
+
+// AppliedFilters describes the effective filters of a search, including any defaults
+// substituted for filters the request left empty
+type AppliedFilters struct {
+	Conditions          []string `json:"conditions"`
+	ConditionLogic      string   `json:"condition_logic,omitempty"`
+	ConditionsDefaulted bool     `json:"conditions_defaulted"` // No conditions or query given; the default condition search was used
+	Match               string   `json:"match,omitempty"`      // Set when conditions must be listed verbatim
+	AdvancedQuery       string   `json:"advanced_query,omitempty"`
+	NCTIDs              []string `json:"nct_ids,omitempty"`
+	Status              []string `json:"status"`
+	StatusDefaulted     bool     `json:"status_defaulted"` // No status given; recruiting statuses were used
+	IncludeInactive     bool     `json:"include_inactive"`
+	Phase               []string `json:"phase,omitempty"`
+	MinimumAge          string   `json:"minimum_age,omitempty"`
+	MaximumAge          string   `json:"maximum_age,omitempty"`
+	Country             string   `json:"country,omitempty"`
+	UpdatedSince        string   `json:"updated_since,omitempty"`
+	StartDateFrom       string   `json:"start_date_from,omitempty"`
+	StartDateTo         string   `json:"start_date_to,omitempty"`
+	CompletionDateFrom  string   `json:"completion_date_from,omitempty"`
+	CompletionDateTo    string   `json:"completion_date_to,omitempty"`
+	ContactType         string   `json:"contact_type,omitempty"` // Set when only trials with a contact are kept
+	HasResults          bool     `json:"has_results,omitempty"`
+	FunderType          []string `json:"funder_type,omitempty"`
+}
+
+// ConditionSuggestions lists condition names completing a typed prefix, best match first
+type ConditionSuggestions struct {
+	Query       string   `json:"query"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// WatchSubscription is a webhook registered for status changes of a trial
+type WatchSubscription struct {
+	NCTID  string `json:"nct_id"`
+	URL    string `json:"url"`
+	Status string `json:"status"` // Last seen status, which the next poll is compared against
+}
+
+// StatusChangeNotification is the body POSTed to a webhook when a watched trial changes status
+type StatusChangeNotification struct {
+	NCTID          string `json:"nct_id"`
+	Title          string `json:"title,omitempty"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+	DetectedAt     string `json:"detected_at"`
+}
+
+// LocationCount counts the matching trials and their sites in one country or state
+type LocationCount struct {
+	Country string `json:"country"`
+	State   string `json:"state,omitempty"`
+	Trials  int    `json:"trials"`
+	Sites   int    `json:"sites"`
+}
+
+// LocationSummary is the geographic distribution of the trials matching a search
+type LocationSummary struct {
+	TotalCount             int             `json:"total_count"`       // Trials matching upstream, before client-side filters; 0 when the registry reports no total
+	TrialsSummarized       int             `json:"trials_summarized"` // Trials on the page the counts are computed from
+	TrialsWithoutLocations int             `json:"trials_without_locations"`
+	Countries              []LocationCount `json:"countries"`
+	States                 []LocationCount `json:"states"`
+}
+
+// FeatureCollection is a GeoJSON (RFC 7946) collection of trial site points
+type FeatureCollection struct {
+	Type     string    `json:"type"` // Always "FeatureCollection"
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON point feature for one trial site
+type Feature struct {
+	Type       string            `json:"type"` // Always "Feature"
+	Geometry   Point             `json:"geometry"`
+	Properties FeatureProperties `json:"properties"`
+}
+
+// Point is a GeoJSON point geometry; coordinates are [longitude, latitude]
+type Point struct {
+	Type        string     `json:"type"` // Always "Point"
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// FeatureProperties describes the trial and site behind a GeoJSON feature
+type FeatureProperties struct {
+	NCTID  string `json:"nct_id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	City   string `json:"city,omitempty"`
+}
+
+// RawTrialResponse carries a trial's untransformed upstream study. Its shape is defined by the
+// upstream registry and may change without notice.
+type RawTrialResponse struct {
+	NCTID    string          `json:"nct_id"`
+	Registry string          `json:"registry"`
+	Raw      json.RawMessage `json:"raw"`
+}
+
+// ExplainResponse describes the upstream query a search would execute
+type ExplainResponse struct {
+	UpstreamURL string        `json:"upstream_url"`
+	Request     SearchRequest `json:"request"`
+}
+
+// HealthResponse represents the health check payload
+type HealthResponse struct {
+	Status          string  `json:"status"`
+	Version         string  `json:"version"`
+	Commit          string  `json:"commit"`
+	StartedAt       string  `json:"started_at"`
+	Uptime          string  `json:"uptime"`
+	UptimeSeconds   float64 `json:"uptime_seconds"`
+	UpstreamCircuit string  `json:"upstream_circuit,omitempty"` // closed, open or half-open
+}
+
+// ReadinessResponse represents the readiness probe payload. Status is "ready", or "degraded"
+// when recent upstream calls mostly failed or the upstream circuit is open.
+type ReadinessResponse struct {
+	Status            string  `json:"status"`
+	UpstreamErrorRate float64 `json:"upstream_error_rate"` // Failed fraction of recent upstream calls
+	UpstreamSamples   int     `json:"upstream_samples"`    // Recent upstream calls the rate covers
+	UpstreamCircuit   string  `json:"upstream_circuit"`    // closed, open or half-open
+}
+
+// CacheKeysResponse lists cached keys for debugging, sorted and cut at the requested limit
+type CacheKeysResponse struct {
+	Keys      []CacheKey `json:"keys"`
+	Total     int        `json:"total"`     // Cached keys before the limit
+	Truncated bool       `json:"truncated"` // More keys are cached than listed
+}
+
+// CacheKey is a cached key and when it expires
+type CacheKey struct {
+	Key       string `json:"key"`
+	ExpiresAt string `json:"expires_at,omitempty"` // RFC 3339; omitted for entries that never expire
+}
+
+// Envelope wraps a response body when the client opts into the uniform envelope format.
+// Data is null on errors and Errors is omitted on success.
+type Envelope struct {
+	Data   interface{}     `json:"data"`
+	Meta   EnvelopeMeta    `json:"meta"`
+	Errors []EnvelopeError `json:"errors,omitempty"`
+}
+
+// EnvelopeMeta carries request metadata in an enveloped response
+type EnvelopeMeta struct {
+	RequestID  string `json:"request_id,omitempty"`
+	DurationMs int64  `json:"duration_ms"` // Time from receiving the request to writing the response
+	CacheHit   bool   `json:"cache_hit"`
+}
+
+// EnvelopeError describes a failed request in an enveloped response
+type EnvelopeError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
 }
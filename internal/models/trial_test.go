@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTrialOmitsEmptySubObjects(t *testing.T) {
+	tests := []struct {
+		name            string
+		trial           Trial
+		wantEligibility bool
+		wantSponsor     bool
+	}{
+		{"empty", Trial{NCTID: "NCT00000001"}, false, false},
+		{"eligibility only", Trial{NCTID: "NCT00000001", Eligibility: Eligibility{Inclusion: []string{"Age 18+"}}}, true, false},
+		{"sponsor only", Trial{NCTID: "NCT00000001", Sponsor: Sponsor{Name: "NIH"}}, false, true},
+		{"both", Trial{NCTID: "NCT00000001", Eligibility: Eligibility{Gender: "ALL"}, Sponsor: Sponsor{Type: "NIH"}}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Trials are encoded by value in responses and by pointer elsewhere
+			for _, v := range []interface{}{tt.trial, &tt.trial} {
+				data, err := json.Marshal(v)
+				if err != nil {
+					t.Fatalf("Failed to encode trial: %v", err)
+				}
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(data, &fields); err != nil {
+					t.Fatalf("Failed to decode %s: %v", data, err)
+				}
+				if _, ok := fields["eligibility"]; ok != tt.wantEligibility {
+					t.Errorf("Expected eligibility present=%v in %s", tt.wantEligibility, data)
+				}
+				if _, ok := fields["sponsor"]; ok != tt.wantSponsor {
+					t.Errorf("Expected sponsor present=%v in %s", tt.wantSponsor, data)
+				}
+				if string(fields["nct_id"]) != `"NCT00000001"` {
+					t.Errorf("Expected the other fields to be kept, got %s", data)
+				}
+
+				var decoded Trial
+				if err := json.Unmarshal(data, &decoded); err != nil {
+					t.Fatalf("Failed to decode trial: %v", err)
+				}
+				if decoded.Sponsor != tt.trial.Sponsor || decoded.Eligibility.Gender != tt.trial.Eligibility.Gender ||
+					len(decoded.Eligibility.Inclusion) != len(tt.trial.Eligibility.Inclusion) {
+					t.Errorf("Expected trial to round-trip, got %+v", decoded)
+				}
+			}
+		})
+	}
+}
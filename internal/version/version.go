@@ -0,0 +1,26 @@
+package version
+
+import "time"
+
+// Build information, injected at build time via:
+//
+//	go build -ldflags "-X github.com/clinical-trials-microservice/internal/version.Version=1.2.3 -X github.com/clinical-trials-microservice/internal/version.Commit=abc123"
+var (
+	// Version is the release version of the service
+	Version = "dev"
+	// Commit is the git commit the binary was built from
+	Commit = "unknown"
+)
+
+// startTime records when the process started, used to compute uptime
+var startTime = time.Now()
+
+// StartTime returns the process start timestamp
+func StartTime() time.Time {
+	return startTime
+}
+
+// Uptime returns how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned for webhooks on loopback, private or link-local addresses,
+// which would let callers make the service POST to its own network (e.g. cloud metadata at
+// 169.254.169.254)
+var ErrBlockedAddress = errors.New("webhook address is loopback, private or link-local")
+
+// blockedIP reports whether ip must not receive webhook notifications
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// CheckURL resolves the host of a webhook URL and returns ErrBlockedAddress when any of its
+// addresses is blocked. Registration uses it to reject a webhook up front; the notification
+// dialer checks the address again, so a host re-resolving to a blocked address later is
+// still refused.
+func (w *Watcher) CheckURL(ctx context.Context, webhook *url.URL) error {
+	if w.allowPrivate {
+		return nil
+	}
+	host := webhook.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %q: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if blockedIP(addr.IP) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// guardedClient returns an HTTP client that refuses to connect to blocked addresses. The
+// check runs on the address actually dialed, after DNS resolution, and proxies from the
+// environment are ignored so they cannot relay requests into the private network.
+func guardedClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: DefaultNotifyTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return fmt.Errorf("dial %s: %w", address, ErrBlockedAddress)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: DefaultNotifyTimeout, Transport: transport}
+}
@@ -0,0 +1,295 @@
+// Package watch notifies webhooks when watched trials change status.
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/clinical-trials-microservice/internal/logging"
+	"github.com/clinical-trials-microservice/internal/models"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultInterval is how often watched trials are re-fetched
+	DefaultInterval = time.Hour
+	// DefaultNotifyTimeout bounds a single webhook POST
+	DefaultNotifyTimeout = 10 * time.Second
+	// DefaultMaxTrials caps the trials watched at once; every poll re-fetches each of them
+	// through the upstream rate limiter shared with searches
+	DefaultMaxTrials = 500
+	// DefaultMaxWebhooksPerTrial caps the webhooks registered for a single trial
+	DefaultMaxWebhooksPerTrial = 20
+)
+
+var (
+	// ErrTooManyTrials is returned when subscribing to a new trial would exceed the watched trial cap
+	ErrTooManyTrials = errors.New("too many trials watched")
+	// ErrTooManyWebhooks is returned when a trial already has the maximum number of webhooks
+	ErrTooManyWebhooks = errors.New("too many webhooks registered for this trial")
+)
+
+// Fetcher retrieves the current record of a trial. *api.ClinicalTrialsClient implements it,
+// so polling goes through the client's rate limiter and circuit breaker.
+type Fetcher interface {
+	GetTrialDetails(ctx context.Context, nctID string) (*models.Trial, error)
+}
+
+// watchedTrial is the last seen status of a trial and the webhooks waiting for it to change
+type watchedTrial struct {
+	status string
+	urls   map[string]bool
+}
+
+// Watcher keeps webhook subscriptions in memory, keyed by NCT ID, and polls the watched
+// trials for status changes. Subscriptions do not survive a restart.
+type Watcher struct {
+	fetcher  Fetcher
+	client   *http.Client
+	interval time.Duration
+	logger   zerolog.Logger
+	now      func() time.Time // Overridable in tests
+	// allowPrivate lets webhooks target loopback, private and link-local addresses
+	allowPrivate bool
+	maxTrials    int
+	maxWebhooks  int // Per trial
+
+	mu     sync.Mutex
+	trials map[string]*watchedTrial
+}
+
+// Option configures optional Watcher behavior
+type Option func(*Watcher)
+
+// WithInterval sets how often watched trials are re-fetched
+func WithInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// WithLimits caps the trials watched at once and the webhooks registered per trial.
+// Values of 0 or less keep the defaults.
+func WithLimits(trials, webhooksPerTrial int) Option {
+	return func(w *Watcher) {
+		if trials > 0 {
+			w.maxTrials = trials
+		}
+		if webhooksPerTrial > 0 {
+			w.maxWebhooks = webhooksPerTrial
+		}
+	}
+}
+
+// WithAllowPrivateWebhooks lets webhooks target loopback, private and link-local addresses,
+// for local development and tests. By default they are refused at registration and dial time.
+func WithAllowPrivateWebhooks(allow bool) Option {
+	return func(w *Watcher) {
+		w.allowPrivate = allow
+	}
+}
+
+// WithHTTPClient sets the client used to POST webhook notifications. The client is used
+// as is, without the default guard against blocked addresses.
+func WithHTTPClient(client *http.Client) Option {
+	return func(w *Watcher) {
+		w.client = client
+	}
+}
+
+// NewWatcher creates a Watcher that re-fetches trials through fetcher
+func NewWatcher(fetcher Fetcher, opts ...Option) *Watcher {
+	w := &Watcher{
+		fetcher:     fetcher,
+		interval:    DefaultInterval,
+		maxTrials:   DefaultMaxTrials,
+		maxWebhooks: DefaultMaxWebhooksPerTrial,
+		logger:      logging.Logger(logging.ComponentWatch),
+		now:         time.Now,
+		trials:      make(map[string]*watchedTrial),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.interval <= 0 {
+		w.interval = DefaultInterval
+	}
+	if w.client == nil && w.allowPrivate {
+		w.client = &http.Client{Timeout: DefaultNotifyTimeout}
+	} else if w.client == nil {
+		w.client = guardedClient()
+	}
+	return w
+}
+
+// Interval returns how often watched trials are re-fetched
+func (w *Watcher) Interval() time.Duration {
+	return w.interval
+}
+
+// Subscribe registers url for status changes of nctID. status is the trial's current status;
+// it becomes the baseline only when the trial is not watched yet, so a new subscriber does
+// not reset the change another subscriber is waiting on. Registering an already subscribed
+// url always succeeds; otherwise ErrTooManyTrials or ErrTooManyWebhooks is returned when the
+// subscription would exceed the caps.
+func (w *Watcher) Subscribe(nctID, url, status string) (models.WatchSubscription, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	trial, ok := w.trials[nctID]
+	switch {
+	case !ok && len(w.trials) >= w.maxTrials:
+		return models.WatchSubscription{}, ErrTooManyTrials
+	case !ok:
+		trial = &watchedTrial{status: status, urls: make(map[string]bool)}
+		w.trials[nctID] = trial
+	case !trial.urls[url] && len(trial.urls) >= w.maxWebhooks:
+		return models.WatchSubscription{}, ErrTooManyWebhooks
+	}
+	trial.urls[url] = true
+	return models.WatchSubscription{NCTID: nctID, URL: url, Status: trial.status}, nil
+}
+
+// Unsubscribe removes the url subscription of nctID, or every subscription of the trial when
+// url is empty, and returns how many were removed. A trial left without subscribers is no
+// longer polled.
+func (w *Watcher) Unsubscribe(nctID, url string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	trial, ok := w.trials[nctID]
+	if !ok {
+		return 0
+	}
+	removed := len(trial.urls)
+	if url == "" {
+		trial.urls = nil
+	} else if trial.urls[url] {
+		delete(trial.urls, url)
+		removed = 1
+	} else {
+		removed = 0
+	}
+	if len(trial.urls) == 0 {
+		delete(w.trials, nctID)
+	}
+	return removed
+}
+
+// watchedIDs returns the watched NCT IDs in a stable order
+func (w *Watcher) watchedIDs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]string, 0, len(w.trials))
+	for id := range w.trials {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Run polls the watched trials every interval until ctx is canceled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.Poll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Poll re-fetches every watched trial once, one at a time, and notifies the subscribers of
+// trials whose status changed since the last poll. Trials that fail to fetch keep their
+// last seen status and are retried on the next poll.
+func (w *Watcher) Poll(ctx context.Context) {
+	ids := w.watchedIDs()
+	changed := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		trial, err := w.fetcher.GetTrialDetails(ctx, id)
+		if err != nil {
+			w.logger.Warn().Err(err).Str("nct_id", id).Msg("Failed to re-fetch watched trial")
+			continue
+		}
+
+		w.mu.Lock()
+		watched, ok := w.trials[id]
+		if !ok || watched.status == trial.Status {
+			w.mu.Unlock()
+			continue
+		}
+		notification := models.StatusChangeNotification{
+			NCTID:          id,
+			Title:          trial.Title,
+			PreviousStatus: watched.status,
+			Status:         trial.Status,
+			DetectedAt:     w.now().UTC().Format(time.RFC3339),
+		}
+		watched.status = trial.Status
+		urls := make([]string, 0, len(watched.urls))
+		for url := range watched.urls {
+			urls = append(urls, url)
+		}
+		w.mu.Unlock()
+
+		changed++
+		sort.Strings(urls)
+		for _, url := range urls {
+			w.notify(ctx, url, notification)
+		}
+	}
+	w.logger.Debug().
+		Int("trials", len(ids)).
+		Int("changed", changed).
+		Msg("Polled watched trials")
+}
+
+// notify POSTs a status change to one webhook. Failed deliveries are logged, not retried.
+func (w *Watcher) notify(ctx context.Context, url string, notification models.StatusChangeNotification) {
+	logger := w.logger.With().
+		Str("nct_id", notification.NCTID).
+		Str("webhook_url", url).
+		Str("previous_status", notification.PreviousStatus).
+		Str("status", notification.Status).
+		Logger()
+
+	err := w.post(ctx, url, notification)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Webhook delivery failed")
+		return
+	}
+	logger.Info().Msg("Webhook notified of status change")
+}
+
+// post sends notification as JSON to url, failing on non-2xx responses
+func (w *Watcher) post(ctx context.Context, url string, notification models.StatusChangeNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/clinical-trials-microservice/internal/models"
+)
+
+// fakeFetcher serves trial statuses from a map that tests can change between polls
+type fakeFetcher struct {
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+func (f *fakeFetcher) GetTrialDetails(ctx context.Context, nctID string) (*models.Trial, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status, ok := f.statuses[nctID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &models.Trial{NCTID: nctID, Title: "Trial " + nctID, Status: status}, nil
+}
+
+func (f *fakeFetcher) set(nctID, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[nctID] = status
+}
+
+func TestPollNotifiesOnStatusChange(t *testing.T) {
+	var mu sync.Mutex
+	var received []models.StatusChangeNotification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON POST, got %s with %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var notification models.StatusChangeNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Errorf("Failed to decode notification: %v", err)
+		}
+		mu.Lock()
+		received = append(received, notification)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+	notifications := func() []models.StatusChangeNotification {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]models.StatusChangeNotification(nil), received...)
+	}
+
+	fetcher := &fakeFetcher{statuses: map[string]string{"NCT00000001": "RECRUITING", "NCT00000002": "RECRUITING"}}
+	w := NewWatcher(fetcher, WithAllowPrivateWebhooks(true))
+	w.Subscribe("NCT00000001", webhook.URL+"/hook", "RECRUITING")
+	w.Subscribe("NCT00000002", webhook.URL+"/hook", "RECRUITING")
+
+	// Nothing changed yet
+	w.Poll(context.Background())
+	if got := notifications(); len(got) != 0 {
+		t.Fatalf("Expected no notifications without a status change, got %v", got)
+	}
+
+	fetcher.set("NCT00000001", "COMPLETED")
+	w.Poll(context.Background())
+	if len(notifications()) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications()))
+	}
+	got := notifications()[0]
+	if got.NCTID != "NCT00000001" || got.PreviousStatus != "RECRUITING" || got.Status != "COMPLETED" || got.Title != "Trial NCT00000001" || got.DetectedAt == "" {
+		t.Errorf("Unexpected notification %+v", got)
+	}
+
+	// The new status is the baseline for the next poll
+	w.Poll(context.Background())
+	if n := len(notifications()); n != 1 {
+		t.Errorf("Expected a change to be notified once, got %d notifications", n)
+	}
+}
+
+func TestSubscribeAndUnsubscribe(t *testing.T) {
+	w := NewWatcher(&fakeFetcher{})
+
+	w.Subscribe("NCT00000001", "https://a.example/hook", "RECRUITING")
+	// A later subscriber does not reset the baseline
+	if sub, _ := w.Subscribe("NCT00000001", "https://b.example/hook", "COMPLETED"); sub.Status != "RECRUITING" {
+		t.Errorf("Expected the existing baseline to be kept, got %q", sub.Status)
+	}
+
+	if n := w.Unsubscribe("NCT00000001", "https://unknown.example/hook"); n != 0 {
+		t.Errorf("Expected unknown URL to remove nothing, removed %d", n)
+	}
+	if n := w.Unsubscribe("NCT00000001", "https://a.example/hook"); n != 1 {
+		t.Errorf("Expected 1 subscription removed, got %d", n)
+	}
+	if n := w.Unsubscribe("NCT00000001", ""); n != 1 {
+		t.Errorf("Expected the remaining subscription removed, got %d", n)
+	}
+	if ids := w.watchedIDs(); len(ids) != 0 {
+		t.Errorf("Expected no watched trials left, got %v", ids)
+	}
+}
+
+func TestSubscriptionLimits(t *testing.T) {
+	w := NewWatcher(&fakeFetcher{}, WithLimits(2, 2))
+
+	for _, sub := range [][2]string{
+		{"NCT00000001", "https://a.example/hook"},
+		{"NCT00000001", "https://b.example/hook"},
+		{"NCT00000001", "https://a.example/hook"}, // Already registered
+		{"NCT00000002", "https://a.example/hook"},
+	} {
+		if _, err := w.Subscribe(sub[0], sub[1], "RECRUITING"); err != nil {
+			t.Errorf("Subscribe(%s, %s): unexpected error %v", sub[0], sub[1], err)
+		}
+	}
+	if _, err := w.Subscribe("NCT00000001", "https://c.example/hook", "RECRUITING"); !errors.Is(err, ErrTooManyWebhooks) {
+		t.Errorf("Expected ErrTooManyWebhooks, got %v", err)
+	}
+	if _, err := w.Subscribe("NCT00000003", "https://a.example/hook", "RECRUITING"); !errors.Is(err, ErrTooManyTrials) {
+		t.Errorf("Expected ErrTooManyTrials, got %v", err)
+	}
+
+	// Unsubscribing frees room again
+	w.Unsubscribe("NCT00000002", "")
+	if _, err := w.Subscribe("NCT00000003", "https://a.example/hook", "RECRUITING"); err != nil {
+		t.Errorf("Expected room for a new trial after unsubscribing, got %v", err)
+	}
+	if def := NewWatcher(&fakeFetcher{}); def.maxTrials != DefaultMaxTrials || def.maxWebhooks != DefaultMaxWebhooksPerTrial {
+		t.Errorf("Expected default limits, got %d trials and %d webhooks", def.maxTrials, def.maxWebhooks)
+	}
+}
+
+func TestBlockedWebhookAddresses(t *testing.T) {
+	w := NewWatcher(&fakeFetcher{})
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		webhook, _ := url.Parse(raw)
+		if err := w.CheckURL(context.Background(), webhook); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("%s: expected ErrBlockedAddress, got %v", raw, err)
+		}
+	}
+	public, _ := url.Parse("https://93.184.216.34/hook")
+	if err := w.CheckURL(context.Background(), public); err != nil {
+		t.Errorf("Expected a public address to be accepted, got %v", err)
+	}
+
+	// The dialer refuses blocked addresses even for webhooks that were never checked
+	var hits atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer webhook.Close()
+	if err := w.post(context.Background(), webhook.URL, models.StatusChangeNotification{}); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected the notification to a loopback webhook to be refused, got %v", err)
+	}
+	if hits.Load() != 0 {
+		t.Error("Expected the blocked webhook not to be reached")
+	}
+
+	allowed := NewWatcher(&fakeFetcher{}, WithAllowPrivateWebhooks(true))
+	loopback, _ := url.Parse(webhook.URL)
+	if err := allowed.CheckURL(context.Background(), loopback); err != nil {
+		t.Errorf("Expected private webhooks to be allowed, got %v", err)
+	}
+	if err := allowed.post(context.Background(), webhook.URL, models.StatusChangeNotification{}); err != nil || hits.Load() != 1 {
+		t.Errorf("Expected the allowed webhook to be reached, got %v", err)
+	}
+}